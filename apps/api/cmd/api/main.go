@@ -47,6 +47,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	go appInstance.Payments.Run(ctx, cfg.Payment.SweepInterval)
+	thumbnailsDone := make(chan struct{})
+	go func() {
+		appInstance.Jobs.RunThumbnails(ctx, cfg.Storage.ThumbnailWorkers)
+		close(thumbnailsDone)
+	}()
+
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.Port),
 		Handler:           apiserver.New(appInstance),
@@ -69,4 +76,5 @@ func main() {
 	} else {
 		logger.Info("server shutdown complete")
 	}
+	<-thumbnailsDone
 }
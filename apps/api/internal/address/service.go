@@ -0,0 +1,174 @@
+package address
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+var (
+	ErrNotFound     = errors.New("address not found")
+	ErrInvalidInput = errors.New("name, line 1, city, postal code and a two-letter country are required")
+	ErrNoAddress    = errors.New("add a shipping address first")
+)
+
+type Service struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+type Input struct {
+	Label      string
+	Name       string
+	Line1      string
+	Line2      string
+	City       string
+	Region     string
+	PostalCode string
+	Country    string
+	Phone      string
+	IsDefault  *bool
+}
+
+func New(db *gorm.DB, logger *slog.Logger) *Service {
+	return &Service{db: db, logger: logger}
+}
+
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]database.Address, error) {
+	var addresses []database.Address
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("is_default DESC, created_at ASC").
+		Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+func (s *Service) Get(ctx context.Context, userID, id uuid.UUID) (*database.Address, error) {
+	var address database.Address
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&address).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Resolve returns the address with id, or the user's default address when id
+// is nil.
+func (s *Service) Resolve(ctx context.Context, userID uuid.UUID, id *uuid.UUID) (*database.Address, error) {
+	if id != nil {
+		return s.Get(ctx, userID, *id)
+	}
+	var address database.Address
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("is_default DESC, created_at ASC").
+		First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoAddress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Create saves an address. A user's first address becomes their default.
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, input Input) (*database.Address, error) {
+	address := &database.Address{UserID: userID}
+	apply(address, input)
+	if !valid(address.PostalAddress) {
+		return nil, ErrInvalidInput
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&database.Address{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		address.IsDefault = count == 0 || (input.IsDefault != nil && *input.IsDefault)
+		if address.IsDefault {
+			if err := clearDefault(tx, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(address).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// Update applies the non-empty fields of input. Line 2, region and phone can
+// only be replaced, not cleared.
+func (s *Service) Update(ctx context.Context, userID, id uuid.UUID, input Input) (*database.Address, error) {
+	address, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	apply(address, input)
+	if !valid(address.PostalAddress) {
+		return nil, ErrInvalidInput
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if input.IsDefault != nil && *input.IsDefault && !address.IsDefault {
+			if err := clearDefault(tx, userID); err != nil {
+				return err
+			}
+			address.IsDefault = true
+		}
+		return tx.Save(address).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+func (s *Service) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	res := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&database.Address{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func clearDefault(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&database.Address{}).
+		Where("user_id = ? AND is_default = ?", userID, true).
+		Update("is_default", false).Error
+}
+
+func apply(address *database.Address, input Input) {
+	set := func(dst *string, v string) {
+		if v = strings.TrimSpace(v); v != "" {
+			*dst = v
+		}
+	}
+	set(&address.Label, input.Label)
+	set(&address.Name, input.Name)
+	set(&address.Line1, input.Line1)
+	set(&address.Line2, input.Line2)
+	set(&address.City, input.City)
+	set(&address.Region, strings.ToUpper(input.Region))
+	set(&address.PostalCode, input.PostalCode)
+	set(&address.Country, strings.ToUpper(input.Country))
+	set(&address.Phone, input.Phone)
+}
+
+func valid(a database.PostalAddress) bool {
+	return a.Name != "" && a.Line1 != "" && a.City != "" && a.PostalCode != "" && len(a.Country) == 2
+}
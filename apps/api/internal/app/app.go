@@ -7,32 +7,48 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/3dprint-hub/api/internal/address"
 	"github.com/3dprint-hub/api/internal/auth"
 	"github.com/3dprint-hub/api/internal/cart"
+	"github.com/3dprint-hub/api/internal/catalog"
 	"github.com/3dprint-hub/api/internal/config"
 	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/invoice"
 	"github.com/3dprint-hub/api/internal/jobs"
 	"github.com/3dprint-hub/api/internal/mailer"
 	"github.com/3dprint-hub/api/internal/oauth"
 	"github.com/3dprint-hub/api/internal/order"
+	"github.com/3dprint-hub/api/internal/payment"
 	"github.com/3dprint-hub/api/internal/pricing"
+	"github.com/3dprint-hub/api/internal/printers"
+	"github.com/3dprint-hub/api/internal/promotions"
+	"github.com/3dprint-hub/api/internal/shipping"
 	"github.com/3dprint-hub/api/internal/storage"
+	"github.com/3dprint-hub/api/internal/tax"
 	"github.com/3dprint-hub/api/internal/token"
 )
 
 type Application struct {
-	Config  *config.Config
-	Logger  *slog.Logger
-	DB      *gorm.DB
-	Tokens  *token.Service
-	Auth    *auth.Service
-	Mailer  mailer.Mailer
-	OAuth   *oauth.Manager
-	Pricing *pricing.Service
-	Storage storage.Provider
-	Cart    *cart.Service
-	Orders  *order.Service
-	Jobs    *jobs.Service
+	Config     *config.Config
+	Logger     *slog.Logger
+	DB         *gorm.DB
+	Tokens     *token.Service
+	Auth       *auth.Service
+	Mailer     mailer.Mailer
+	OAuth      *oauth.Manager
+	Pricing    *pricing.Service
+	Storage    storage.Provider
+	Cart       *cart.Service
+	Orders     *order.Service
+	Jobs       *jobs.Service
+	Printers   *printers.Service
+	Catalog    *catalog.Service
+	Payments   *payment.Service
+	Taxes      *tax.Service
+	Addresses  *address.Service
+	Shipping   *shipping.Service
+	Promotions *promotions.Service
+	Invoices   *invoice.Service
 }
 
 func New(ctx context.Context, cfg *config.Config, logger *slog.Logger, db *gorm.DB) (*Application, error) {
@@ -44,20 +60,68 @@ func New(ctx context.Context, cfg *config.Config, logger *slog.Logger, db *gorm.
 
 	tokenSvc := token.New(cfg.JWT.Secret, cfg.JWT.AccessTokenTTL, cfg.JWT.RefreshTokenTTL, cfg.JWT.RefreshTokenSize, logger)
 
+	printerSvc := printers.New(db, logger)
+
 	pricingSvc := pricing.NewService(pricing.Options{
-		MaterialCostPLA: cfg.Pricing.MaterialCostPLA,
-		MachineRate:     cfg.Pricing.MachineRate,
-		SetupFee:        cfg.Pricing.SetupFee,
-		PrintSpeed:      cfg.Pricing.PrintSpeed,
-		Logger:          logger,
-		StoragePath:     cfg.Storage.UploadsPath,
+		MaterialCostPLA:  cfg.Pricing.MaterialCostPLA,
+		MachineRate:      cfg.Pricing.MachineRate,
+		SetupFee:         cfg.Pricing.SetupFee,
+		PrintSpeed:       cfg.Pricing.PrintSpeed,
+		WallCount:        cfg.Pricing.WallCount,
+		TopLayers:        cfg.Pricing.TopLayers,
+		BottomLayers:     cfg.Pricing.BottomLayers,
+		LineWidthMM:      cfg.Pricing.LineWidthMM,
+		Printers:         printerSvc,
+		SupportAngleDeg:  cfg.Pricing.SupportAngleDeg,
+		SupportDensity:   cfg.Pricing.SupportDensity,
+		Logger:           logger,
+		StoragePath:      cfg.Storage.UploadsPath,
+		MaxAnalysisBytes: cfg.Pricing.MaxAnalysisBytes,
 	})
 
 	oauthMgr := oauth.NewManager(cfg, logger)
 
-	cartSvc := cart.New(db, logger)
-	orderSvc := order.New(db, logger)
-	jobSvc := jobs.New(db, logger, storageProvider)
+	jobSvc := jobs.New(db, logger, storageProvider, pricingSvc)
+	catalogSvc := catalog.New(db, logger)
+	promotionSvc := promotions.New(db, logger)
+	cartSvc := cart.New(db, logger, jobSvc, catalogSvc, promotionSvc)
+	paymentProvider, err := payment.NewProvider(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	taxSvc := tax.New(db, logger, database.TaxRule{
+		Name:            "Default",
+		RateBasisPoints: cfg.Tax.DefaultRateBasisPoints,
+		Inclusive:       cfg.Tax.DefaultInclusive,
+	})
+	addressSvc := address.New(db, logger)
+	shippingSvc := shipping.New(db, logger, shipping.Options{
+		PackagingGrams: cfg.Shipping.PackagingGrams,
+		PaddingMM:      cfg.Shipping.PaddingMM,
+		DimDivisor:     cfg.Shipping.DimDivisor,
+	})
+	invoiceSvc := invoice.New(db, logger, mailerSvc, invoice.Options{
+		Prefix: cfg.Invoice.Prefix,
+		Issuer: invoice.Party{
+			Name:    cfg.Invoice.IssuerName,
+			Address: cfg.Invoice.IssuerAddress,
+			Email:   cfg.Invoice.IssuerEmail,
+			TaxID:   cfg.Invoice.IssuerTaxID,
+		},
+	})
+	paymentSvc := payment.New(db, logger, paymentProvider, invoiceSvc, cfg.Payment.TTL)
+	orderSvc := order.New(order.Options{
+		DB:         db,
+		Logger:     logger,
+		Pricer:     cartSvc,
+		Payments:   paymentSvc,
+		Taxes:      taxSvc,
+		Addresses:  addressSvc,
+		Shipping:   shippingSvc,
+		Promotions: promotionSvc,
+		Invoices:   invoiceSvc,
+		Currency:   cfg.Currency,
+	})
 
 	authSvc := auth.NewService(auth.Options{
 		DB:         db,
@@ -68,24 +132,55 @@ func New(ctx context.Context, cfg *config.Config, logger *slog.Logger, db *gorm.
 		Pricing:    pricingSvc,
 		Storage:    storageProvider,
 		SignerIDFn: func() uuid.UUID { return uuid.New() },
+		Denylist:   cfg.JWT.Denylist,
+		Policy: auth.VerificationPolicy{
+			Checkout:         cfg.EmailVerification.Checkout,
+			UploadLimitBytes: cfg.EmailVerification.UploadLimitBytes,
+		},
+		VerifyTTL: cfg.EmailVerification.TTL,
+		MFAIssuer: cfg.MFA.Issuer,
+		MFARoles:  cfg.MFA.RequiredRoles,
+		Throttle: auth.ThrottlePolicy{
+			AccountThreshold: cfg.Lockout.AccountThreshold,
+			IPThreshold:      cfg.Lockout.IPThreshold,
+			BaseDelay:        cfg.Lockout.BaseDelay,
+			MaxDelay:         cfg.Lockout.MaxDelay,
+			Window:           cfg.Lockout.Window,
+			ResetLimit:       cfg.Lockout.ResetLimit,
+			ResetWindow:      cfg.Lockout.ResetWindow,
+		},
 	})
 
 	return &Application{
-		Config:  cfg,
-		Logger:  logger,
-		DB:      db,
-		Tokens:  tokenSvc,
-		Auth:    authSvc,
-		Mailer:  mailerSvc,
-		OAuth:   oauthMgr,
-		Pricing: pricingSvc,
-		Storage: storageProvider,
-		Cart:    cartSvc,
-		Orders:  orderSvc,
-		Jobs:    jobSvc,
+		Config:     cfg,
+		Logger:     logger,
+		DB:         db,
+		Tokens:     tokenSvc,
+		Auth:       authSvc,
+		Mailer:     mailerSvc,
+		OAuth:      oauthMgr,
+		Pricing:    pricingSvc,
+		Storage:    storageProvider,
+		Cart:       cartSvc,
+		Orders:     orderSvc,
+		Jobs:       jobSvc,
+		Printers:   printerSvc,
+		Catalog:    catalogSvc,
+		Payments:   paymentSvc,
+		Taxes:      taxSvc,
+		Addresses:  addressSvc,
+		Shipping:   shippingSvc,
+		Promotions: promotionSvc,
+		Invoices:   invoiceSvc,
 	}, nil
 }
 
 func (a *Application) Migrate(ctx context.Context) error {
-	return database.Migrate(ctx, a.DB)
+	if err := database.Migrate(ctx, a.DB); err != nil {
+		return err
+	}
+	if err := a.Printers.EnsureDefaults(ctx); err != nil {
+		return err
+	}
+	return a.Shipping.EnsureDefaults(ctx)
 }
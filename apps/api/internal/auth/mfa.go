@@ -0,0 +1,450 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/totp"
+)
+
+var (
+	ErrMFAEnabled      = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled   = errors.New("two-factor authentication not enabled")
+	ErrMFANotEnrolled  = errors.New("start two-factor enrolment first")
+	ErrInvalidMFACode  = errors.New("invalid authentication code")
+	ErrMFARoleRequired = errors.New("two-factor authentication is required for this account")
+	// ErrMFASessionRequired guards changes to the factor itself, so a stolen
+	// password-only session cannot turn it off or read new recovery codes.
+	ErrMFASessionRequired = errors.New("sign in with two-factor authentication first")
+	// ErrRecentLoginRequired asks accounts without a password to sign in
+	// again before enrolling, as the password does for the others.
+	ErrRecentLoginRequired = errors.New("sign in again to continue")
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaSkew           = 1 // accept codes one step either side of now
+	recoveryCodeCount = 10
+	recoveryAlphabet  = "0123456789abcdefghjkmnpqrstvwxyz" // Crockford base32
+	// recentLogin is how long after signing in an account without a
+	// password may enrol a factor.
+	recentLogin = 10 * time.Minute
+)
+
+// MFAEnrolment is what an authenticator app needs to add the account.
+type MFAEnrolment struct {
+	Secret string
+	URI    string
+}
+
+// MFARequired reports whether role must sign in with a second factor.
+func (s *Service) MFARequired(role string) bool {
+	return s.mfaRoles[role]
+}
+
+// MFAEnabled reports whether the user signs in with a second factor.
+func (s *Service) MFAEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	factor, err := s.factor(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return false, err
+	}
+	return factor != nil && factor.EnabledAt != nil, nil
+}
+
+// EnrollMFA starts enrolment with a new secret. The factor stays inactive
+// until ConfirmMFA sees a valid code; enrolling again replaces a pending
+// secret. The caller proves it is the account holder with the current
+// password or, for accounts without one, a session signed in within
+// recentLogin, so a stolen session cannot put the account under an
+// attacker's authenticator.
+func (s *Service) EnrollMFA(ctx context.Context, userID, sessionID uuid.UUID, password string, meta LoginMetadata) (*MFAEnrolment, error) {
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if err := s.reauthenticate(ctx, &user, sessionID, password, meta); err != nil {
+		return nil, err
+	}
+	factor, err := s.factor(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor != nil && factor.EnabledAt != nil {
+		return nil, ErrMFAEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.tokens.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil {
+		err = s.db.WithContext(ctx).Create(&database.MFAFactor{UserID: userID, Secret: sealed}).Error
+	} else {
+		err = s.db.WithContext(ctx).Model(factor).Updates(map[string]any{"secret": sealed, "last_step": 0}).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &MFAEnrolment{Secret: secret, URI: totp.URI(s.issuer, user.Email, secret)}, nil
+}
+
+// ConfirmMFA turns two-factor authentication on with the first code from the
+// authenticator. Every existing session is signed out, since none of them
+// signed in with a second factor, and the caller gets a new one that counts
+// as two-factor. The recovery codes are returned; they are only ever shown
+// this once. Wrong codes count as failed logins, as in withSecondFactor.
+func (s *Service) ConfirmMFA(ctx context.Context, userID uuid.UUID, code string, meta LoginMetadata) (*AuthResult, []string, error) {
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrUserNotFound
+		}
+		return nil, nil, err
+	}
+	var codes []string
+	var revoked revocation
+	err := s.throttleSecondFactor(ctx, &user, meta, func(tx *gorm.DB) error {
+		factor, err := s.factor(tx, userID)
+		if err != nil {
+			return err
+		}
+		if factor == nil {
+			return ErrMFANotEnrolled
+		}
+		if factor.EnabledAt != nil {
+			return ErrMFAEnabled
+		}
+		step, err := s.checkTOTP(factor, code)
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&database.MFAFactor{}).
+			Where("id = ? AND enabled_at IS NULL", factor.ID).
+			Updates(map[string]any{"enabled_at": time.Now(), "last_step": step})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return ErrMFAEnabled
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		if err != nil {
+			return err
+		}
+		sessions, err := activeSessionIDs(tx, userID)
+		if err != nil {
+			return err
+		}
+		revoked, err = s.revokeSessions(tx, userID, sessions)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.deny(revoked)
+	result, err := s.issueTokens(ctx, &user, nil, true, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, codes, nil
+}
+
+// DisableMFA turns two-factor authentication off after checking an
+// authenticator or recovery code. It needs a session that signed in with the
+// second factor, and roles that require it cannot turn it off.
+func (s *Service) DisableMFA(ctx context.Context, userID uuid.UUID, mfaSession bool, code string, meta LoginMetadata) error {
+	user, err := s.mfaUser(ctx, userID, mfaSession, meta)
+	if err != nil {
+		return err
+	}
+	if s.MFARequired(user.Role) {
+		return ErrMFARoleRequired
+	}
+	return s.withSecondFactor(ctx, user, code, meta, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&database.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.MFAFactor{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// an authenticator or recovery code. Like DisableMFA it needs a session that
+// signed in with the second factor.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, mfaSession bool, code string, meta LoginMetadata) ([]string, error) {
+	user, err := s.mfaUser(ctx, userID, mfaSession, meta)
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	err = s.withSecondFactor(ctx, user, code, meta, func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// mfaUser loads a user with two-factor authentication on, for a change to
+// it from a session that signed in with it. Attempts from other sessions are
+// audited, since they suggest a stolen password or session.
+func (s *Service) mfaUser(ctx context.Context, userID uuid.UUID, mfaSession bool, meta LoginMetadata) (*database.User, error) {
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	enabled, err := s.MFAEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrMFANotEnabled
+	}
+	if !mfaSession {
+		s.audit(ctx, EventMFAChangeRefused, &user.ID, user.Email, meta)
+		return nil, ErrMFASessionRequired
+	}
+	return &user, nil
+}
+
+// withSecondFactor checks code and runs fn in the same transaction. Wrong
+// codes count against the login failure counters, as in CompleteMFA.
+func (s *Service) withSecondFactor(ctx context.Context, user *database.User, code string, meta LoginMetadata, fn func(tx *gorm.DB) error) error {
+	return s.throttleSecondFactor(ctx, user, meta, func(tx *gorm.DB) error {
+		if err := s.verifySecondFactor(tx, user.ID, code); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// throttleSecondFactor runs fn, which checks a code, in a transaction unless
+// the user or client is locked out, and counts an ErrInvalidMFACode from it
+// as a failed login.
+func (s *Service) throttleSecondFactor(ctx context.Context, user *database.User, meta LoginMetadata, fn func(tx *gorm.DB) error) error {
+	if err := s.checkThrottle(ctx, loginKeys(user.Email, meta)...); err != nil {
+		if errors.Is(err, ErrThrottled) {
+			s.audit(ctx, EventLoginThrottled, &user.ID, user.Email, meta)
+		}
+		return err
+	}
+	err := s.db.WithContext(ctx).Transaction(fn)
+	if errors.Is(err, ErrInvalidMFACode) {
+		if err := s.loginFailed(ctx, EventMFAFailed, &user.ID, user.Email, meta); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// reauthenticate checks the user's password, counting a wrong one as a
+// failed login. Accounts without a password instead need sessionID to have
+// signed in within recentLogin.
+func (s *Service) reauthenticate(ctx context.Context, user *database.User, sessionID uuid.UUID, password string, meta LoginMetadata) error {
+	if user.PasswordHash == nil {
+		var root database.RefreshToken
+		err := s.db.WithContext(ctx).Select("created_at").
+			Where("id = ? AND user_id = ?", sessionID, user.ID).
+			First(&root).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && time.Since(root.CreatedAt) > recentLogin {
+			return ErrRecentLoginRequired
+		}
+		return err
+	}
+	if err := s.checkThrottle(ctx, loginKeys(user.Email, meta)...); err != nil {
+		if errors.Is(err, ErrThrottled) {
+			s.audit(ctx, EventLoginThrottled, &user.ID, user.Email, meta)
+		}
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(*user.PasswordHash), []byte(password)); err != nil {
+		if err := s.loginFailed(ctx, EventLoginFailed, &user.ID, user.Email, meta); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// CompleteMFA finishes a login that returned an MFA challenge.
+func (s *Service) CompleteMFA(ctx context.Context, mfaToken, code string, meta LoginMetadata) (*AuthResult, error) {
+	claims, err := s.tokens.ParseMFAToken(mfaToken)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	// Codes are guessed far more easily than passwords, so they share the
+	// login failure counters.
+	if err := s.checkThrottle(ctx, loginKeys(user.Email, meta)...); err != nil {
+		if errors.Is(err, ErrThrottled) {
+			s.audit(ctx, EventLoginThrottled, &user.ID, user.Email, meta)
+		}
+		return nil, err
+	}
+	if err := s.verifySecondFactor(s.db.WithContext(ctx), user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := s.loginFailed(ctx, EventMFAFailed, &user.ID, user.Email, meta); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+	s.clearThrottle(ctx, accountKey(user.Email))
+	now := time.Now()
+	s.db.WithContext(ctx).Model(&user).Update("last_login_at", &now)
+	return s.issueTokens(ctx, &user, nil, true, meta)
+}
+
+// completeLogin issues tokens for a user who proved their password, or an
+// MFA challenge when they also have a second factor. Failure counters are
+// only cleared once no factor is left to guess.
+func (s *Service) completeLogin(ctx context.Context, user *database.User, meta LoginMetadata) (*AuthResult, error) {
+	enabled, err := s.MFAEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		s.clearThrottle(ctx, accountKey(user.Email))
+		return s.issueTokens(ctx, user, nil, false, meta)
+	}
+	challenge, expiresAt, err := s.tokens.GenerateMFAToken(user.ID, mfaChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResult{User: user, MFAToken: challenge, MFAExpiresAt: expiresAt}, nil
+}
+
+// verifySecondFactor accepts a current authenticator code or an unused
+// recovery code, consuming either so it cannot be used again.
+func (s *Service) verifySecondFactor(db *gorm.DB, userID uuid.UUID, code string) error {
+	factor, err := s.factor(db, userID)
+	if err != nil {
+		return err
+	}
+	if factor == nil || factor.EnabledAt == nil {
+		return ErrMFANotEnabled
+	}
+	if step, err := s.checkTOTP(factor, code); err == nil {
+		res := db.Model(&database.MFAFactor{}).
+			Where("id = ? AND last_step < ?", factor.ID, step).
+			Update("last_step", step)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	res := db.Model(&database.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// checkTOTP validates code against the factor's secret and returns its time
+// step, refusing steps at or before the last one accepted.
+func (s *Service) checkTOTP(factor *database.MFAFactor, code string) (int64, error) {
+	secret, err := s.tokens.Open(factor.Secret)
+	if err != nil {
+		return 0, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), mfaSkew)
+	if !ok || step <= factor.LastStep {
+		return 0, ErrInvalidMFACode
+	}
+	return step, nil
+}
+
+func (s *Service) factor(db *gorm.DB, userID uuid.UUID) (*database.MFAFactor, error) {
+	var factor database.MFAFactor
+	if err := db.Where("user_id = ?", userID).First(&factor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &factor, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a fresh
+// set, returning them in plain text.
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&database.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]database.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = database.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7m2p-x9qrt" in an alphabet
+// without the easily misread i, l, o and u.
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	out := make([]byte, 0, len(buf)+1)
+	for i, b := range buf {
+		if i == len(buf)/2 {
+			out = append(out, '-')
+		}
+		out = append(out, recoveryAlphabet[b&31])
+	}
+	return string(out), nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed as
+// printed or not.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/token"
+	"github.com/3dprint-hub/api/internal/totp"
+)
+
+func TestCheckTOTP(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := &Service{tokens: token.New("test-secret", time.Minute, time.Hour, 32, logger)}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := s.tokens.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		ok       bool
+	}{
+		{"fresh code", code, step - 1, true},
+		{"never used", code, 0, true},
+		{"replayed step", code, step, false},
+		{"older than last accepted", code, step + 1, false},
+		{"wrong code", "not-a-code", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.checkTOTP(&database.MFAFactor{Secret: sealed, LastStep: tt.lastStep}, tt.code)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidMFACode) {
+					t.Fatalf("got %v, want ErrInvalidMFACode", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != step {
+				t.Errorf("step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := hashRecoveryCode("k7m2p-x9qrt")
+	for _, typed := range []string{"k7m2px9qrt", "K7M2P-X9QRT", " k7m2p x9qrt "} {
+		if got := hashRecoveryCode(typed); got != want {
+			t.Errorf("hashRecoveryCode(%q) differs from the printed code's", typed)
+		}
+	}
+	if hashRecoveryCode("k7m2p-x9qrv") == want {
+		t.Error("different codes hash alike")
+	}
+}
+
+// enableMFA turns two-factor authentication on for res's user and returns
+// the secret, the recovery codes and the new two-factor session.
+func enableMFA(t *testing.T, s *Service, res *AuthResult) (string, []string, *AuthResult) {
+	t.Helper()
+	ctx := context.Background()
+	enrolment, err := s.EnrollMFA(ctx, res.User.ID, uuid.Nil, "correct horse", LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(enrolment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, codes, err := s.ConfirmMFA(ctx, res.User.ID, code, LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enrolment.Secret, codes, session
+}
+
+func TestConfirmMFARevokesSessions(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	other, err := s.Login(ctx, res.User.Email, "correct horse", LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, session := enableMFA(t, s, res)
+
+	for name, old := range map[string]*AuthResult{"caller": res, "other": other} {
+		if _, err := s.Refresh(ctx, old.RefreshToken, LoginMetadata{}); !errors.Is(err, ErrTokenInvalid) {
+			t.Errorf("%s session refresh: got %v, want ErrTokenInvalid", name, err)
+		}
+		claims, err := s.tokens.ParseAccessToken(old.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := s.IsSessionRevoked(ctx, claims.SessionID); err != nil || !revoked {
+			t.Errorf("%s session access token: revoked = %v, %v", name, revoked, err)
+		}
+	}
+	if _, err := s.Refresh(ctx, session.RefreshToken, LoginMetadata{}); err != nil {
+		t.Errorf("new two-factor session: %v", err)
+	}
+}
+
+func TestSecondFactorReplay(t *testing.T) {
+	s := newTestService(t)
+	res := register(t, s)
+	secret, _, _ := enableMFA(t, s, res)
+	factor, err := s.factor(s.db, res.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := factor.LastStep
+
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verifySecondFactor(s.db, res.User.ID, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("code from enrolment: got %v, want ErrInvalidMFACode", err)
+	}
+
+	next, err := totp.Code(secret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verifySecondFactor(s.db, res.User.ID, next); err != nil {
+		t.Fatalf("next step's code: %v", err)
+	}
+	if err := s.verifySecondFactor(s.db, res.User.ID, next); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("replayed code: got %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestRecoveryCodeOneTimeUse(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	_, codes, _ := enableMFA(t, s, res)
+
+	if err := s.verifySecondFactor(s.db, res.User.ID, codes[0]); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := s.verifySecondFactor(s.db, res.User.ID, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("second use: got %v, want ErrInvalidMFACode", err)
+	}
+	typed := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+	if err := s.verifySecondFactor(s.db, res.User.ID, typed); err != nil {
+		t.Fatalf("code typed without dash: %v", err)
+	}
+
+	fresh, err := s.RegenerateRecoveryCodes(ctx, res.User.ID, true, codes[2], LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verifySecondFactor(s.db, res.User.ID, codes[3]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replaced code: got %v, want ErrInvalidMFACode", err)
+	}
+	if err := s.verifySecondFactor(s.db, res.User.ID, fresh[0]); err != nil {
+		t.Errorf("regenerated code: %v", err)
+	}
+}
+
+func TestMFAChangesNeedMFASession(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	if err := s.DisableMFA(ctx, res.User.ID, false, "any", LoginMetadata{}); !errors.Is(err, ErrMFANotEnabled) {
+		t.Fatalf("disable without a factor: got %v, want ErrMFANotEnabled", err)
+	}
+	_, codes, _ := enableMFA(t, s, res)
+
+	if err := s.DisableMFA(ctx, res.User.ID, false, codes[0], LoginMetadata{}); !errors.Is(err, ErrMFASessionRequired) {
+		t.Errorf("disable from a password session: got %v, want ErrMFASessionRequired", err)
+	}
+	if _, err := s.RegenerateRecoveryCodes(ctx, res.User.ID, false, codes[0], LoginMetadata{}); !errors.Is(err, ErrMFASessionRequired) {
+		t.Errorf("regenerate from a password session: got %v, want ErrMFASessionRequired", err)
+	}
+	refused, err := s.AuthEvents(ctx, AuthEventFilter{Kind: EventMFAChangeRefused, Email: res.User.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refused) != 2 {
+		t.Errorf("%d %s events, want 2", len(refused), EventMFAChangeRefused)
+	}
+	if err := s.DisableMFA(ctx, res.User.ID, true, codes[0], LoginMetadata{}); err != nil {
+		t.Fatalf("disable from a two-factor session: %v", err)
+	}
+	if enabled, err := s.MFAEnabled(ctx, res.User.ID); err != nil || enabled {
+		t.Errorf("MFAEnabled after disable = %v, %v", enabled, err)
+	}
+}
+
+func TestMFAChangesThrottled(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	_, codes, _ := enableMFA(t, s, res)
+
+	for i := 0; i < s.throttle.AccountThreshold; i++ {
+		if err := s.DisableMFA(ctx, res.User.ID, true, "not-a-code", LoginMetadata{}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: got %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+	if _, err := s.RegenerateRecoveryCodes(ctx, res.User.ID, true, codes[0], LoginMetadata{}); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("after %d wrong codes: got %v, want ErrThrottled", s.throttle.AccountThreshold, err)
+	}
+
+	failed, err := s.AuthEvents(ctx, AuthEventFilter{Kind: EventMFAFailed, Email: res.User.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != s.throttle.AccountThreshold {
+		t.Errorf("%d %s events, want %d", len(failed), EventMFAFailed, s.throttle.AccountThreshold)
+	}
+	throttled, err := s.AuthEvents(ctx, AuthEventFilter{Kind: EventLoginThrottled, Email: res.User.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(throttled) != 1 {
+		t.Errorf("%d %s events, want 1", len(throttled), EventLoginThrottled)
+	}
+}
+
+func TestConfirmMFAThrottled(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	enrolment, err := s.EnrollMFA(ctx, res.User.ID, uuid.Nil, "correct horse", LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < s.throttle.AccountThreshold; i++ {
+		if _, _, err := s.ConfirmMFA(ctx, res.User.ID, "000000", LoginMetadata{}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: got %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+	code, err := totp.Code(enrolment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ConfirmMFA(ctx, res.User.ID, code, LoginMetadata{}); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("after %d wrong codes: got %v, want ErrThrottled", s.throttle.AccountThreshold, err)
+	}
+	if enabled, err := s.MFAEnabled(ctx, res.User.ID); err != nil || enabled {
+		t.Errorf("MFAEnabled while throttled = %v, %v", enabled, err)
+	}
+}
+
+func TestEnrollMFANeedsReauthentication(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	if _, err := s.EnrollMFA(ctx, res.User.ID, uuid.Nil, "wrong horse", LoginMetadata{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if factor, err := s.factor(s.db, res.User.ID); err != nil || factor != nil {
+		t.Errorf("factor after wrong password = %v, %v", factor, err)
+	}
+
+	// accounts without a password need a fresh sign-in instead
+	social := database.User{Email: "test-" + uuid.NewString() + "@example.com", Role: "user"}
+	if err := s.db.Create(&social).Error; err != nil {
+		t.Fatal(err)
+	}
+	session, err := s.issueTokens(ctx, &social, nil, false, LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.tokens.ParseAccessToken(session.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.EnrollMFA(ctx, social.ID, uuid.Nil, "", LoginMetadata{}); !errors.Is(err, ErrRecentLoginRequired) {
+		t.Errorf("no session: got %v, want ErrRecentLoginRequired", err)
+	}
+	if err := s.db.Model(&database.RefreshToken{}).Where("id = ?", claims.SessionID).
+		Update("created_at", time.Now().Add(-2*recentLogin)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.EnrollMFA(ctx, social.ID, claims.SessionID, "", LoginMetadata{}); !errors.Is(err, ErrRecentLoginRequired) {
+		t.Errorf("stale session: got %v, want ErrRecentLoginRequired", err)
+	}
+	if err := s.db.Model(&database.RefreshToken{}).Where("id = ?", claims.SessionID).
+		Update("created_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.EnrollMFA(ctx, social.ID, claims.SessionID, "", LoginMetadata{}); err != nil {
+		t.Errorf("fresh session: %v", err)
+	}
+}
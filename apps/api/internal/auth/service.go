@@ -29,6 +29,20 @@ type Options struct {
 	Pricing    *pricing.Service
 	Storage    storage.Provider
 	SignerIDFn func() uuid.UUID
+	// Denylist makes revoked sessions' access tokens stop working at once,
+	// or within revokedReload on other instances, instead of when they
+	// expire.
+	Denylist bool
+	// Policy decides which actions need a verified email; VerifyTTL is how
+	// long verification links stay valid.
+	Policy    VerificationPolicy
+	VerifyTTL time.Duration
+	// MFAIssuer names the service in authenticator apps. MFARoles must sign
+	// in with a second factor to use role-restricted routes.
+	MFAIssuer string
+	MFARoles  []string
+	// Throttle limits failed logins and reset requests.
+	Throttle ThrottlePolicy
 }
 
 type Service struct {
@@ -40,14 +54,25 @@ type Service struct {
 	pricing  *pricing.Service
 	storage  storage.Provider
 	signerID func() uuid.UUID
+	denylist bool
+	policy   VerificationPolicy
+	emailTTL time.Duration
+	issuer   string
+	mfaRoles map[string]bool
+	throttle ThrottlePolicy
+	revoked  revokedSessions
 }
 
+// AuthResult carries either a token pair or, when the user has two-factor
+// authentication on, only an MFA challenge token for CompleteMFA.
 type AuthResult struct {
 	User             *database.User
 	AccessToken      string
 	RefreshToken     string
 	AccessExpiresAt  time.Time
 	RefreshExpiresAt time.Time
+	MFAToken         string
+	MFAExpiresAt     time.Time
 }
 
 type LoginMetadata struct {
@@ -59,13 +84,14 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrTokenInvalid       = errors.New("token invalid")
+	ErrTokenReused        = errors.New("refresh token reused; all sessions from that login were signed out")
 )
 
 func NewService(opts Options) *Service {
 	if opts.SignerIDFn == nil {
 		opts.SignerIDFn = uuid.New
 	}
-	return &Service{
+	svc := &Service{
 		db:       opts.DB,
 		logger:   opts.Logger,
 		tokens:   opts.TokenSvc,
@@ -74,7 +100,17 @@ func NewService(opts Options) *Service {
 		pricing:  opts.Pricing,
 		storage:  opts.Storage,
 		signerID: opts.SignerIDFn,
+		denylist: opts.Denylist,
+		policy:   opts.Policy,
+		emailTTL: opts.VerifyTTL,
+		issuer:   opts.MFAIssuer,
+		mfaRoles: make(map[string]bool, len(opts.MFARoles)),
+		throttle: opts.Throttle,
 	}
+	for _, role := range opts.MFARoles {
+		svc.mfaRoles[role] = true
+	}
+	return svc
 }
 
 func (s *Service) Register(ctx context.Context, email, password, name string, meta LoginMetadata) (*AuthResult, error) {
@@ -114,19 +150,31 @@ func (s *Service) Register(ctx context.Context, email, password, name string, me
 		return nil, err
 	}
 
-	res, err := s.issueTokens(ctx, user, nil, meta)
+	res, err := s.issueTokens(ctx, user, nil, false, meta)
 	if err != nil {
 		return nil, err
 	}
 	go s.safeSendWelcome(user.Email, user.Name)
+	go s.safeSendVerification(*user)
 	return res, nil
 }
 
+// Login checks a password. Failures count against both the email address and
+// the client IP, whether or not the account exists; see ThrottlePolicy.
 func (s *Service) Login(ctx context.Context, email, password string, meta LoginMetadata) (*AuthResult, error) {
 	email = normalizeEmail(email)
+	if err := s.checkThrottle(ctx, loginKeys(email, meta)...); err != nil {
+		if errors.Is(err, ErrThrottled) {
+			s.audit(ctx, EventLoginThrottled, nil, email, meta)
+		}
+		return nil, err
+	}
 	var user database.User
 	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := s.loginFailed(ctx, EventLoginFailed, nil, email, meta); err != nil {
+				return nil, err
+			}
 			return nil, ErrInvalidCredentials
 		}
 		return nil, err
@@ -135,34 +183,96 @@ func (s *Service) Login(ctx context.Context, email, password string, meta LoginM
 		return nil, errors.New("account uses social login")
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(*user.PasswordHash), []byte(password)); err != nil {
+		if err := s.loginFailed(ctx, EventLoginFailed, &user.ID, email, meta); err != nil {
+			return nil, err
+		}
 		return nil, ErrInvalidCredentials
 	}
 	now := time.Now()
 	s.db.Model(&user).Update("last_login_at", &now)
-	return s.issueTokens(ctx, &user, nil, meta)
+	return s.completeLogin(ctx, &user, meta)
 }
 
-func (s *Service) Refresh(ctx context.Context, userID uuid.UUID, refreshToken string, meta LoginMetadata) (*AuthResult, error) {
-	var tokenModel database.RefreshToken
-	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").First(&tokenModel).Error
+// Refresh exchanges a refresh token for a new pair. The token names its own
+// row, so each session rotates independently. Presenting a token that was
+// already rotated means it leaked or was replayed: the whole family is
+// revoked and every session descended from that login must sign in again.
+func (s *Service) Refresh(ctx context.Context, refreshToken string, meta LoginMetadata) (*AuthResult, error) {
+	id, secret, err := token.ParseRefreshToken(refreshToken)
 	if err != nil {
 		return nil, ErrTokenInvalid
 	}
-	if tokenModel.RevokedAt != nil || time.Now().After(tokenModel.ExpiresAt) {
+	var tokenModel database.RefreshToken
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&tokenModel).Error; err != nil {
 		return nil, ErrTokenInvalid
 	}
-	if err := s.tokens.VerifyRefreshToken(refreshToken, tokenModel.TokenHash); err != nil {
+	if err := s.tokens.VerifyRefreshToken(secret, tokenModel.TokenHash); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if tokenModel.RevokedAt != nil {
+		return nil, s.checkReuse(ctx, &tokenModel)
+	}
+	if time.Now().After(tokenModel.ExpiresAt) {
 		return nil, ErrTokenInvalid
 	}
 	var user database.User
-	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("id = ?", tokenModel.UserID).First(&user).Error; err != nil {
 		return nil, err
 	}
-	return s.issueTokens(ctx, &user, &tokenModel.ID, meta)
+	// Claim the token before issuing its successor so two concurrent
+	// refreshes cannot both rotate it.
+	res := s.db.WithContext(ctx).Model(&database.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", tokenModel.ID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, s.checkReuse(ctx, &tokenModel)
+	}
+	return s.issueTokens(ctx, &user, &tokenModel, tokenModel.MFA, meta)
 }
 
-func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+// checkReuse handles a revoked token being presented. If it was revoked by
+// rotation, its family is revoked too and ErrTokenReused is returned.
+func (s *Service) checkReuse(ctx context.Context, tokenModel *database.RefreshToken) error {
+	var rotations int64
+	if err := s.db.WithContext(ctx).Model(&database.RefreshToken{}).
+		Where("rotated_from_id = ?", tokenModel.ID).
+		Count(&rotations).Error; err != nil {
+		return err
+	}
+	if rotations == 0 {
+		return ErrTokenInvalid
+	}
+	family := familyOf(tokenModel)
+	if err := s.endSessions(ctx, tokenModel.UserID, []uuid.UUID{family}); err != nil {
+		return err
+	}
+	s.logger.Warn("refresh token reuse detected; family revoked", "user", tokenModel.UserID, "family", family)
+	return ErrTokenReused
+}
+
+func familyOf(tokenModel *database.RefreshToken) uuid.UUID {
+	if tokenModel.FamilyID != uuid.Nil {
+		return tokenModel.FamilyID
+	}
+	return tokenModel.ID
+}
+
+// ForgotPassword emails a reset link. Requests are limited per address,
+// whether or not it has an account, so the limit reveals nothing.
+func (s *Service) ForgotPassword(ctx context.Context, email string, meta LoginMetadata) error {
 	email = normalizeEmail(email)
+	if err := s.checkThrottle(ctx, resetKey(email)); err != nil {
+		if errors.Is(err, ErrThrottled) {
+			s.audit(ctx, EventResetThrottled, nil, email, meta)
+		}
+		return err
+	}
+	if _, err := s.countFailure(ctx, resetKey(email), s.throttle.reset()); err != nil {
+		return err
+	}
 	var user database.User
 	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -182,16 +292,29 @@ func (s *Service) ForgotPassword(ctx context.Context, email string) error {
 	return s.mailer.SendPasswordReset(ctx, user.Email, token)
 }
 
-func (s *Service) ResetPassword(ctx context.Context, token, newPassword string) (*AuthResult, error) {
+// ResetPassword sets a new password with an emailed reset token. Unknown,
+// used and expired tokens count as failures against the client IP.
+func (s *Service) ResetPassword(ctx context.Context, token, newPassword string, meta LoginMetadata) (*AuthResult, error) {
+	if meta.IP != "" {
+		if err := s.checkThrottle(ctx, ipKey(meta.IP)); err != nil {
+			if errors.Is(err, ErrThrottled) {
+				s.audit(ctx, EventResetThrottled, nil, "", meta)
+			}
+			return nil, err
+		}
+	}
 	var reset database.PasswordReset
 	if err := s.db.WithContext(ctx).
 		Where("token = ?", token).
 		Where("used_at IS NULL").
 		First(&reset).Error; err != nil {
-		return nil, ErrTokenInvalid
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, s.resetFailed(ctx, nil, meta)
 	}
 	if time.Now().After(reset.ExpiresAt) {
-		return nil, ErrTokenInvalid
+		return nil, s.resetFailed(ctx, &reset.UserID, meta)
 	}
 	var user database.User
 	if err := s.db.WithContext(ctx).Where("id = ?", reset.UserID).First(&user).Error; err != nil {
@@ -202,6 +325,7 @@ func (s *Service) ResetPassword(ctx context.Context, token, newPassword string)
 		return nil, err
 	}
 	now := time.Now()
+	var revoked revocation
 	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
 			return err
@@ -211,15 +335,18 @@ func (s *Service) ResetPassword(ctx context.Context, token, newPassword string)
 		}).Error; err != nil {
 			return err
 		}
-		// revoke existing refresh tokens
-		if err := tx.Model(&database.RefreshToken{}).Where("user_id = ?", user.ID).Update("revoked_at", now).Error; err != nil {
+		// sign out every existing session
+		sessions, err := activeSessionIDs(tx, user.ID)
+		if err != nil {
 			return err
 		}
-		return nil
+		revoked, err = s.revokeSessions(tx, user.ID, sessions)
+		return err
 	}); err != nil {
 		return nil, err
 	}
-	return s.issueTokens(ctx, &user, nil, LoginMetadata{})
+	s.deny(revoked)
+	return s.completeLogin(ctx, &user, meta)
 }
 
 func (s *Service) HandleOAuthCallback(ctx context.Context, provider, state, code string, meta LoginMetadata) (*AuthResult, error) {
@@ -297,15 +424,13 @@ func (s *Service) HandleOAuthCallback(ctx context.Context, provider, state, code
 	if newUser {
 		go s.safeSendWelcome(user.Email, user.Name)
 	}
-	return s.issueTokens(ctx, &user, nil, meta)
+	return s.completeLogin(ctx, &user, meta)
 }
 
-func (s *Service) issueTokens(ctx context.Context, user *database.User, rotatedFrom *uuid.UUID, meta LoginMetadata) (*AuthResult, error) {
-	access, accessExp, err := s.tokens.GenerateAccessToken(user.ID, user.Role)
-	if err != nil {
-		return nil, err
-	}
-	refreshPlain, refreshHash, refreshExp, err := s.tokens.GenerateRefreshToken()
+// issueTokens starts a new token family, or continues parent's when
+// rotating. mfa records whether the login passed a second factor.
+func (s *Service) issueTokens(ctx context.Context, user *database.User, parent *database.RefreshToken, mfa bool, meta LoginMetadata) (*AuthResult, error) {
+	refreshSecret, refreshHash, refreshExp, err := s.tokens.GenerateRefreshToken()
 	if err != nil {
 		return nil, err
 	}
@@ -315,23 +440,26 @@ func (s *Service) issueTokens(ctx context.Context, user *database.User, rotatedF
 		ExpiresAt: refreshExp,
 		LastIP:    meta.IP,
 		UserAgent: meta.UserAgent,
+		MFA:       mfa,
 	}
-	if rotatedFrom != nil {
-		refreshModel.RotatedFromID = rotatedFrom
+	refreshModel.ID = uuid.New()
+	refreshModel.FamilyID = refreshModel.ID
+	if parent != nil {
+		refreshModel.RotatedFromID = &parent.ID
+		refreshModel.FamilyID = familyOf(parent)
 	}
 	if err := s.db.WithContext(ctx).Create(&refreshModel).Error; err != nil {
 		return nil, err
 	}
-	if rotatedFrom != nil {
-		s.db.WithContext(ctx).Model(&database.RefreshToken{}).
-			Where("id = ?", *rotatedFrom).
-			Update("revoked_at", time.Now())
+	access, accessExp, err := s.tokens.GenerateAccessToken(user.ID, user.Role, refreshModel.FamilyID, mfa)
+	if err != nil {
+		return nil, err
 	}
 	return &AuthResult{
 		User:             user,
 		AccessToken:      access,
 		AccessExpiresAt:  accessExp,
-		RefreshToken:     refreshPlain,
+		RefreshToken:     token.FormatRefreshToken(refreshModel.ID, refreshSecret),
 		RefreshExpiresAt: refreshExp,
 	}, nil
 }
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/3dprint-hub/api/internal/config"
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/mailer"
+	"github.com/3dprint-hub/api/internal/token"
+)
+
+// newTestService returns a service backed by the Postgres database named by
+// TEST_POSTGRES_DSN, skipping the test when it is unset. Tests share the
+// database, so each works on users of its own.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	db, err := database.New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewService(Options{
+		DB:        db,
+		Logger:    logger,
+		TokenSvc:  token.New("test-secret", 15*time.Minute, 24*time.Hour, 32, logger),
+		Mailer:    mailer.New(&config.Config{}, logger),
+		Denylist:  true,
+		MFAIssuer: "test",
+		Throttle: ThrottlePolicy{
+			AccountThreshold: 5,
+			IPThreshold:      20,
+			BaseDelay:        time.Minute,
+			MaxDelay:         time.Hour,
+			Window:           time.Hour,
+			ResetLimit:       3,
+			ResetWindow:      time.Hour,
+		},
+	})
+}
+
+func register(t *testing.T, s *Service) *AuthResult {
+	t.Helper()
+	email := "test-" + uuid.NewString() + "@example.com"
+	res, err := s.Register(context.Background(), email, "correct horse", "Test", LoginMetadata{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestRefreshReuse(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	first := register(t, s)
+	other, err := s.Login(ctx, first.User.Email, "correct horse", LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.Refresh(ctx, first.RefreshToken, LoginMetadata{})
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if _, err := s.Refresh(ctx, first.RefreshToken, LoginMetadata{}); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("replayed token: got %v, want ErrTokenReused", err)
+	}
+	if _, err := s.Refresh(ctx, second.RefreshToken, LoginMetadata{}); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("successor after reuse: got %v, want ErrTokenInvalid", err)
+	}
+
+	claims, err := s.tokens.ParseAccessToken(second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := s.IsSessionRevoked(ctx, claims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Error("reused family's access tokens are not denylisted")
+	}
+
+	// Only the reused family is signed out.
+	if _, err := s.Refresh(ctx, other.RefreshToken, LoginMetadata{}); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+}
+
+func TestRefreshRevokedWithoutRotation(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	other, err := s.Login(ctx, res.User.Email, "correct horse", LoginMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Logout(ctx, res.User.ID, uuid.Nil, res.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refresh(ctx, res.RefreshToken, LoginMetadata{}); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("logged out token: got %v, want ErrTokenInvalid", err)
+	}
+	if _, err := s.Refresh(ctx, other.RefreshToken, LoginMetadata{}); err != nil {
+		t.Errorf("a logged out token that was never rotated is not reuse: %v", err)
+	}
+}
+
+func TestFamilyOf(t *testing.T) {
+	id, family := uuid.New(), uuid.New()
+	tests := []struct {
+		name  string
+		token database.RefreshToken
+		want  uuid.UUID
+	}{
+		{"rotated", database.RefreshToken{UUIDBase: database.UUIDBase{ID: id}, FamilyID: family}, family},
+		{"first of family", database.RefreshToken{UUIDBase: database.UUIDBase{ID: id}, FamilyID: id}, id},
+		{"before families", database.RefreshToken{UUIDBase: database.UUIDBase{ID: id}}, id},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := familyOf(&tt.token); got != tt.want {
+				t.Errorf("familyOf = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testIP returns a client address no other test run has used, so the
+// shared IP failure counters start from zero.
+func testIP() string {
+	id := uuid.New()
+	return fmt.Sprintf("2001:db8::%x:%x", id[0:2], id[2:4])
+}
+
+func TestResetPasswordBadTokens(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	meta := LoginMetadata{IP: testIP()}
+
+	for i := 0; i < s.throttle.IPThreshold; i++ {
+		if _, err := s.ResetPassword(ctx, uuid.NewString(), "new password", meta); !errors.Is(err, ErrTokenInvalid) {
+			t.Fatalf("guess %d: got %v, want ErrTokenInvalid", i+1, err)
+		}
+	}
+	if _, err := s.ResetPassword(ctx, uuid.NewString(), "new password", meta); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("after %d guesses: got %v, want ErrThrottled", s.throttle.IPThreshold, err)
+	}
+
+	failed, err := s.AuthEvents(ctx, AuthEventFilter{Kind: EventResetFailed, IP: meta.IP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != s.throttle.IPThreshold {
+		t.Errorf("%d %s events, want %d", len(failed), EventResetFailed, s.throttle.IPThreshold)
+	}
+	throttled, err := s.AuthEvents(ctx, AuthEventFilter{Kind: EventResetThrottled, IP: meta.IP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(throttled) != 1 {
+		t.Errorf("%d %s events, want 1", len(throttled), EventResetThrottled)
+	}
+}
+
+func TestResetPasswordExpiredToken(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	meta := LoginMetadata{IP: testIP()}
+	reset := database.PasswordReset{
+		UserID:    res.User.ID,
+		Token:     uuid.NewString(),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := s.db.Create(&reset).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ResetPassword(ctx, reset.Token, "new password", meta); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("expired token: got %v, want ErrTokenInvalid", err)
+	}
+	failed, err := s.AuthEvents(ctx, AuthEventFilter{Kind: EventResetFailed, IP: meta.IP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].UserID == nil || *failed[0].UserID != res.User.ID {
+		t.Errorf("%s events = %+v, want one for the token's user", EventResetFailed, failed)
+	}
+}
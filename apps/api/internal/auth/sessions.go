@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/token"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is one signed-in device: a refresh token family, described by its
+// current token. ID is the family ID, which access tokens carry as "sid".
+type Session struct {
+	ID         uuid.UUID
+	SignedInAt time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	LastIP     string
+	UserAgent  string
+	Current    bool
+}
+
+// Sessions lists the user's active sessions, most recently used first.
+// current marks the session of the caller's access token.
+func (s *Service) Sessions(ctx context.Context, userID, current uuid.UUID) ([]Session, error) {
+	var active []database.RefreshToken
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Find(&active).Error; err != nil {
+		return nil, err
+	}
+	families := make([]uuid.UUID, len(active))
+	for i := range active {
+		families[i] = familyOf(&active[i])
+	}
+	var roots []database.RefreshToken
+	if len(families) > 0 {
+		if err := s.db.WithContext(ctx).Select("id", "created_at").Where("id IN ?", families).Find(&roots).Error; err != nil {
+			return nil, err
+		}
+	}
+	signedIn := make(map[uuid.UUID]time.Time, len(roots))
+	for _, root := range roots {
+		signedIn[root.ID] = root.CreatedAt
+	}
+	sessions := make([]Session, len(active))
+	for i, t := range active {
+		session := Session{
+			ID:         families[i],
+			SignedInAt: t.CreatedAt,
+			LastUsedAt: t.CreatedAt,
+			ExpiresAt:  t.ExpiresAt,
+			LastIP:     t.LastIP,
+			UserAgent:  t.UserAgent,
+			Current:    families[i] == current,
+		}
+		if at, ok := signedIn[families[i]]; ok {
+			session.SignedInAt = at
+		}
+		sessions[i] = session
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+// Logout ends the session of the caller's access token. Access tokens issued
+// before sessions existed carry no session ID; for those the refresh token
+// names the session instead.
+func (s *Service) Logout(ctx context.Context, userID, sessionID uuid.UUID, refreshToken string) error {
+	if sessionID == uuid.Nil && refreshToken != "" {
+		id, secret, err := token.ParseRefreshToken(refreshToken)
+		if err != nil {
+			return ErrTokenInvalid
+		}
+		var tokenModel database.RefreshToken
+		if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&tokenModel).Error; err != nil {
+			return ErrTokenInvalid
+		}
+		if err := s.tokens.VerifyRefreshToken(secret, tokenModel.TokenHash); err != nil {
+			return ErrTokenInvalid
+		}
+		sessionID = familyOf(&tokenModel)
+	}
+	if sessionID == uuid.Nil {
+		return ErrSessionNotFound
+	}
+	return s.endSessions(ctx, userID, []uuid.UUID{sessionID})
+}
+
+// RevokeSession signs one of the user's sessions out.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	sessions, err := activeSessionIDs(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range sessions {
+		if id == sessionID {
+			return s.endSessions(ctx, userID, []uuid.UUID{sessionID})
+		}
+	}
+	return ErrSessionNotFound
+}
+
+// RevokeAllSessions signs the user out everywhere, except the session keep
+// when it is set. It returns how many sessions were ended.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID uuid.UUID, keep *uuid.UUID) (int, error) {
+	sessions, err := activeSessionIDs(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return 0, err
+	}
+	revoke := sessions[:0]
+	for _, id := range sessions {
+		if keep == nil || id != *keep {
+			revoke = append(revoke, id)
+		}
+	}
+	if err := s.endSessions(ctx, userID, revoke); err != nil {
+		return 0, err
+	}
+	return len(revoke), nil
+}
+
+// revokedReload is how often the denylist is reloaded from the database.
+// Sessions revoked by this instance are blocked at once; those revoked by
+// another are blocked within this long.
+const revokedReload = 10 * time.Second
+
+// revokedSessions caches the denylist, which only holds sessions revoked
+// within the last access token TTL, so checking a request needs no query.
+type revokedSessions struct {
+	mu        sync.RWMutex
+	until     map[uuid.UUID]time.Time
+	loadedAt  time.Time
+	reloading bool
+}
+
+// IsSessionRevoked reports whether access tokens for sessionID are
+// denylisted. One caller reloads a stale cache while the others keep
+// answering from it, which is no later than another instance's revocations
+// already show up.
+func (s *Service) IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	if !s.denylist || sessionID == uuid.Nil {
+		return false, nil
+	}
+	now := time.Now()
+	s.revoked.mu.Lock()
+	reload := !s.revoked.reloading && now.Sub(s.revoked.loadedAt) >= revokedReload
+	if reload {
+		s.revoked.reloading = true
+	}
+	s.revoked.mu.Unlock()
+	if reload {
+		if err := s.reloadRevoked(ctx, now); err != nil {
+			return false, err
+		}
+	}
+	s.revoked.mu.RLock()
+	defer s.revoked.mu.RUnlock()
+	until, ok := s.revoked.until[sessionID]
+	return ok && now.Before(until), nil
+}
+
+// reloadRevoked queries the denylist without holding the cache lock and
+// merges the result in.
+func (s *Service) reloadRevoked(ctx context.Context, now time.Time) error {
+	var entries []database.RevokedSession
+	err := s.db.WithContext(ctx).Select("session_id", "expires_at").
+		Where("expires_at > ?", now).
+		Find(&entries).Error
+	s.revoked.mu.Lock()
+	defer s.revoked.mu.Unlock()
+	s.revoked.reloading = false
+	if err != nil {
+		return err
+	}
+	// Merge rather than replace, so a session denied here after the query
+	// ran is not forgotten.
+	for id, until := range s.revoked.until {
+		if !now.Before(until) {
+			delete(s.revoked.until, id)
+		}
+	}
+	if s.revoked.until == nil {
+		s.revoked.until = make(map[uuid.UUID]time.Time, len(entries))
+	}
+	for _, e := range entries {
+		s.revoked.until[e.SessionID] = e.ExpiresAt
+	}
+	s.revoked.loadedAt = now
+	return nil
+}
+
+// denySessions adds sessions to the cached denylist until expiresAt.
+func (s *Service) denySessions(sessions []uuid.UUID, expiresAt time.Time) {
+	if len(sessions) == 0 {
+		return
+	}
+	s.revoked.mu.Lock()
+	defer s.revoked.mu.Unlock()
+	if s.revoked.until == nil {
+		s.revoked.until = make(map[uuid.UUID]time.Time, len(sessions))
+	}
+	for _, id := range sessions {
+		s.revoked.until[id] = expiresAt
+	}
+}
+
+// revocation is what revokeSessions denylisted. It goes into the cache with
+// deny once the rows are committed, so a rolled back revocation never
+// blocks a session.
+type revocation struct {
+	sessions []uuid.UUID
+	until    time.Time
+}
+
+func (s *Service) deny(r revocation) {
+	s.denySessions(r.sessions, r.until)
+}
+
+// endSessions revokes sessions outside any transaction and denies them at
+// once.
+func (s *Service) endSessions(ctx context.Context, userID uuid.UUID, sessions []uuid.UUID) error {
+	r, err := s.revokeSessions(s.db.WithContext(ctx), userID, sessions)
+	if err != nil {
+		return err
+	}
+	s.deny(r)
+	return nil
+}
+
+// revokeSessions revokes every token in the given families and, with the
+// denylist on, blocks their access tokens until the longest-lived one has
+// expired. Callers pass the result to deny after db has committed.
+func (s *Service) revokeSessions(db *gorm.DB, userID uuid.UUID, sessions []uuid.UUID) (revocation, error) {
+	if len(sessions) == 0 {
+		return revocation{}, nil
+	}
+	now := time.Now()
+	if err := db.Model(&database.RefreshToken{}).
+		Where("user_id = ? AND (family_id IN ? OR id IN ?) AND revoked_at IS NULL", userID, sessions, sessions).
+		Update("revoked_at", now).Error; err != nil {
+		return revocation{}, err
+	}
+	if !s.denylist {
+		return revocation{}, nil
+	}
+	expiresAt := now.Add(s.tokens.AccessTTL())
+	entries := make([]database.RevokedSession, len(sessions))
+	for i, id := range sessions {
+		entries[i] = database.RevokedSession{SessionID: id, UserID: userID, ExpiresAt: expiresAt}
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at", "updated_at"}),
+	}).Create(&entries).Error; err != nil {
+		return revocation{}, err
+	}
+	// Entries are only needed while tokens they block could still be valid.
+	if err := db.Where("expires_at <= ?", now).Delete(&database.RevokedSession{}).Error; err != nil {
+		return revocation{}, err
+	}
+	return revocation{sessions: sessions, until: expiresAt}, nil
+}
+
+// activeSessionIDs lists the families with an unrevoked, unexpired token.
+func activeSessionIDs(db *gorm.DB, userID uuid.UUID) ([]uuid.UUID, error) {
+	var active []database.RefreshToken
+	if err := db.Select("id", "family_id").
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Find(&active).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(active))
+	seen := make(map[uuid.UUID]bool, len(active))
+	for i := range active {
+		if id := familyOf(&active[i]); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestIsSessionRevokedCached(t *testing.T) {
+	// A fresh loadedAt keeps the check from reaching the (missing) database.
+	s := &Service{denylist: true}
+	s.revoked.loadedAt = time.Now()
+	revoked, expired, other := uuid.New(), uuid.New(), uuid.New()
+	s.denySessions([]uuid.UUID{revoked}, time.Now().Add(time.Minute))
+	s.denySessions([]uuid.UUID{expired}, time.Now().Add(-time.Second))
+
+	tests := []struct {
+		name    string
+		session uuid.UUID
+		want    bool
+	}{
+		{"revoked", revoked, true},
+		{"denylist entry expired", expired, false},
+		{"never revoked", other, false},
+		{"no session", uuid.Nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.IsSessionRevoked(context.Background(), tt.session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsSessionRevoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSessionRevokedDuringReload(t *testing.T) {
+	// Another caller is reloading a stale cache; this one answers from what
+	// is cached instead of waiting or querying the (missing) database.
+	s := &Service{denylist: true}
+	revoked := uuid.New()
+	s.denySessions([]uuid.UUID{revoked}, time.Now().Add(time.Minute))
+	s.revoked.reloading = true
+
+	got, err := s.IsSessionRevoked(context.Background(), revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got {
+		t.Error("IsSessionRevoked = false, want true")
+	}
+}
+
+func TestRevokeSessionsRolledBack(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	res := register(t, s)
+	claims, err := s.tokens.ParseAccessToken(res.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollback := errors.New("rollback")
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := s.revokeSessions(tx, res.User.ID, []uuid.UUID{claims.SessionID}); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("transaction error = %v, want rollback", err)
+	}
+	revoked, err := s.IsSessionRevoked(ctx, claims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Error("session denied by a revocation that was rolled back")
+	}
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+var ErrThrottled = errors.New("too many attempts, try again later")
+
+// ThrottledError is returned while a key is locked. It matches ErrThrottled.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string { return ErrThrottled.Error() }
+
+func (e *ThrottledError) Is(target error) bool { return target == ErrThrottled }
+
+// Audit event kinds.
+const (
+	EventLoginFailed      = "login_failed"
+	EventLoginThrottled   = "login_throttled"
+	EventLockedOut        = "locked_out"
+	EventMFAFailed        = "mfa_failed"
+	EventMFAChangeRefused = "mfa_change_refused"
+	EventResetThrottled   = "reset_throttled"
+	EventResetFailed      = "reset_failed"
+)
+
+// ThrottlePolicy limits guessing. Once an account or IP reaches its
+// threshold of failures, each further failure locks it for BaseDelay,
+// doubling up to MaxDelay. Failures are forgotten after Window without one.
+// A zero threshold or limit turns that check off.
+type ThrottlePolicy struct {
+	AccountThreshold int
+	IPThreshold      int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	Window           time.Duration
+	// ResetLimit is how many reset emails one address may request per
+	// ResetWindow.
+	ResetLimit  int
+	ResetWindow time.Duration
+}
+
+type throttleRule struct {
+	threshold int
+	base, max time.Duration
+	window    time.Duration
+}
+
+func (p ThrottlePolicy) account() throttleRule {
+	return throttleRule{threshold: p.AccountThreshold, base: p.BaseDelay, max: p.MaxDelay, window: p.Window}
+}
+
+func (p ThrottlePolicy) ip() throttleRule {
+	return throttleRule{threshold: p.IPThreshold, base: p.BaseDelay, max: p.MaxDelay, window: p.Window}
+}
+
+func (p ThrottlePolicy) reset() throttleRule {
+	return throttleRule{threshold: p.ResetLimit, base: p.ResetWindow, max: p.ResetWindow, window: p.ResetWindow}
+}
+
+// delay is how long the failures-th failure locks the key for.
+func (r throttleRule) delay(failures int) time.Duration {
+	if r.threshold <= 0 || failures < r.threshold {
+		return 0
+	}
+	delay := r.base
+	for i := r.threshold; i < failures && delay < r.max; i++ {
+		delay *= 2
+	}
+	return min(delay, r.max)
+}
+
+func accountKey(email string) string { return "login:email:" + email }
+func ipKey(ip string) string         { return "login:ip:" + ip }
+func resetKey(email string) string   { return "reset:email:" + email }
+
+// loginKeys are the keys a password or MFA attempt is counted against.
+func loginKeys(email string, meta LoginMetadata) []string {
+	keys := []string{accountKey(email)}
+	if meta.IP != "" {
+		keys = append(keys, ipKey(meta.IP))
+	}
+	return keys
+}
+
+// checkThrottle returns a ThrottledError if any of keys is locked.
+func (s *Service) checkThrottle(ctx context.Context, keys ...string) error {
+	var locked []database.AuthThrottle
+	if err := s.db.WithContext(ctx).
+		Where("key IN ? AND locked_until > ?", keys, time.Now()).
+		Find(&locked).Error; err != nil {
+		return err
+	}
+	var wait time.Duration
+	for _, t := range locked {
+		wait = max(wait, time.Until(*t.LockedUntil))
+	}
+	if wait <= 0 {
+		return nil
+	}
+	return &ThrottledError{RetryAfter: wait}
+}
+
+// countFailure adds a failure to key and locks it once rule says so. It
+// reports whether the key is now locked.
+func (s *Service) countFailure(ctx context.Context, key string, rule throttleRule) (bool, error) {
+	if rule.threshold <= 0 {
+		return false, nil
+	}
+	now := time.Now()
+	row := database.AuthThrottle{Key: key, Failures: 1, LastFailureAt: now}
+	if err := s.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"failures":        gorm.Expr("CASE WHEN auth_throttles.last_failure_at < ? THEN 1 ELSE auth_throttles.failures + 1 END", now.Add(-rule.window)),
+				"last_failure_at": now,
+				"updated_at":      now,
+			}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "failures"}}},
+	).Create(&row).Error; err != nil {
+		return false, err
+	}
+	delay := rule.delay(row.Failures)
+	if delay == 0 {
+		return false, nil
+	}
+	lockedUntil := now.Add(delay)
+	if err := s.db.WithContext(ctx).Model(&database.AuthThrottle{}).
+		Where("id = ?", row.ID).
+		Update("locked_until", lockedUntil).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Service) clearThrottle(ctx context.Context, key string) {
+	if err := s.db.WithContext(ctx).Where("key = ?", key).Delete(&database.AuthThrottle{}).Error; err != nil {
+		s.logger.Warn("failed to clear login failures", "error", err)
+	}
+}
+
+// loginFailed records a wrong password or MFA code against the account and
+// the client IP.
+func (s *Service) loginFailed(ctx context.Context, kind string, userID *uuid.UUID, email string, meta LoginMetadata) error {
+	s.audit(ctx, kind, userID, email, meta)
+	locked, err := s.countFailure(ctx, accountKey(email), s.throttle.account())
+	if err != nil {
+		return err
+	}
+	if locked {
+		s.audit(ctx, EventLockedOut, userID, email, meta)
+	}
+	if meta.IP == "" {
+		return nil
+	}
+	locked, err = s.countFailure(ctx, ipKey(meta.IP), s.throttle.ip())
+	if err != nil {
+		return err
+	}
+	if locked {
+		s.audit(ctx, EventLockedOut, nil, "", meta)
+	}
+	return nil
+}
+
+// resetFailed records an unknown or expired reset token against the client
+// IP and returns ErrTokenInvalid.
+func (s *Service) resetFailed(ctx context.Context, userID *uuid.UUID, meta LoginMetadata) error {
+	s.audit(ctx, EventResetFailed, userID, "", meta)
+	if meta.IP == "" {
+		return ErrTokenInvalid
+	}
+	locked, err := s.countFailure(ctx, ipKey(meta.IP), s.throttle.ip())
+	if err != nil {
+		return err
+	}
+	if locked {
+		s.audit(ctx, EventLockedOut, nil, "", meta)
+	}
+	return ErrTokenInvalid
+}
+
+// audit records an authentication event. A failure to write it is logged
+// rather than failing the request.
+func (s *Service) audit(ctx context.Context, kind string, userID *uuid.UUID, email string, meta LoginMetadata) {
+	event := database.AuthEvent{
+		Kind:      kind,
+		UserID:    userID,
+		Email:     email,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+	}
+	if err := s.db.WithContext(ctx).Create(&event).Error; err != nil {
+		s.logger.Warn("failed to record auth event", "kind", kind, "error", err)
+	}
+}
+
+// AuthEventFilter narrows AuthEvents; empty fields match everything.
+type AuthEventFilter struct {
+	Kind  string
+	Email string
+	IP    string
+	Limit int
+}
+
+// AuthEvents lists audit events, newest first.
+func (s *Service) AuthEvents(ctx context.Context, filter AuthEventFilter) ([]database.AuthEvent, error) {
+	query := s.db.WithContext(ctx).Order("created_at DESC")
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if filter.Email != "" {
+		query = query.Where("email = ?", normalizeEmail(filter.Email))
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 100
+	}
+	var events []database.AuthEvent
+	if err := query.Limit(filter.Limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
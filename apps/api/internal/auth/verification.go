@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+var (
+	ErrEmailNotVerified = errors.New("verify your email address first")
+	ErrAlreadyVerified  = errors.New("email address already verified")
+)
+
+// VerificationPolicy lists the actions that need a verified email address.
+type VerificationPolicy struct {
+	Checkout bool
+	// UploadLimitBytes is the largest upload allowed before verifying; zero
+	// means uploads of any size are allowed.
+	UploadLimitBytes int64
+}
+
+// RequiredForUpload reports whether an upload of size bytes needs a verified
+// email address.
+func (p VerificationPolicy) RequiredForUpload(size int64) bool {
+	return p.UploadLimitBytes > 0 && size > p.UploadLimitBytes
+}
+
+func (s *Service) Policy() VerificationPolicy {
+	return s.policy
+}
+
+// RequireVerified returns ErrEmailNotVerified unless the user has verified
+// their email address.
+func (s *Service) RequireVerified(ctx context.Context, userID uuid.UUID) error {
+	var user database.User
+	if err := s.db.WithContext(ctx).Select("id", "email_verified_at").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// SendVerification emails the user a new verification link.
+func (s *Service) SendVerification(ctx context.Context, userID uuid.UUID) error {
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// VerifyEmail marks the address in a verification token as verified.
+// Verifying twice is not an error.
+func (s *Service) VerifyEmail(ctx context.Context, token string) (*database.User, error) {
+	claims, err := s.tokens.ParseEmailToken(token)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if user.Email != claims.Email {
+		return nil, ErrTokenInvalid
+	}
+	if user.EmailVerifiedAt != nil {
+		return &user, nil
+	}
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(&user).Update("email_verified_at", now).Error; err != nil {
+		return nil, err
+	}
+	user.EmailVerifiedAt = &now
+	return &user, nil
+}
+
+func (s *Service) sendVerification(ctx context.Context, user database.User) error {
+	token, err := s.tokens.GenerateEmailToken(user.ID, user.Email, s.emailTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.SendVerification(ctx, user.Email, user.Name, token)
+}
+
+func (s *Service) safeSendVerification(user database.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.sendVerification(ctx, user); err != nil {
+		s.logger.Warn("failed to send verification email", "error", err)
+	}
+}
@@ -11,19 +11,50 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/jobs"
+	"github.com/3dprint-hub/api/internal/promotions"
+	"github.com/3dprint-hub/api/internal/shipping"
+)
+
+var (
+	ErrItemSource            = errors.New("cart item needs either a print job or a sku")
+	ErrCatalogUnavailable    = errors.New("catalog items are not available")
+	ErrPromotionsUnavailable = errors.New("promotion codes are not available")
 )
 
 type Service struct {
 	db     *gorm.DB
 	logger *slog.Logger
+	jobs   *jobs.Service
+	skus   SKUResolver
+	promos PromotionEvaluator
 }
 
-type ItemInput struct {
+// SKUResolver looks up a catalog item's current name and price.
+type SKUResolver interface {
+	ResolveSKU(ctx context.Context, sku string) (SKUItem, error)
+}
+
+// PromotionEvaluator checks a discount code against the cart and works out
+// what it takes off.
+type PromotionEvaluator interface {
+	Evaluate(ctx context.Context, userID uuid.UUID, code string, lines []promotions.Line, shippingCents int) (*promotions.Discount, error)
+}
+
+type SKUItem struct {
 	SKU            string
-	DisplayName    string
-	Quantity       int
+	Name           string
 	UnitPriceCents int
-	Metadata       map[string]any
+	WeightGrams    float64
+}
+
+// ItemInput names what to add. Exactly one of PrintJobID and SKU is set; the
+// name and price always come from the server.
+type ItemInput struct {
+	PrintJobID *uuid.UUID
+	SKU        string
+	Quantity   int
+	Metadata   map[string]any
 }
 
 type CartDTO struct {
@@ -32,10 +63,17 @@ type CartDTO struct {
 	Items     []CartItemDTO
 	Subtotal  int
 	UpdatedAt time.Time
+	// PromotionCode is the applied code. DiscountCents previews its effect
+	// on the items; free shipping only shows up at checkout. PromotionError
+	// says why the code no longer applies, if it doesn't.
+	PromotionCode  string
+	DiscountCents  int
+	PromotionError string
 }
 
 type CartItemDTO struct {
 	ID             uuid.UUID
+	PrintJobID     *uuid.UUID
 	SKU            string
 	DisplayName    string
 	Quantity       int
@@ -43,8 +81,69 @@ type CartItemDTO struct {
 	Metadata       map[string]any
 }
 
-func New(db *gorm.DB, logger *slog.Logger) *Service {
-	return &Service{db: db, logger: logger}
+// New builds the cart service. skus may be nil, in which case only print
+// jobs can be added; promos may be nil to disable discount codes.
+func New(db *gorm.DB, logger *slog.Logger, jobs *jobs.Service, skus SKUResolver, promos PromotionEvaluator) *Service {
+	return &Service{db: db, logger: logger, jobs: jobs, skus: skus, promos: promos}
+}
+
+// UnitPrice recomputes what one unit of a cart line costs right now.
+func (s *Service) UnitPrice(ctx context.Context, userID uuid.UUID, item database.CartItem) (int, error) {
+	_, price, err := s.resolve(ctx, userID, item.PrintJobID, item.SKU)
+	return price, err
+}
+
+// resolve returns the display name and unit price for a print job or SKU.
+func (s *Service) resolve(ctx context.Context, userID uuid.UUID, jobID *uuid.UUID, sku string) (string, int, error) {
+	switch {
+	case jobID != nil && sku == "":
+		job, price, err := s.jobs.Quote(ctx, jobs.Owner{UserID: userID}, *jobID)
+		if err != nil {
+			return "", 0, err
+		}
+		return job.FileName, price, nil
+	case jobID == nil && sku != "":
+		if s.skus == nil {
+			return "", 0, ErrCatalogUnavailable
+		}
+		item, err := s.skus.ResolveSKU(ctx, sku)
+		if err != nil {
+			return "", 0, err
+		}
+		return item.Name, item.UnitPriceCents, nil
+	}
+	return "", 0, ErrItemSource
+}
+
+// ShippingItems describes cart lines as parcel contents: print jobs by their
+// estimated weight and bounding box, catalog items by their listed weight.
+func (s *Service) ShippingItems(ctx context.Context, userID uuid.UUID, items []database.CartItem) ([]shipping.Item, error) {
+	out := make([]shipping.Item, 0, len(items))
+	for _, item := range items {
+		parcelItem := shipping.Item{Quantity: item.Quantity}
+		switch {
+		case item.PrintJobID != nil:
+			job, err := s.jobs.Get(ctx, jobs.Owner{UserID: userID}, *item.PrintJobID)
+			if err != nil {
+				return nil, err
+			}
+			bb := jobs.BoundingBox(job)
+			parcelItem.WeightGrams = job.EstimatedGrams
+			for i := range parcelItem.SizeMM {
+				parcelItem.SizeMM[i] = bb.Max[i] - bb.Min[i]
+			}
+		case s.skus != nil:
+			sku, err := s.skus.ResolveSKU(ctx, item.SKU)
+			if err != nil {
+				return nil, err
+			}
+			parcelItem.WeightGrams = sku.WeightGrams
+		default:
+			return nil, ErrCatalogUnavailable
+		}
+		out = append(out, parcelItem)
+	}
+	return out, nil
 }
 
 func (s *Service) GetByUser(ctx context.Context, userID uuid.UUID) (CartDTO, error) {
@@ -55,13 +154,55 @@ func (s *Service) GetByUser(ctx context.Context, userID uuid.UUID) (CartDTO, err
 		First(&cart).Error; err != nil {
 		return CartDTO{}, err
 	}
-	return toDTO(cart), nil
+	dto := toDTO(cart)
+	if cart.PromotionCode != "" && s.promos != nil {
+		discount, err := s.promos.Evaluate(ctx, userID, cart.PromotionCode, promotions.CartLines(cart.Items), 0)
+		if err != nil {
+			dto.PromotionError = err.Error()
+		} else {
+			dto.DiscountCents = discount.TotalCents
+		}
+	}
+	return dto, nil
+}
+
+// ApplyPromotion validates code against the current cart and keeps it for
+// checkout, where it is checked again.
+func (s *Service) ApplyPromotion(ctx context.Context, userID uuid.UUID, code string) (CartDTO, error) {
+	if s.promos == nil {
+		return CartDTO{}, ErrPromotionsUnavailable
+	}
+	var cart database.Cart
+	if err := s.db.WithContext(ctx).Preload("Items").Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		return CartDTO{}, err
+	}
+	discount, err := s.promos.Evaluate(ctx, userID, code, promotions.CartLines(cart.Items), 0)
+	if err != nil {
+		return CartDTO{}, err
+	}
+	if err := s.db.WithContext(ctx).Model(&cart).Update("promotion_code", discount.Promotion.Code).Error; err != nil {
+		return CartDTO{}, err
+	}
+	return s.GetByUser(ctx, userID)
+}
+
+func (s *Service) RemovePromotion(ctx context.Context, userID uuid.UUID) (CartDTO, error) {
+	if err := s.db.WithContext(ctx).Model(&database.Cart{}).
+		Where("user_id = ?", userID).
+		Update("promotion_code", "").Error; err != nil {
+		return CartDTO{}, err
+	}
+	return s.GetByUser(ctx, userID)
 }
 
 func (s *Service) AddItem(ctx context.Context, userID uuid.UUID, input ItemInput) (CartDTO, error) {
 	if input.Quantity <= 0 {
 		input.Quantity = 1
 	}
+	name, price, err := s.resolve(ctx, userID, input.PrintJobID, input.SKU)
+	if err != nil {
+		return CartDTO{}, err
+	}
 	tx := s.db.WithContext(ctx).Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -74,15 +215,22 @@ func (s *Service) AddItem(ctx context.Context, userID uuid.UUID, input ItemInput
 		return CartDTO{}, err
 	}
 	var item database.CartItem
-	err := tx.Where("cart_id = ? AND sku = ?", cart.ID, input.SKU).First(&item).Error
+	query := tx.Where("cart_id = ?", cart.ID)
+	if input.PrintJobID != nil {
+		query = query.Where("print_job_id = ?", *input.PrintJobID)
+	} else {
+		query = query.Where("sku = ? AND print_job_id IS NULL", input.SKU)
+	}
+	err = query.First(&item).Error
 	switch {
 	case errors.Is(err, gorm.ErrRecordNotFound):
 		item = database.CartItem{
 			CartID:         cart.ID,
+			PrintJobID:     input.PrintJobID,
 			SKU:            input.SKU,
-			DisplayName:    input.DisplayName,
+			DisplayName:    name,
 			Quantity:       input.Quantity,
-			UnitPriceCents: input.UnitPriceCents,
+			UnitPriceCents: price,
 			Metadata:       input.Metadata,
 		}
 		if err := tx.Create(&item).Error; err != nil {
@@ -94,10 +242,8 @@ func (s *Service) AddItem(ctx context.Context, userID uuid.UUID, input ItemInput
 		return CartDTO{}, err
 	default:
 		item.Quantity += input.Quantity
-		item.UnitPriceCents = input.UnitPriceCents
-		if input.DisplayName != "" {
-			item.DisplayName = input.DisplayName
-		}
+		item.UnitPriceCents = price
+		item.DisplayName = name
 		if input.Metadata != nil {
 			item.Metadata = input.Metadata
 		}
@@ -137,6 +283,7 @@ func toDTO(cart database.Cart) CartDTO {
 	for i, item := range cart.Items {
 		items[i] = CartItemDTO{
 			ID:             item.ID,
+			PrintJobID:     item.PrintJobID,
 			SKU:            item.SKU,
 			DisplayName:    item.DisplayName,
 			Quantity:       item.Quantity,
@@ -151,5 +298,7 @@ func toDTO(cart database.Cart) CartDTO {
 		Items:     items,
 		Subtotal:  subtotal,
 		UpdatedAt: cart.UpdatedAt,
+
+		PromotionCode: cart.PromotionCode,
 	}
 }
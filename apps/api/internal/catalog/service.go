@@ -0,0 +1,443 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/cart"
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+var (
+	ErrNotFound        = errors.New("product not found")
+	ErrVariantNotFound = errors.New("product variant not found")
+	ErrImageNotFound   = errors.New("product image not found")
+	ErrInvalidProduct  = errors.New("product name required")
+	ErrInvalidVariant  = errors.New("variant needs a sku and a non-negative price and stock")
+	ErrInvalidImage    = errors.New("image url required")
+	ErrSlugTaken       = errors.New("product slug already in use")
+	ErrSKUTaken        = errors.New("sku already in use")
+	ErrUnknownSKU      = errors.New("sku is not in the catalog")
+	ErrOutOfStock      = errors.New("not enough stock for sku")
+)
+
+type Service struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+type ListFilter struct {
+	Category string
+	// IncludeInactive also returns hidden products and variants, for admins.
+	IncludeInactive bool
+}
+
+type ProductInput struct {
+	Slug        string
+	Name        string
+	Description string
+	Category    string
+	Active      *bool
+}
+
+// VariantInput uses pointers for price and stock because zero is a valid
+// value for both.
+type VariantInput struct {
+	SKU         string
+	Name        string
+	PriceCents  *int
+	Stock       *int
+	WeightGrams float64
+	Active      *bool
+}
+
+type ImageInput struct {
+	URL      string
+	AltText  string
+	Position int
+}
+
+func New(db *gorm.DB, logger *slog.Logger) *Service {
+	return &Service{db: db, logger: logger}
+}
+
+func (s *Service) List(ctx context.Context, filter ListFilter) ([]database.Product, error) {
+	query := s.preload(s.db.WithContext(ctx), filter.IncludeInactive)
+	if !filter.IncludeInactive {
+		query = query.Where("active = ?", true)
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", normalizeCategory(filter.Category))
+	}
+	var products []database.Product
+	if err := query.Order("name ASC").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetBySlug returns an active product with its active variants.
+func (s *Service) GetBySlug(ctx context.Context, slug string) (*database.Product, error) {
+	var product database.Product
+	err := s.preload(s.db.WithContext(ctx), false).
+		Where("slug = ? AND active = ?", strings.ToLower(slug), true).
+		First(&product).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+// Get returns any product by id, including inactive variants.
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*database.Product, error) {
+	var product database.Product
+	if err := s.preload(s.db.WithContext(ctx), true).Where("id = ?", id).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (s *Service) preload(db *gorm.DB, includeInactive bool) *gorm.DB {
+	variants := func(db *gorm.DB) *gorm.DB {
+		if !includeInactive {
+			db = db.Where("active = ?", true)
+		}
+		return db.Order("price_cents ASC")
+	}
+	images := func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}
+	return db.Preload("Variants", variants).Preload("Images", images)
+}
+
+func (s *Service) Create(ctx context.Context, input ProductInput) (*database.Product, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, ErrInvalidProduct
+	}
+	slug := slugify(input.Slug)
+	if slug == "" {
+		slug = slugify(name)
+	}
+	if slug == "" {
+		return nil, ErrInvalidProduct
+	}
+	if err := s.checkSlug(ctx, slug, uuid.Nil); err != nil {
+		return nil, err
+	}
+	product := &database.Product{
+		Slug:        slug,
+		Name:        name,
+		Description: strings.TrimSpace(input.Description),
+		Category:    normalizeCategory(input.Category),
+		Active:      input.Active == nil || *input.Active,
+	}
+	if err := s.db.WithContext(ctx).Create(product).Error; err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// Update applies the non-zero fields of input.
+func (s *Service) Update(ctx context.Context, id uuid.UUID, input ProductInput) (*database.Product, error) {
+	product, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if slug := slugify(input.Slug); slug != "" && slug != product.Slug {
+		if err := s.checkSlug(ctx, slug, product.ID); err != nil {
+			return nil, err
+		}
+		product.Slug = slug
+	}
+	if name := strings.TrimSpace(input.Name); name != "" {
+		product.Name = name
+	}
+	if description := strings.TrimSpace(input.Description); description != "" {
+		product.Description = description
+	}
+	if category := normalizeCategory(input.Category); category != "" {
+		product.Category = category
+	}
+	if input.Active != nil {
+		product.Active = *input.Active
+	}
+	err = s.db.WithContext(ctx).Model(product).Updates(map[string]any{
+		"slug":        product.Slug,
+		"name":        product.Name,
+		"description": product.Description,
+		"category":    product.Category,
+		"active":      product.Active,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// Delete removes a product with its variants and images. Orders keep their
+// own copy of the SKU, name and price.
+func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&database.Product{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&database.ProductVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("product_id = ?", id).Delete(&database.ProductImage{}).Error
+	})
+}
+
+func (s *Service) CreateVariant(ctx context.Context, productID uuid.UUID, input VariantInput) (*database.ProductVariant, error) {
+	sku := normalizeSKU(input.SKU)
+	if sku == "" || input.PriceCents == nil || *input.PriceCents < 0 || (input.Stock != nil && *input.Stock < 0) || input.WeightGrams < 0 {
+		return nil, ErrInvalidVariant
+	}
+	if _, err := s.Get(ctx, productID); err != nil {
+		return nil, err
+	}
+	if err := s.checkSKU(ctx, sku, uuid.Nil); err != nil {
+		return nil, err
+	}
+	variant := &database.ProductVariant{
+		ProductID:   productID,
+		SKU:         sku,
+		Name:        strings.TrimSpace(input.Name),
+		PriceCents:  *input.PriceCents,
+		WeightGrams: input.WeightGrams,
+		Active:      input.Active == nil || *input.Active,
+	}
+	if input.Stock != nil {
+		variant.Stock = *input.Stock
+	}
+	if err := s.db.WithContext(ctx).Create(variant).Error; err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// UpdateVariant applies the set fields of input.
+func (s *Service) UpdateVariant(ctx context.Context, id uuid.UUID, input VariantInput) (*database.ProductVariant, error) {
+	if (input.PriceCents != nil && *input.PriceCents < 0) || (input.Stock != nil && *input.Stock < 0) || input.WeightGrams < 0 {
+		return nil, ErrInvalidVariant
+	}
+	var variant database.ProductVariant
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&variant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVariantNotFound
+		}
+		return nil, err
+	}
+	updates := variantChanges(input)
+	if sku, ok := updates["sku"].(string); ok {
+		if sku == variant.SKU {
+			delete(updates, "sku")
+		} else if err := s.checkSKU(ctx, sku, variant.ID); err != nil {
+			return nil, err
+		}
+	}
+	if len(updates) == 0 {
+		return &variant, nil
+	}
+	// Only the changed columns are written: stock moves under checkout
+	// between the read above and this update.
+	if err := s.db.WithContext(ctx).Model(&variant).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&variant).Error; err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// variantChanges maps the set fields of input to the columns they update.
+func variantChanges(input VariantInput) map[string]any {
+	updates := map[string]any{}
+	if sku := normalizeSKU(input.SKU); sku != "" {
+		updates["sku"] = sku
+	}
+	if name := strings.TrimSpace(input.Name); name != "" {
+		updates["name"] = name
+	}
+	if input.PriceCents != nil {
+		updates["price_cents"] = *input.PriceCents
+	}
+	if input.Stock != nil {
+		updates["stock"] = *input.Stock
+	}
+	if input.WeightGrams > 0 {
+		updates["weight_grams"] = input.WeightGrams
+	}
+	if input.Active != nil {
+		updates["active"] = *input.Active
+	}
+	return updates
+}
+
+func (s *Service) DeleteVariant(ctx context.Context, id uuid.UUID) error {
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&database.ProductVariant{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrVariantNotFound
+	}
+	return nil
+}
+
+func (s *Service) AddImage(ctx context.Context, productID uuid.UUID, input ImageInput) (*database.ProductImage, error) {
+	url := strings.TrimSpace(input.URL)
+	if url == "" {
+		return nil, ErrInvalidImage
+	}
+	if _, err := s.Get(ctx, productID); err != nil {
+		return nil, err
+	}
+	image := &database.ProductImage{
+		ProductID: productID,
+		URL:       url,
+		AltText:   strings.TrimSpace(input.AltText),
+		Position:  input.Position,
+	}
+	if err := s.db.WithContext(ctx).Create(image).Error; err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (s *Service) DeleteImage(ctx context.Context, id uuid.UUID) error {
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&database.ProductImage{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrImageNotFound
+	}
+	return nil
+}
+
+// ResolveSKU implements cart.SKUResolver. Only active variants of active
+// products with stock on hand can be bought.
+func (s *Service) ResolveSKU(ctx context.Context, sku string) (cart.SKUItem, error) {
+	var variant database.ProductVariant
+	err := s.db.WithContext(ctx).
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Where("product_variants.sku = ? AND product_variants.active = ? AND products.active = ?", normalizeSKU(sku), true, true).
+		First(&variant).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cart.SKUItem{}, ErrUnknownSKU
+		}
+		return cart.SKUItem{}, err
+	}
+	if variant.Stock <= 0 {
+		return cart.SKUItem{}, ErrOutOfStock
+	}
+	var product database.Product
+	if err := s.db.WithContext(ctx).Where("id = ?", variant.ProductID).First(&product).Error; err != nil {
+		return cart.SKUItem{}, err
+	}
+	name := product.Name
+	if variant.Name != "" {
+		name += " - " + variant.Name
+	}
+	return cart.SKUItem{
+		SKU:            variant.SKU,
+		Name:           name,
+		UnitPriceCents: variant.PriceCents,
+		WeightGrams:    variant.WeightGrams,
+	}, nil
+}
+
+// TakeStock decrements stock for a sold SKU inside the caller's transaction,
+// failing with ErrOutOfStock rather than going negative.
+func TakeStock(tx *gorm.DB, sku string, quantity int) error {
+	res := tx.Model(&database.ProductVariant{}).
+		Where("sku = ? AND stock >= ?", normalizeSKU(sku), quantity).
+		UpdateColumn("stock", gorm.Expr("stock - ?", quantity))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		return ErrOutOfStock
+	}
+	return nil
+}
+
+// ReturnStock puts stock back for a cancelled sale. SKUs removed from the
+// catalog since are skipped.
+func ReturnStock(tx *gorm.DB, sku string, quantity int) error {
+	return tx.Model(&database.ProductVariant{}).
+		Where("sku = ?", normalizeSKU(sku)).
+		UpdateColumn("stock", gorm.Expr("stock + ?", quantity)).Error
+}
+
+func (s *Service) checkSlug(ctx context.Context, slug string, self uuid.UUID) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&database.Product{}).
+		Where("slug = ? AND id <> ?", slug, self).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSlugTaken
+	}
+	return nil
+}
+
+func (s *Service) checkSKU(ctx context.Context, sku string, self uuid.UUID) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&database.ProductVariant{}).
+		Where("sku = ? AND id <> ?", sku, self).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSKUTaken
+	}
+	return nil
+}
+
+// slugify lowercases s and joins its letters and digits with single dashes.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+func normalizeSKU(sku string) string {
+	return strings.TrimSpace(sku)
+}
+
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
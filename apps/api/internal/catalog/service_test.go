@@ -0,0 +1,27 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariantChanges(t *testing.T) {
+	price, stock, active := 1299, 0, false
+	tests := []struct {
+		name  string
+		input VariantInput
+		want  map[string]any
+	}{
+		{"nothing set", VariantInput{}, map[string]any{}},
+		// stock is left to checkout unless the admin sets it
+		{"price only", VariantInput{PriceCents: &price}, map[string]any{"price_cents": 1299}},
+		{"name trimmed", VariantInput{Name: "  Large  "}, map[string]any{"name": "Large"}},
+		{"stock set to zero", VariantInput{Stock: &stock}, map[string]any{"stock": 0}},
+		{"deactivate", VariantInput{Active: &active}, map[string]any{"active": false}},
+	}
+	for _, tt := range tests {
+		if got := variantChanges(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: variantChanges = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// setEnv sets the variables Load requires, then the overrides; an empty
+// value unsets the variable for the test.
+func setEnv(t *testing.T, overrides map[string]string) {
+	t.Helper()
+	env := map[string]string{
+		"JWT_SECRET":             "test-secret",
+		"PAYMENT_PROVIDER":       "fake",
+		"PAYMENT_WEBHOOK_SECRET": "whsec_test",
+	}
+	for k, v := range overrides {
+		env[k] = v
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+}
+
+func TestLoadPayment(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "fake", env: nil},
+		{name: "fake checkout", env: map[string]string{"PAYMENT_FAKE_CHECKOUT": "true"}},
+		{name: "stripe", env: map[string]string{"PAYMENT_PROVIDER": "stripe", "STRIPE_SECRET_KEY": "sk_test"}},
+		{name: "no provider", env: map[string]string{"PAYMENT_PROVIDER": ""}, wantErr: "PAYMENT_PROVIDER is required"},
+		{name: "unknown provider", env: map[string]string{"PAYMENT_PROVIDER": "paypal"}, wantErr: "invalid PAYMENT_PROVIDER"},
+		{name: "no webhook secret", env: map[string]string{"PAYMENT_WEBHOOK_SECRET": ""}, wantErr: "PAYMENT_WEBHOOK_SECRET is required"},
+		{name: "stripe without key", env: map[string]string{"PAYMENT_PROVIDER": "stripe"}, wantErr: "STRIPE_SECRET_KEY is required"},
+		{name: "fake in production", env: map[string]string{"APP_ENV": "production"}, wantErr: "not allowed in production"},
+		{
+			name:    "fake checkout with stripe",
+			env:     map[string]string{"PAYMENT_PROVIDER": "stripe", "STRIPE_SECRET_KEY": "sk_test", "PAYMENT_FAKE_CHECKOUT": "true"},
+			wantErr: "PAYMENT_FAKE_CHECKOUT requires",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			_, err := Load()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Load() = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Load() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadLockout(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    [3]int // account, IP, reset
+		wantErr string
+	}{
+		{name: "defaults", want: [3]int{5, 20, 3}},
+		{
+			name: "set",
+			env:  map[string]string{"LOCKOUT_ACCOUNT_THRESHOLD": "10", "LOCKOUT_IP_THRESHOLD": "0", "LOCKOUT_RESET_LIMIT": "1"},
+			want: [3]int{10, 0, 1},
+		},
+		{name: "bad account threshold", env: map[string]string{"LOCKOUT_ACCOUNT_THRESHOLD": "five"}, wantErr: "invalid LOCKOUT_ACCOUNT_THRESHOLD"},
+		{name: "bad IP threshold", env: map[string]string{"LOCKOUT_IP_THRESHOLD": "20x"}, wantErr: "invalid LOCKOUT_IP_THRESHOLD"},
+		{name: "bad reset limit", env: map[string]string{"LOCKOUT_RESET_LIMIT": "3.5"}, wantErr: "invalid LOCKOUT_RESET_LIMIT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			got := [3]int{cfg.Lockout.AccountThreshold, cfg.Lockout.IPThreshold, cfg.Lockout.ResetLimit}
+			if got != tt.want {
+				t.Errorf("lockout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	setEnv(t, map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8, 192.0.2.10,2001:db8::/32"})
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.10/32", "2001:db8::/32"}
+	if len(cfg.TrustedProxies) != len(want) {
+		t.Fatalf("TrustedProxies = %v, want %v", cfg.TrustedProxies, want)
+	}
+	for i, prefix := range cfg.TrustedProxies {
+		if prefix.String() != want[i] {
+			t.Errorf("TrustedProxies[%d] = %s, want %s", i, prefix, want[i])
+		}
+	}
+
+	setEnv(t, map[string]string{"TRUSTED_PROXIES": "10.0.0.0/33"})
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "invalid TRUSTED_PROXIES") {
+		t.Errorf("Load() = %v, want error containing %q", err, "invalid TRUSTED_PROXIES")
+	}
+}
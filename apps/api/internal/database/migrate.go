@@ -11,7 +11,25 @@ func Migrate(ctx context.Context, db *gorm.DB) error {
 	if err := enableExtensions(ctx, db); err != nil {
 		return err
 	}
-	return db.WithContext(ctx).AutoMigrate(AllModels()...)
+	if err := db.WithContext(ctx).AutoMigrate(AllModels()...); err != nil {
+		return err
+	}
+	return seedCounters(ctx, db)
+}
+
+// InvoiceCounterName is the InvoiceCounter row that numbers invoices across
+// all orders.
+const InvoiceCounterName = "invoice"
+
+// seedCounters creates the invoice counter, starting from zero.
+func seedCounters(ctx context.Context, db *gorm.DB) error {
+	if err := db.WithContext(ctx).Exec(
+		"INSERT INTO invoice_counters (name, value) VALUES (?, 0) ON CONFLICT (name) DO NOTHING",
+		InvoiceCounterName,
+	).Error; err != nil {
+		return fmt.Errorf("seed counters: %w", err)
+	}
+	return nil
 }
 
 func enableExtensions(ctx context.Context, db *gorm.DB) error {
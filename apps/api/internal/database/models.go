@@ -22,13 +22,14 @@ func (u *UUIDBase) BeforeCreate(tx *gorm.DB) error {
 
 type User struct {
 	UUIDBase
-	Email        string  `gorm:"uniqueIndex"`
+	Email        string `gorm:"uniqueIndex"`
 	PasswordHash *string
 	Name         string
 	AvatarURL    *string
 	Role         string `gorm:"default:user"`
 
 	OAuthAccounts    []OAuthAccount
+	Addresses        []Address
 	RefreshTokens    []RefreshToken
 	Cart             Cart
 	Orders           []Order
@@ -68,18 +69,99 @@ type RefreshToken struct {
 	RevokedAt     *time.Time
 	LastIP        string
 	UserAgent     string
-	RotatedFromID *uuid.UUID `gorm:"type:uuid"`
+	RotatedFromID *uuid.UUID `gorm:"type:uuid;index"`
+
+	// FamilyID is the ID of the login's first token and is shared by every
+	// token rotated from it. Tokens issued before families existed have none
+	// and are their own family.
+	FamilyID uuid.UUID `gorm:"type:uuid;index"`
+	// MFA records that the family's login passed a second factor.
+	MFA bool
+}
+
+// MFAFactor is a user's TOTP authenticator. Secret is sealed with the
+// server key; the factor only counts once EnabledAt is set by a first valid
+// code. LastStep is the last accepted time step, so a code cannot be replayed.
+type MFAFactor struct {
+	UUIDBase
+	UserID    uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  int64
+}
+
+// RecoveryCode is a one-time fallback for a lost authenticator, stored as a
+// SHA-256 hash.
+type RecoveryCode struct {
+	UUIDBase
+	UserID   uuid.UUID `gorm:"type:uuid;index"`
+	CodeHash string    `gorm:"index"`
+	UsedAt   *time.Time
+}
+
+// RevokedSession denylists the access tokens of a signed-out session until
+// the last of them has expired.
+type RevokedSession struct {
+	UUIDBase
+	SessionID uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	UserID    uuid.UUID `gorm:"type:uuid;index"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// AuthThrottle counts recent failures for one key, such as an email address
+// or client IP, so limits hold across replicas. Failures restart from zero
+// once LastFailureAt is older than the policy window.
+type AuthThrottle struct {
+	UUIDBase
+	Key           string `gorm:"uniqueIndex"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time `gorm:"index"`
+}
+
+// AuthEvent is an audit record of a failed or refused authentication
+// attempt.
+type AuthEvent struct {
+	UUIDBase
+	Kind      string     `gorm:"index"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index"`
+	Email     string     `gorm:"index"`
+	IP        string     `gorm:"index"`
+	UserAgent string
+}
+
+// PostalAddress is the part of an address a parcel needs. Orders embed a copy
+// so editing a saved address does not rewrite past orders.
+type PostalAddress struct {
+	Name       string
+	Line1      string
+	Line2      string
+	City       string
+	Region     string
+	PostalCode string
+	Country    string
+	Phone      string
+}
+
+type Address struct {
+	UUIDBase
+	UserID uuid.UUID `gorm:"type:uuid;index"`
+	Label  string
+	PostalAddress
+	IsDefault bool
 }
 
 type Cart struct {
 	UUIDBase
-	UserID uuid.UUID `gorm:"type:uuid;uniqueIndex"`
-	Items  []CartItem
+	UserID        uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	Items         []CartItem
+	PromotionCode string
 }
 
 type CartItem struct {
 	UUIDBase
-	CartID         uuid.UUID `gorm:"type:uuid;index"`
+	CartID         uuid.UUID  `gorm:"type:uuid;index"`
+	PrintJobID     *uuid.UUID `gorm:"type:uuid;index"`
 	SKU            string
 	DisplayName    string
 	Quantity       int
@@ -98,59 +180,259 @@ type Order struct {
 	Notes         string
 	Items         []OrderItem
 	PrintJobs     []PrintJob `gorm:"foreignKey:OrderID"`
+	StatusEvents  []OrderStatusEvent
+	Payments      []Payment
 	PlacedAt      *time.Time
 	PaidAt        *time.Time
-	FulfilledAt   *time.Time
+	// ProductionStartedAt through RefundedAt are set by the matching status
+	// transition. FulfilledAt is set when the order ships.
+	ProductionStartedAt *time.Time
+	PrintedAt           *time.Time
+	FulfilledAt         *time.Time
+	DeliveredAt         *time.Time
+	CancelledAt         *time.Time
+	RefundedAt          *time.Time
+
+	// The tax rule applied at checkout, copied so later rule edits do not
+	// change what was charged.
+	TaxRuleID          *uuid.UUID `gorm:"type:uuid"`
+	TaxRuleName        string
+	TaxRateBasisPoints int
+	TaxInclusive       bool
+	TaxCountry         string
+	TaxRegion          string
+
+	ShippingCents   int
+	ShippingMethod  string
+	ShippingAddress PostalAddress `gorm:"embedded;embeddedPrefix:ship_"`
+	Carrier         string
+	TrackingNumber  string
+
+	// DiscountCents is the whole promotion discount, including any taken off
+	// shipping; item lines carry their own share.
+	DiscountCents int
+	PromotionID   *uuid.UUID `gorm:"type:uuid"`
+	PromotionCode string
+
+	// InvoiceNumber is assigned from InvoiceCounter when payment succeeds,
+	// so paid orders are numbered without gaps in the order they were paid.
+	InvoiceNumber string `gorm:"uniqueIndex:idx_orders_invoice_number,where:invoice_number <> ''"`
+	InvoicedAt    *time.Time
+}
+
+// OrderStatusEvent records one status change. ActorID is nil for changes made
+// by the system, such as payment webhooks.
+type OrderStatusEvent struct {
+	UUIDBase
+	OrderID    uuid.UUID `gorm:"type:uuid;index"`
+	FromStatus string
+	ToStatus   string
+	ActorID    *uuid.UUID `gorm:"type:uuid"`
+	ActorRole  string
+	Note       string
+}
+
+// Payment is one attempt to collect an order's total through the payment
+// provider. An order may have several if earlier attempts failed or expired.
+type Payment struct {
+	UUIDBase
+	OrderID          uuid.UUID `gorm:"type:uuid;index"`
+	Provider         string
+	ProviderIntentID string `gorm:"uniqueIndex"`
+	ClientSecret     string
+	AmountCents      int
+	Currency         string
+	Status           string `gorm:"index"`
+	FailureMessage   string
+	ExpiresAt        time.Time `gorm:"index"`
+	SucceededAt      *time.Time
+}
+
+// InvoiceCounter holds the last invoice number issued. Its row is locked for
+// the rest of the transaction that takes a number, so a rollback returns the
+// number instead of leaving a gap.
+type InvoiceCounter struct {
+	Name  string `gorm:"primaryKey"`
+	Value int64
+}
+
+// PaymentEvent is a webhook delivery. The unique provider event id makes
+// redelivered webhooks no-ops.
+type PaymentEvent struct {
+	UUIDBase
+	Provider        string
+	ProviderEventID string `gorm:"uniqueIndex"`
+	Type            string
+	PaymentID       *uuid.UUID `gorm:"type:uuid;index"`
+	Payload         string     `gorm:"type:jsonb"`
 }
 
 type OrderItem struct {
 	UUIDBase
-	OrderID        uuid.UUID `gorm:"type:uuid;index"`
+	OrderID        uuid.UUID  `gorm:"type:uuid;index"`
+	PrintJobID     *uuid.UUID `gorm:"type:uuid;index"`
+	SKU            string
 	Name           string
 	Description    string
 	Quantity       int
 	UnitPriceCents int
+	DiscountCents  int
 	Metadata       map[string]any `gorm:"type:jsonb"`
 }
 
 type PrintJob struct {
 	UUIDBase
-	UserID            uuid.UUID `gorm:"type:uuid;index"`
-	OrderID           *uuid.UUID `gorm:"type:uuid;index"`
-	OrderItemID       *uuid.UUID `gorm:"type:uuid;index"`
-	FileName          string
-	StoragePath       string
-	Material          string
-	Quality           string
-	EstimatedGrams    float64
-	EstimatedHours    float64
-	EstimatedPrice    int
-	Analysis          map[string]any `gorm:"type:jsonb"`
-	Status            string         `gorm:"index"`
-	LastEstimatedAt   time.Time
-	Source            string
-	OriginalExt       string
-	BoundingBoxMM     map[string]any `gorm:"type:jsonb"`
-	SurfaceAreaCM2    float64
-	VolumeCM3         float64
-	ThumbnailPath     *string
-	RequiresApproval  bool
-	ApprovalStatus    string
-	ApprovedBy        *uuid.UUID `gorm:"type:uuid"`
-	ApprovedAt        *time.Time
+	UserID           uuid.UUID  `gorm:"type:uuid;index"`
+	OrderID          *uuid.UUID `gorm:"type:uuid;index"`
+	OrderItemID      *uuid.UUID `gorm:"type:uuid;index"`
+	FileName         string
+	StoragePath      string
+	Material         string
+	Quality          string
+	EstimatedGrams   float64
+	EstimatedHours   float64
+	EstimatedPrice   int
+	Analysis         map[string]any `gorm:"type:jsonb"`
+	Status           string         `gorm:"index"`
+	LastEstimatedAt  time.Time
+	Source           string
+	OriginalExt      string
+	BoundingBoxMM    map[string]any `gorm:"type:jsonb"`
+	SurfaceAreaCM2   float64
+	VolumeCM3        float64
+	ThumbnailPath    *string
+	RequiresApproval bool
+	ApprovalStatus   string
+	ApprovedBy       *uuid.UUID `gorm:"type:uuid"`
+	ApprovedAt       *time.Time
+}
+
+type PrinterProfile struct {
+	UUIDBase
+	Name       string `gorm:"uniqueIndex"`
+	BuildXMM   float64
+	BuildYMM   float64
+	BuildZMM   float64
+	NozzleMM   float64
+	Materials  []string `gorm:"serializer:json"`
+	HourlyRate float64
+	Active     bool `gorm:"index"`
+}
+
+type Product struct {
+	UUIDBase
+	Slug        string `gorm:"uniqueIndex"`
+	Name        string
+	Description string
+	Category    string `gorm:"index"`
+	Active      bool   `gorm:"index"`
+	Variants    []ProductVariant
+	Images      []ProductImage
+}
+
+type ProductVariant struct {
+	UUIDBase
+	ProductID   uuid.UUID `gorm:"type:uuid;index"`
+	SKU         string    `gorm:"uniqueIndex"`
+	Name        string
+	PriceCents  int
+	Stock       int
+	WeightGrams float64
+	Active      bool
+}
+
+type ProductImage struct {
+	UUIDBase
+	ProductID uuid.UUID `gorm:"type:uuid;index"`
+	URL       string
+	AltText   string
+	Position  int
+}
+
+// TaxRule is the rate for a country, or for one region of it when Region is
+// set. Rates are in basis points: 825 is 8.25%.
+type TaxRule struct {
+	UUIDBase
+	Country         string `gorm:"uniqueIndex:idx_tax_rule_location"`
+	Region          string `gorm:"uniqueIndex:idx_tax_rule_location"`
+	Name            string
+	RateBasisPoints int
+	Inclusive       bool
+	Active          bool `gorm:"index"`
+}
+
+// ShippingRate prices parcels up to a weight and size limit. An empty
+// Country makes the rate available everywhere; zero limits mean no limit.
+type ShippingRate struct {
+	UUIDBase
+	Name           string
+	Carrier        string
+	Country        string `gorm:"index"`
+	MaxWeightGrams float64
+	MaxLengthMM    float64
+	BaseCents      int
+	PerKgCents     int
+	Active         bool `gorm:"index"`
+}
+
+// Promotion is a discount code. Kind is "percent" (PercentBasisPoints off
+// eligible items), "fixed" (AmountCents off eligible items) or
+// "free_shipping". Zero limits mean no limit; empty Materials means every
+// item is eligible.
+type Promotion struct {
+	UUIDBase
+	Code               string `gorm:"uniqueIndex"`
+	Description        string
+	Kind               string
+	PercentBasisPoints int
+	AmountCents        int
+	MinSubtotalCents   int
+	Materials          []string `gorm:"serializer:json"`
+	MaxRedemptions     int
+	MaxPerUser         int
+	RedemptionCount    int
+	StartsAt           *time.Time
+	ExpiresAt          *time.Time
+	Active             bool `gorm:"index"`
+}
+
+type PromotionRedemption struct {
+	UUIDBase
+	PromotionID   uuid.UUID `gorm:"type:uuid;index"`
+	UserID        uuid.UUID `gorm:"type:uuid;index"`
+	OrderID       uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	DiscountCents int
 }
 
 // AllModels returns every struct we need to migrate.
 func AllModels() []any {
 	return []any{
 		&User{},
+		&Address{},
 		&OAuthAccount{},
 		&PasswordReset{},
 		&RefreshToken{},
+		&RevokedSession{},
+		&AuthThrottle{},
+		&AuthEvent{},
+		&MFAFactor{},
+		&RecoveryCode{},
 		&Cart{},
 		&CartItem{},
 		&Order{},
 		&OrderItem{},
+		&OrderStatusEvent{},
+		&InvoiceCounter{},
+		&Payment{},
+		&PaymentEvent{},
 		&PrintJob{},
+		&PrinterProfile{},
+		&Product{},
+		&ProductVariant{},
+		&ProductImage{},
+		&TaxRule{},
+		&ShippingRate{},
+		&Promotion{},
+		&PromotionRedemption{},
 	}
 }
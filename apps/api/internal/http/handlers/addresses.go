@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/3dprint-hub/api/internal/address"
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+)
+
+type addressRequest struct {
+	Label      string `json:"label"`
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+	IsDefault  *bool  `json:"isDefault"`
+}
+
+func (req addressRequest) input() address.Input {
+	return address.Input{
+		Label:      req.Label,
+		Name:       req.Name,
+		Line1:      req.Line1,
+		Line2:      req.Line2,
+		City:       req.City,
+		Region:     req.Region,
+		PostalCode: req.PostalCode,
+		Country:    req.Country,
+		Phone:      req.Phone,
+		IsDefault:  req.IsDefault,
+	}
+}
+
+func writeAddressError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, address.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, address.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) ListAddresses(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	list, err := h.App.Addresses.List(r.Context(), user.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) CreateAddress(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req addressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	created, err := h.App.Addresses.Create(r.Context(), user.UserID, req.input())
+	if err != nil {
+		writeAddressError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	addressID, ok := urlID(w, r, "addressID", "address")
+	if !ok {
+		return
+	}
+	var req addressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	updated, err := h.App.Addresses.Update(r.Context(), user.UserID, addressID, req.input())
+	if err != nil {
+		writeAddressError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	addressID, ok := urlID(w, r, "addressID", "address")
+	if !ok {
+		return
+	}
+	if err := h.App.Addresses.Delete(r.Context(), user.UserID, addressID); err != nil {
+		writeAddressError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
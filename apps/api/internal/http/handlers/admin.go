@@ -2,14 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/order"
 )
 
+type shipmentRequest struct {
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"trackingNumber"`
+}
+
 type updateOrderStatusRequest struct {
 	Status string `json:"status"`
+	Note   string `json:"note"`
 }
 
 func (h *Handler) AdminListOrders(w http.ResponseWriter, r *http.Request) {
@@ -36,9 +46,45 @@ func (h *Handler) AdminUpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusBadRequest, "status required")
 		return
 	}
-	if err := h.App.Orders.UpdateStatus(r.Context(), orderID, req.Status); err != nil {
+	user, _ := httpmw.GetUser(r.Context())
+	updated, err := h.App.Orders.UpdateStatus(r.Context(), orderID, req.Status, order.Actor{UserID: &user.UserID, Role: user.Role}, req.Note)
+	switch {
+	case err == nil:
+	case errors.Is(err, order.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, order.ErrUnknownStatus):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, order.ErrIllegalTransition):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) AdminUpdateShipment(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := urlID(w, r, "orderID", "order")
+	if !ok {
+		return
+	}
+	var req shipmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	updated, err := h.App.Orders.SetShipment(r.Context(), orderID, req.Carrier, req.TrackingNumber)
+	switch {
+	case err == nil:
+	case errors.Is(err, order.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	default:
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	writeJSON(w, http.StatusOK, updated)
 }
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -25,7 +29,6 @@ type loginRequest struct {
 }
 
 type refreshRequest struct {
-	UserID       string `json:"userId"`
 	RefreshToken string `json:"refreshToken"`
 }
 
@@ -66,11 +69,13 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 	meta := h.loginMeta(r)
 	res, err := h.App.Auth.Login(r.Context(), req.Email, req.Password, meta)
-	switch err {
-	case nil:
-	case auth.ErrInvalidCredentials:
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrInvalidCredentials):
 		writeError(w, http.StatusUnauthorized, "invalid credentials")
 		return
+	case writeThrottled(w, err):
+		return
 	default:
 		writeError(w, http.StatusInternalServerError, "login failed")
 		return
@@ -84,14 +89,14 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	userID, err := uuid.Parse(req.UserID)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid user id")
-		return
-	}
 	meta := h.loginMeta(r)
-	res, err := h.App.Auth.Refresh(r.Context(), userID, req.RefreshToken, meta)
-	if err != nil {
+	res, err := h.App.Auth.Refresh(r.Context(), req.RefreshToken, meta)
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrTokenReused):
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	default:
 		writeError(w, http.StatusUnauthorized, "refresh failed")
 		return
 	}
@@ -104,8 +109,10 @@ func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	if err := h.App.Auth.ForgotPassword(r.Context(), req.Email); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to send email")
+	if err := h.App.Auth.ForgotPassword(r.Context(), req.Email, h.loginMeta(r)); err != nil {
+		if !writeThrottled(w, err) {
+			writeError(w, http.StatusInternalServerError, "failed to send email")
+		}
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
@@ -117,9 +124,11 @@ func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	res, err := h.App.Auth.ResetPassword(r.Context(), req.Token, req.NewPassword)
+	res, err := h.App.Auth.ResetPassword(r.Context(), req.Token, req.NewPassword, h.loginMeta(r))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "reset failed")
+		if !writeThrottled(w, err) {
+			writeError(w, http.StatusBadRequest, "reset failed")
+		}
 		return
 	}
 	writeJSON(w, http.StatusOK, h.authResponse(res))
@@ -175,6 +184,13 @@ func (h *Handler) loginMeta(r *http.Request) auth.LoginMetadata {
 }
 
 func (h *Handler) authResponse(res *auth.AuthResult) map[string]any {
+	if res.MFAToken != "" {
+		return map[string]any{
+			"mfaRequired":  true,
+			"mfaToken":     res.MFAToken,
+			"mfaExpiresAt": res.MFAExpiresAt,
+		}
+	}
 	return map[string]any{
 		"user":             sanitizeUser(*res.User),
 		"accessToken":      res.AccessToken,
@@ -184,13 +200,26 @@ func (h *Handler) authResponse(res *auth.AuthResult) map[string]any {
 	}
 }
 
+// writeThrottled answers 429 with Retry-After if err is a lockout and
+// reports whether it did.
+func writeThrottled(w http.ResponseWriter, err error) bool {
+	var throttled *auth.ThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, err.Error())
+	return true
+}
+
 func sanitizeUser(user database.User) map[string]any {
 	return map[string]any{
-		"id":        user.ID,
-		"email":     user.Email,
-		"name":      user.Name,
-		"role":      user.Role,
-		"avatarUrl": valueOrNil(user.AvatarURL),
+		"id":            user.ID,
+		"email":         user.Email,
+		"name":          user.Name,
+		"role":          user.Role,
+		"avatarUrl":     valueOrNil(user.AvatarURL),
+		"emailVerified": user.EmailVerifiedAt != nil,
 	}
 }
 
@@ -201,10 +230,182 @@ func valueOrNil[T any](p *T) any {
 	return *p
 }
 
+// clientIP is the address lockouts count against. It comes from
+// r.RemoteAddr, which httpmw.RealIP has already resolved through any trusted
+// proxies; headers the client sent are not read here.
 func clientIP(r *http.Request) string {
-	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-		parts := strings.Split(fwd, ",")
-		return strings.TrimSpace(parts[0])
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+type logoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req logoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	switch err := h.App.Auth.Logout(r.Context(), user.UserID, user.SessionID, req.RefreshToken); {
+	case err == nil:
+	case errors.Is(err, auth.ErrTokenInvalid),
+		errors.Is(err, auth.ErrSessionNotFound):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// LogoutAll ends every session of the user, or every other session with
+// {"keepCurrent": true}.
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req struct {
+		KeepCurrent bool `json:"keepCurrent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	var keep *uuid.UUID
+	if req.KeepCurrent && user.SessionID != uuid.Nil {
+		keep = &user.SessionID
+	}
+	revoked, err := h.App.Auth.RevokeAllSessions(r.Context(), user.UserID, keep)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "revoked": revoked})
+}
+
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	sessions, err := h.App.Auth.Sessions(r.Context(), user.UserID, user.SessionID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	sessionID, ok := urlID(w, r, "sessionID", "session")
+	if !ok {
+		return
+	}
+	switch err := h.App.Auth.RevokeSession(r.Context(), user.UserID, sessionID); {
+	case err == nil:
+	case errors.Is(err, auth.ErrSessionNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	user, err := h.App.Auth.VerifyEmail(r.Context(), req.Token)
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrTokenInvalid):
+		writeError(w, http.StatusBadRequest, "invalid or expired verification link")
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, sanitizeUser(*user))
+}
+
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	switch err := h.App.Auth.SendVerification(r.Context(), user.UserID); {
+	case err == nil:
+	case errors.Is(err, auth.ErrAlreadyVerified):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to send email")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// requireVerified writes a 403 and returns false unless the user has
+// verified their email address.
+func (h *Handler) requireVerified(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	switch err := h.App.Auth.RequireVerified(r.Context(), userID); {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+	return false
+}
+
+// AdminListAuthEvents lists failed and refused sign-in attempts, filtered by
+// ?kind=, ?email= and ?ip=, newest first; ?limit= caps the count (default
+// 100).
+func (h *Handler) AdminListAuthEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := auth.AuthEventFilter{
+		Kind:  query.Get("kind"),
+		Email: query.Get("email"),
+		IP:    query.Get("ip"),
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+	events, err := h.App.Auth.AuthEvents(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
-	return strings.Split(r.RemoteAddr, ":")[0]
+	writeJSON(w, http.StatusOK, events)
 }
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+)
+
+// TestClientIP checks the lockout key as the router computes it, through
+// httpmw.RealIP.
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "198.51.100.7:51234", nil, "198.51.100.7"},
+		{"spoofed by an untrusted peer", "198.51.100.7:51234", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"through a trusted proxy", "10.0.0.2:443", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoof behind a trusted proxy", "10.0.0.2:443", []string{"203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{"two trusted proxies", "10.0.0.2:443", []string{"203.0.113.9, 198.51.100.7", "10.0.0.3"}, "198.51.100.7"},
+		{"trusted proxy, garbage hop", "10.0.0.2:443", []string{"198.51.100.7, not-an-ip"}, "10.0.0.2"},
+		{"IPv6 peer", "[2001:db8::1]:51234", []string{"203.0.113.9"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := httpmw.RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, fwd := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", fwd)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,21 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
 	"github.com/3dprint-hub/api/internal/cart"
+	"github.com/3dprint-hub/api/internal/catalog"
 	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/jobs"
 )
 
 type addCartItemRequest struct {
-	SKU            string         `json:"sku"`
-	DisplayName    string         `json:"displayName"`
-	Quantity       int            `json:"quantity"`
-	UnitPriceCents int            `json:"unitPriceCents"`
-	Metadata       map[string]any `json:"metadata"`
+	PrintJobID *uuid.UUID     `json:"printJobId"`
+	SKU        string         `json:"sku"`
+	Quantity   int            `json:"quantity"`
+	Metadata   map[string]any `json:"metadata"`
+}
+
+// writeCartError maps errors from pricing a cart line to responses.
+func writeCartError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cart.ErrItemSource),
+		errors.Is(err, cart.ErrCatalogUnavailable),
+		isPricingInputError(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, jobs.ErrNotFound),
+		errors.Is(err, catalog.ErrUnknownSKU):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrAttached),
+		errors.Is(err, catalog.ErrOutOfStock):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
 }
 
 func (h *Handler) GetCart(w http.ResponseWriter, r *http.Request) {
@@ -45,14 +65,13 @@ func (h *Handler) AddCartItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	cartDTO, err := h.App.Cart.AddItem(r.Context(), user.UserID, cart.ItemInput{
-		SKU:            req.SKU,
-		DisplayName:    req.DisplayName,
-		Quantity:       req.Quantity,
-		UnitPriceCents: req.UnitPriceCents,
-		Metadata:       req.Metadata,
+		PrintJobID: req.PrintJobID,
+		SKU:        req.SKU,
+		Quantity:   req.Quantity,
+		Metadata:   req.Metadata,
 	})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeCartError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, cartDTO)
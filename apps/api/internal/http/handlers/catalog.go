@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/3dprint-hub/api/internal/catalog"
+)
+
+type productRequest struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Active      *bool  `json:"active"`
+}
+
+func (req productRequest) input() catalog.ProductInput {
+	return catalog.ProductInput{
+		Slug:        req.Slug,
+		Name:        req.Name,
+		Description: req.Description,
+		Category:    req.Category,
+		Active:      req.Active,
+	}
+}
+
+type variantRequest struct {
+	SKU         string  `json:"sku"`
+	Name        string  `json:"name"`
+	PriceCents  *int    `json:"priceCents"`
+	Stock       *int    `json:"stock"`
+	WeightGrams float64 `json:"weightGrams"`
+	Active      *bool   `json:"active"`
+}
+
+func (req variantRequest) input() catalog.VariantInput {
+	return catalog.VariantInput{
+		SKU:         req.SKU,
+		Name:        req.Name,
+		PriceCents:  req.PriceCents,
+		Stock:       req.Stock,
+		WeightGrams: req.WeightGrams,
+		Active:      req.Active,
+	}
+}
+
+type productImageRequest struct {
+	URL      string `json:"url"`
+	AltText  string `json:"altText"`
+	Position int    `json:"position"`
+}
+
+func writeCatalogError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, catalog.ErrNotFound),
+		errors.Is(err, catalog.ErrVariantNotFound),
+		errors.Is(err, catalog.ErrImageNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, catalog.ErrSlugTaken),
+		errors.Is(err, catalog.ErrSKUTaken):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, catalog.ErrInvalidProduct),
+		errors.Is(err, catalog.ErrInvalidVariant),
+		errors.Is(err, catalog.ErrInvalidImage):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// urlID parses a UUID URL parameter, writing a 400 naming what when it is
+// malformed.
+func urlID(w http.ResponseWriter, r *http.Request, param, what string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, param))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+what+" id")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	list, err := h.App.Catalog.List(r.Context(), catalog.ListFilter{Category: r.URL.Query().Get("category")})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	product, err := h.App.Catalog.GetBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (h *Handler) AdminListProducts(w http.ResponseWriter, r *http.Request) {
+	list, err := h.App.Catalog.List(r.Context(), catalog.ListFilter{
+		Category:        r.URL.Query().Get("category"),
+		IncludeInactive: true,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) AdminGetProduct(w http.ResponseWriter, r *http.Request) {
+	productID, ok := urlID(w, r, "productID", "product")
+	if !ok {
+		return
+	}
+	product, err := h.App.Catalog.Get(r.Context(), productID)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (h *Handler) AdminCreateProduct(w http.ResponseWriter, r *http.Request) {
+	var req productRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	product, err := h.App.Catalog.Create(r.Context(), req.input())
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, product)
+}
+
+func (h *Handler) AdminUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	productID, ok := urlID(w, r, "productID", "product")
+	if !ok {
+		return
+	}
+	var req productRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	product, err := h.App.Catalog.Update(r.Context(), productID, req.input())
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (h *Handler) AdminDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	productID, ok := urlID(w, r, "productID", "product")
+	if !ok {
+		return
+	}
+	if err := h.App.Catalog.Delete(r.Context(), productID); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) AdminCreateVariant(w http.ResponseWriter, r *http.Request) {
+	productID, ok := urlID(w, r, "productID", "product")
+	if !ok {
+		return
+	}
+	var req variantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	variant, err := h.App.Catalog.CreateVariant(r.Context(), productID, req.input())
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, variant)
+}
+
+func (h *Handler) AdminUpdateVariant(w http.ResponseWriter, r *http.Request) {
+	variantID, ok := urlID(w, r, "variantID", "variant")
+	if !ok {
+		return
+	}
+	var req variantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	variant, err := h.App.Catalog.UpdateVariant(r.Context(), variantID, req.input())
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, variant)
+}
+
+func (h *Handler) AdminDeleteVariant(w http.ResponseWriter, r *http.Request) {
+	variantID, ok := urlID(w, r, "variantID", "variant")
+	if !ok {
+		return
+	}
+	if err := h.App.Catalog.DeleteVariant(r.Context(), variantID); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) AdminAddProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, ok := urlID(w, r, "productID", "product")
+	if !ok {
+		return
+	}
+	var req productImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	image, err := h.App.Catalog.AddImage(r.Context(), productID, catalog.ImageInput{
+		URL:      req.URL,
+		AltText:  req.AltText,
+		Position: req.Position,
+	})
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, image)
+}
+
+func (h *Handler) AdminDeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	imageID, ok := urlID(w, r, "imageID", "image")
+	if !ok {
+		return
+	}
+	if err := h.App.Catalog.DeleteImage(r.Context(), imageID); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/3dprint-hub/api/internal/app"
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
 )
 
 type Handler struct {
@@ -15,6 +16,12 @@ func New(app *app.Application) *Handler {
 	return &Handler{App: app}
 }
 
+// actsAsAdmin reports whether user gets admin reach on a shared route, under
+// the same second-factor rule as the /admin routes.
+func (h *Handler) actsAsAdmin(user httpmw.UserContext) bool {
+	return user.ActsAsAdmin(h.App.Auth.MFARequired("admin"))
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
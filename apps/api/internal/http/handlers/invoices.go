@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/invoice"
+	"github.com/3dprint-hub/api/internal/order"
+)
+
+// GetOrderInvoice downloads the invoice for one of the user's orders as a
+// PDF, or as HTML with ?format=html.
+func (h *Handler) GetOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	orderID, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "html" {
+		writeError(w, http.StatusBadRequest, "format must be pdf or html")
+		return
+	}
+	placed, err := h.App.Orders.Get(r.Context(), user.UserID, orderID)
+	if err != nil {
+		if errors.Is(err, order.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := h.App.Invoices.Issue(r.Context(), placed); err != nil {
+		if errors.Is(err, invoice.ErrNotPaid) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	doc, err := h.App.Invoices.Document(r.Context(), placed)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var body []byte
+	if format == "html" {
+		if body, err = invoice.HTML(doc); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", invoice.Filename(doc, "html")))
+	} else {
+		body = invoice.PDF(doc)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Filename(doc, "pdf")))
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/jobs"
+	"github.com/3dprint-hub/api/internal/pricing"
+)
+
+type renameJobRequest struct {
+	FileName string `json:"fileName"`
+}
+
+type reestimateRequest struct {
+	Material string  `json:"material"`
+	Quality  string  `json:"quality"`
+	Infill   *int    `json:"infill"`
+	Units    string  `json:"units"`
+	Scale    float64 `json:"scale"`
+}
+
+var modelContentTypes = map[string]string{
+	".stl": "model/stl",
+	".obj": "model/obj",
+	".3mf": "model/3mf",
+}
+
+// jobRequest resolves the caller and the {jobID} URL parameter, writing the
+// error response itself when either is missing. Admins reach every job only
+// from a session that satisfies the admin two-factor rule.
+func (h *Handler) jobRequest(w http.ResponseWriter, r *http.Request) (jobs.Owner, uuid.UUID, bool) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return jobs.Owner{}, uuid.Nil, false
+	}
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job id")
+		return jobs.Owner{}, uuid.Nil, false
+	}
+	return jobs.Owner{UserID: user.UserID, Admin: h.actsAsAdmin(user)}, jobID, true
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrAttached):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, jobs.ErrInvalidName),
+		errors.Is(err, jobs.ErrExtensionChange),
+		isPricingInputError(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	list, err := h.App.Jobs.ListForUser(r.Context(), user.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	owner, jobID, ok := h.jobRequest(w, r)
+	if !ok {
+		return
+	}
+	job, err := h.App.Jobs.Get(r.Context(), owner, jobID)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) RenameJob(w http.ResponseWriter, r *http.Request) {
+	owner, jobID, ok := h.jobRequest(w, r)
+	if !ok {
+		return
+	}
+	var req renameJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	job, err := h.App.Jobs.Rename(r.Context(), owner, jobID, req.FileName)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	owner, jobID, ok := h.jobRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.App.Jobs.Delete(r.Context(), owner, jobID); err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) ReestimateJob(w http.ResponseWriter, r *http.Request) {
+	owner, jobID, ok := h.jobRequest(w, r)
+	if !ok {
+		return
+	}
+	var req reestimateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	job, estimate, err := h.App.Jobs.Reestimate(r.Context(), owner, jobID, pricing.EstimateInput{
+		Material: req.Material,
+		Quality:  req.Quality,
+		Infill:   req.Infill,
+		Units:    req.Units,
+		Scale:    req.Scale,
+	})
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"job":      job,
+		"estimate": estimate,
+	})
+}
+
+func (h *Handler) DownloadJobFile(w http.ResponseWriter, r *http.Request) {
+	owner, jobID, ok := h.jobRequest(w, r)
+	if !ok {
+		return
+	}
+	job, f, err := h.App.Jobs.Open(r.Context(), owner, jobID)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	contentType, ok := modelContentTypes[strings.ToLower(job.OriginalExt)]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": job.FileName}))
+	http.ServeContent(w, r, job.FileName, info.ModTime(), f)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/3dprint-hub/api/internal/auth"
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+)
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// mfaEnrolRequest carries the current password. Accounts without one send
+// an empty body and must have signed in recently instead.
+type mfaEnrolRequest struct {
+	Password string `json:"password"`
+}
+
+type mfaChallengeRequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+// CompleteMFA is the second step of a login that answered with
+// {"mfaRequired": true}. The code is an authenticator or recovery code.
+func (h *Handler) CompleteMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	res, err := h.App.Auth.CompleteMFA(r.Context(), req.MFAToken, req.Code, h.loginMeta(r))
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrTokenInvalid):
+		writeError(w, http.StatusUnauthorized, "invalid or expired challenge, sign in again")
+		return
+	case errors.Is(err, auth.ErrInvalidMFACode),
+		errors.Is(err, auth.ErrMFANotEnabled):
+		writeError(w, http.StatusUnauthorized, auth.ErrInvalidMFACode.Error())
+		return
+	case writeThrottled(w, err):
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, "login failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.authResponse(res))
+}
+
+func (h *Handler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req mfaEnrolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	enrolment, err := h.App.Auth.EnrollMFA(r.Context(), user.UserID, user.SessionID, req.Password, h.loginMeta(r))
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":     enrolment.Secret,
+		"otpauthUri": enrolment.URI,
+	})
+}
+
+// ConfirmMFA enables two-factor authentication. The response carries a new
+// token pair, since every other session is signed out, and the recovery
+// codes, which are not shown again.
+func (h *Handler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	res, codes, err := h.App.Auth.ConfirmMFA(r.Context(), user.UserID, req.Code, h.loginMeta(r))
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	body := h.authResponse(res)
+	body["recoveryCodes"] = codes
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (h *Handler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if err := h.App.Auth.DisableMFA(r.Context(), user.UserID, user.MFA, req.Code, h.loginMeta(r)); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	codes, err := h.App.Auth.RegenerateRecoveryCodes(r.Context(), user.UserID, user.MFA, req.Code, h.loginMeta(r))
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"recoveryCodes": codes})
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth.ErrMFAEnabled),
+		errors.Is(err, auth.ErrMFANotEnabled),
+		errors.Is(err, auth.ErrMFANotEnrolled):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrMFARoleRequired),
+		errors.Is(err, auth.ErrMFASessionRequired),
+		errors.Is(err, auth.ErrRecentLoginRequired):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, auth.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case writeThrottled(w, err):
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
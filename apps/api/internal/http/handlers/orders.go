@@ -2,17 +2,40 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
-	"github.com/3dprint-hub/api/internal/order"
+	"github.com/3dprint-hub/api/internal/address"
 	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/order"
+	"github.com/3dprint-hub/api/internal/shipping"
 )
 
 type checkoutRequest struct {
-	Notes string `json:"notes"`
+	Notes          string     `json:"notes"`
+	AddressID      *uuid.UUID `json:"addressId"`
+	ShippingRateID *uuid.UUID `json:"shippingRateId"`
+}
+
+// writeCheckoutError maps errors from turning the cart into an order.
+func writeCheckoutError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, order.ErrPricesChanged):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, order.ErrEmptyCart),
+		errors.Is(err, address.ErrNoAddress),
+		errors.Is(err, shipping.ErrNoRate),
+		errors.Is(err, shipping.ErrRateUnavailable),
+		isPromotionCodeError(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, address.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeCartError(w, err)
+	}
 }
 
 func (h *Handler) Checkout(w http.ResponseWriter, r *http.Request) {
@@ -21,17 +44,74 @@ func (h *Handler) Checkout(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "login required")
 		return
 	}
+	if h.App.Auth.Policy().Checkout && !h.requireVerified(w, r, user.UserID) {
+		return
+	}
 	var req checkoutRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err.Error() != "EOF" {
 		writeError(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	order, err := h.App.Orders.Checkout(r.Context(), user.UserID, order.CheckoutInput{Notes: req.Notes})
+	placed, err := h.App.Orders.Checkout(r.Context(), user.UserID, order.CheckoutInput{
+		Notes:          req.Notes,
+		AddressID:      req.AddressID,
+		ShippingRateID: req.ShippingRateID,
+	})
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeCheckoutError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, placed)
+}
+
+func (h *Handler) CartShippingOptions(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var addressID *uuid.UUID
+	if raw := r.URL.Query().Get("addressId"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid address id")
+			return
+		}
+		addressID = &id
+	}
+	quotes, err := h.App.Orders.ShippingOptions(r.Context(), user.UserID, addressID)
+	if err != nil {
+		writeCheckoutError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, quotes)
+}
+
+func (h *Handler) PayOrder(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	orderID, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+	payment, err := h.App.Orders.Pay(r.Context(), user.UserID, orderID)
+	switch {
+	case err == nil:
+	case errors.Is(err, order.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, order.ErrNotPayable):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
 		return
 	}
-	writeJSON(w, http.StatusCreated, order)
+	writeJSON(w, http.StatusOK, payment)
 }
 
 func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
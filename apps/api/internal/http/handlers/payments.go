@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/payment"
+)
+
+// maxWebhookBytes caps webhook bodies; provider events are a few kilobytes.
+const maxWebhookBytes = 1 << 20
+
+func (h *Handler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	switch err := h.App.Payments.HandleWebhook(r.Context(), payload, r.Header); {
+	case err == nil:
+	case errors.Is(err, payment.ErrInvalidSignature),
+		errors.Is(err, payment.ErrInvalidEvent):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// FakePaymentOutcome settles a fake-provider intent by feeding a signed event
+// through the real webhook path. Admins may settle any intent; customers only
+// their own, and only when PAYMENT_FAKE_CHECKOUT is on. SettleFake enforces
+// both, and answers 404 when the fake provider is not in use.
+func (h *Handler) FakePaymentOutcome(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	err := h.App.Payments.SettleFake(r.Context(), user.UserID, h.actsAsAdmin(user),
+		chi.URLParam(r, "intentID"), chi.URLParam(r, "outcome"))
+	switch {
+	case err == nil:
+	case errors.Is(err, payment.ErrUnknownIntent),
+		errors.Is(err, payment.ErrFakeDisabled):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, payment.ErrUnknownOutcome):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// AdminListPayments lists payments newest first, filtered by ?status=; use
+// needs_refund to find money collected for orders that could not be paid.
+func (h *Handler) AdminListPayments(w http.ResponseWriter, r *http.Request) {
+	payments, err := h.App.Payments.List(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, payments)
+}
@@ -1,12 +1,23 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 
-	"github.com/3dprint-hub/api/internal/jobs"
 	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/jobs"
+	"github.com/3dprint-hub/api/internal/pricing"
 )
 
+func (h *Handler) PricingOptions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"materials": h.App.Pricing.Materials(),
+		"qualities": h.App.Pricing.Qualities(),
+	})
+}
+
 func (h *Handler) EstimatePrice(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseMultipartForm(25 << 20); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid form data")
@@ -18,35 +29,72 @@ func (h *Handler) EstimatePrice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
-
-	estimate, data, err := h.App.Pricing.EstimateFromUpload(r.Context(), header)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	if userCtx, ok := httpmw.GetUser(r.Context()); ok && h.App.Auth.Policy().RequiredForUpload(header.Size) {
+		if !h.requireVerified(w, r, userCtx.UserID) {
+			return
+		}
 	}
 
-	material := r.FormValue("material")
-	if material == "" {
-		material = "PLA"
+	input := pricing.EstimateInput{
+		Material: r.FormValue("material"),
+		Quality:  r.FormValue("quality"),
+	}
+	input.Units = r.FormValue("units")
+	if v := r.FormValue("scale"); v != "" {
+		scale, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid scale")
+			return
+		}
+		input.Scale = scale
+	}
+	if v := r.FormValue("infill"); v != "" {
+		infill, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid infill")
+			return
+		}
+		input.Infill = &infill
 	}
-	quality := r.FormValue("quality")
-	if quality == "" {
-		quality = "standard"
+	estimate, err := h.App.Pricing.Estimate(r.Context(), header.Filename, file, header.Size, input)
+	switch {
+	case err == nil:
+	case isPricingInputError(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
+	// Signed-in customers keep the upload as a print job they can add to a
+	// cart later. The quote stands even if the job cannot be saved; JobID is
+	// then left unset.
 	if userCtx, ok := httpmw.GetUser(r.Context()); ok {
-		_, err := h.App.Jobs.Create(r.Context(), jobs.CreateInput{
+		job, err := h.App.Jobs.Create(r.Context(), jobs.CreateInput{
 			UserID:   userCtx.UserID,
 			FileName: header.Filename,
-			Data:     data,
+			File:     io.NewSectionReader(file, 0, header.Size),
 			Estimate: estimate,
-			Material: material,
-			Quality:  quality,
 		})
 		if err != nil {
 			h.App.Logger.Warn("failed to persist print job", "err", err)
+			estimate.Warnings = append(estimate.Warnings, "This upload could not be saved to your print jobs; upload it again to add it to your cart.")
+		} else {
+			estimate.JobID = &job.ID
 		}
 	}
 
 	writeJSON(w, http.StatusOK, estimate)
 }
+
+// isPricingInputError reports whether err rejects the customer's options
+// rather than signalling a server fault.
+func isPricingInputError(err error) bool {
+	return errors.Is(err, pricing.ErrUnknownMaterial) ||
+		errors.Is(err, pricing.ErrMaterialUnavailable) ||
+		errors.Is(err, pricing.ErrUnknownQuality) ||
+		errors.Is(err, pricing.ErrInvalidInfill) ||
+		errors.Is(err, pricing.ErrUnknownUnits) ||
+		errors.Is(err, pricing.ErrInvalidScale)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/3dprint-hub/api/internal/printers"
+)
+
+type printerRequest struct {
+	Name          string     `json:"name"`
+	BuildVolumeMM [3]float64 `json:"buildVolumeMm"`
+	NozzleMM      float64    `json:"nozzleMm"`
+	Materials     []string   `json:"materials"`
+	HourlyRate    float64    `json:"hourlyRate"`
+	Active        *bool      `json:"active"`
+}
+
+func (req printerRequest) input() printers.Input {
+	return printers.Input{
+		Name:          req.Name,
+		BuildVolumeMM: req.BuildVolumeMM,
+		NozzleMM:      req.NozzleMM,
+		Materials:     req.Materials,
+		HourlyRate:    req.HourlyRate,
+		Active:        req.Active,
+	}
+}
+
+func (h *Handler) AdminListPrinters(w http.ResponseWriter, r *http.Request) {
+	list, err := h.App.Printers.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) AdminCreatePrinter(w http.ResponseWriter, r *http.Request) {
+	var req printerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	profile, err := h.App.Printers.Create(r.Context(), req.input())
+	switch {
+	case err == nil:
+	case errors.Is(err, printers.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, profile)
+}
+
+func (h *Handler) AdminUpdatePrinter(w http.ResponseWriter, r *http.Request) {
+	printerID, err := uuid.Parse(chi.URLParam(r, "printerID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid printer id")
+		return
+	}
+	var req printerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	profile, err := h.App.Printers.Update(r.Context(), printerID, req.input())
+	switch {
+	case err == nil:
+	case errors.Is(err, printers.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+func (h *Handler) AdminDeletePrinter(w http.ResponseWriter, r *http.Request) {
+	printerID, err := uuid.Parse(chi.URLParam(r, "printerID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid printer id")
+		return
+	}
+	switch err := h.App.Printers.Delete(r.Context(), printerID); {
+	case err == nil:
+	case errors.Is(err, printers.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
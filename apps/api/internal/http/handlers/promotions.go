@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/3dprint-hub/api/internal/cart"
+	httpmw "github.com/3dprint-hub/api/internal/http/middleware"
+	"github.com/3dprint-hub/api/internal/promotions"
+)
+
+type promotionRequest struct {
+	Code               string     `json:"code"`
+	Description        string     `json:"description"`
+	Kind               string     `json:"kind"`
+	PercentBasisPoints *int       `json:"percentBasisPoints"`
+	AmountCents        *int       `json:"amountCents"`
+	MinSubtotalCents   *int       `json:"minSubtotalCents"`
+	Materials          []string   `json:"materials"`
+	MaxRedemptions     *int       `json:"maxRedemptions"`
+	MaxPerUser         *int       `json:"maxPerUser"`
+	StartsAt           *time.Time `json:"startsAt"`
+	ExpiresAt          *time.Time `json:"expiresAt"`
+	Active             *bool      `json:"active"`
+}
+
+func (req promotionRequest) input() promotions.Input {
+	return promotions.Input{
+		Code:               req.Code,
+		Description:        req.Description,
+		Kind:               req.Kind,
+		PercentBasisPoints: req.PercentBasisPoints,
+		AmountCents:        req.AmountCents,
+		MinSubtotalCents:   req.MinSubtotalCents,
+		Materials:          req.Materials,
+		MaxRedemptions:     req.MaxRedemptions,
+		MaxPerUser:         req.MaxPerUser,
+		StartsAt:           req.StartsAt,
+		ExpiresAt:          req.ExpiresAt,
+		Active:             req.Active,
+	}
+}
+
+// isPromotionCodeError reports whether err says why a code cannot be used
+// on the customer's cart.
+func isPromotionCodeError(err error) bool {
+	for _, target := range []error{
+		promotions.ErrInvalidCode,
+		promotions.ErrExpired,
+		promotions.ErrExhausted,
+		promotions.ErrUserLimit,
+		promotions.ErrMinimumSubtotal,
+		promotions.ErrNotEligible,
+		cart.ErrPromotionsUnavailable,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func writePromotionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, promotions.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, promotions.ErrInvalidInput),
+		isPromotionCodeError(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, promotions.ErrCodeTaken),
+		errors.Is(err, promotions.ErrRedeemed):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) ApplyCartPromotion(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	cartDTO, err := h.App.Cart.ApplyPromotion(r.Context(), user.UserID, req.Code)
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cartDTO)
+}
+
+func (h *Handler) RemoveCartPromotion(w http.ResponseWriter, r *http.Request) {
+	user, ok := httpmw.GetUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	cartDTO, err := h.App.Cart.RemovePromotion(r.Context(), user.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cartDTO)
+}
+
+func (h *Handler) AdminListPromotions(w http.ResponseWriter, r *http.Request) {
+	list, err := h.App.Promotions.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) AdminCreatePromotion(w http.ResponseWriter, r *http.Request) {
+	var req promotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	promotion, err := h.App.Promotions.Create(r.Context(), req.input())
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, promotion)
+}
+
+func (h *Handler) AdminUpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, ok := urlID(w, r, "promotionID", "promotion")
+	if !ok {
+		return
+	}
+	var req promotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	promotion, err := h.App.Promotions.Update(r.Context(), promotionID, req.input())
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, promotion)
+}
+
+func (h *Handler) AdminDeletePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, ok := urlID(w, r, "promotionID", "promotion")
+	if !ok {
+		return
+	}
+	if err := h.App.Promotions.Delete(r.Context(), promotionID); err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
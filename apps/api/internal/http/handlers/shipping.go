@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/3dprint-hub/api/internal/shipping"
+)
+
+type shippingRateRequest struct {
+	Name           string   `json:"name"`
+	Carrier        string   `json:"carrier"`
+	Country        string   `json:"country"`
+	MaxWeightGrams *float64 `json:"maxWeightGrams"`
+	MaxLengthMM    *float64 `json:"maxLengthMm"`
+	BaseCents      *int     `json:"baseCents"`
+	PerKgCents     *int     `json:"perKgCents"`
+	Active         *bool    `json:"active"`
+}
+
+func (req shippingRateRequest) input() shipping.RateInput {
+	return shipping.RateInput{
+		Name:           req.Name,
+		Carrier:        req.Carrier,
+		Country:        req.Country,
+		MaxWeightGrams: req.MaxWeightGrams,
+		MaxLengthMM:    req.MaxLengthMM,
+		BaseCents:      req.BaseCents,
+		PerKgCents:     req.PerKgCents,
+		Active:         req.Active,
+	}
+}
+
+func writeShippingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, shipping.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, shipping.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) AdminListShippingRates(w http.ResponseWriter, r *http.Request) {
+	list, err := h.App.Shipping.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) AdminCreateShippingRate(w http.ResponseWriter, r *http.Request) {
+	var req shippingRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	rate, err := h.App.Shipping.Create(r.Context(), req.input())
+	if err != nil {
+		writeShippingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rate)
+}
+
+func (h *Handler) AdminUpdateShippingRate(w http.ResponseWriter, r *http.Request) {
+	rateID, ok := urlID(w, r, "rateID", "shipping rate")
+	if !ok {
+		return
+	}
+	var req shippingRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	rate, err := h.App.Shipping.Update(r.Context(), rateID, req.input())
+	if err != nil {
+		writeShippingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rate)
+}
+
+func (h *Handler) AdminDeleteShippingRate(w http.ResponseWriter, r *http.Request) {
+	rateID, ok := urlID(w, r, "rateID", "shipping rate")
+	if !ok {
+		return
+	}
+	if err := h.App.Shipping.Delete(r.Context(), rateID); err != nil {
+		writeShippingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/3dprint-hub/api/internal/tax"
+)
+
+type taxRuleRequest struct {
+	Country         string `json:"country"`
+	Region          string `json:"region"`
+	Name            string `json:"name"`
+	RateBasisPoints *int   `json:"rateBasisPoints"`
+	Inclusive       *bool  `json:"inclusive"`
+	Active          *bool  `json:"active"`
+}
+
+func (req taxRuleRequest) input() tax.Input {
+	return tax.Input{
+		Country:         req.Country,
+		Region:          req.Region,
+		Name:            req.Name,
+		RateBasisPoints: req.RateBasisPoints,
+		Inclusive:       req.Inclusive,
+		Active:          req.Active,
+	}
+}
+
+func writeTaxError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tax.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, tax.ErrDuplicate):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, tax.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) AdminListTaxRules(w http.ResponseWriter, r *http.Request) {
+	list, err := h.App.Taxes.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) AdminCreateTaxRule(w http.ResponseWriter, r *http.Request) {
+	var req taxRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	rule, err := h.App.Taxes.Create(r.Context(), req.input())
+	if err != nil {
+		writeTaxError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (h *Handler) AdminUpdateTaxRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, ok := urlID(w, r, "ruleID", "tax rule")
+	if !ok {
+		return
+	}
+	var req taxRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	rule, err := h.App.Taxes.Update(r.Context(), ruleID, req.input())
+	if err != nil {
+		writeTaxError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) AdminDeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, ok := urlID(w, r, "ruleID", "tax rule")
+	if !ok {
+		return
+	}
+	if err := h.App.Taxes.Delete(r.Context(), ruleID); err != nil {
+		writeTaxError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -17,31 +17,80 @@ const userKey contextKey = "authUser"
 type UserContext struct {
 	UserID uuid.UUID
 	Role   string
+	// SessionID is the refresh token family the access token belongs to. It
+	// is uuid.Nil for tokens issued before sessions were tracked.
+	SessionID uuid.UUID
+	// MFA is set when the session was signed in with a second factor.
+	MFA bool
 }
 
-func WithAuth(next http.Handler, tokens *token.Service) http.Handler {
+// ActsAsAdmin reports whether the user may reach other users' records
+// outside the /admin routes. When admins must use a second factor the
+// session needs one, as RequireMFA asks of /admin.
+func (u UserContext) ActsAsAdmin(mfaRequired bool) bool {
+	return u.Role == "admin" && (u.MFA || !mfaRequired)
+}
+
+// Denylist reports sessions whose access tokens were revoked before they
+// expired.
+type Denylist interface {
+	IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error)
+}
+
+func WithAuth(next http.Handler, tokens *token.Service, denylist Denylist) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "missing Authorization header", http.StatusUnauthorized)
 			return
 		}
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			http.Error(w, "invalid Authorization header", http.StatusUnauthorized)
+		authenticate(w, r, authHeader, tokens, denylist, next)
+	})
+}
+
+// OptionalAuth attaches the user when a bearer token is sent and lets
+// requests without one through anonymously. A token that is sent but invalid
+// is still rejected, so clients learn to refresh it.
+func OptionalAuth(next http.Handler, tokens *token.Service, denylist Denylist) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
-		claims, err := tokens.ParseAccessToken(parts[1])
+		authenticate(w, r, authHeader, tokens, denylist, next)
+	})
+}
+
+func authenticate(w http.ResponseWriter, r *http.Request, authHeader string, tokens *token.Service, denylist Denylist, next http.Handler) {
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		http.Error(w, "invalid Authorization header", http.StatusUnauthorized)
+		return
+	}
+	claims, err := tokens.ParseAccessToken(parts[1])
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if denylist != nil {
+		revoked, err := denylist.IsSessionRevoked(r.Context(), claims.SessionID)
 		if err != nil {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			http.Error(w, "failed to check session", http.StatusInternalServerError)
 			return
 		}
-		ctx := context.WithValue(r.Context(), userKey, UserContext{
-			UserID: claims.UserID,
-			Role:   claims.Role,
-		})
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if revoked {
+			http.Error(w, "session revoked", http.StatusUnauthorized)
+			return
+		}
+	}
+	ctx := context.WithValue(r.Context(), userKey, UserContext{
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+		MFA:       claims.MFA,
 	})
+	next.ServeHTTP(w, r.WithContext(ctx))
 }
 
 func GetUser(ctx context.Context) (UserContext, bool) {
@@ -67,3 +116,19 @@ func RequireRole(role string, next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireMFA rejects sessions that did not sign in with a second factor.
+func RequireMFA(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := GetUser(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !user.MFA {
+			http.Error(w, "two-factor authentication required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import "testing"
+
+func TestActsAsAdmin(t *testing.T) {
+	tests := []struct {
+		name        string
+		user        UserContext
+		mfaRequired bool
+		want        bool
+	}{
+		{"admin, factor optional", UserContext{Role: "admin"}, false, true},
+		{"admin without factor, required", UserContext{Role: "admin"}, true, false},
+		{"admin with factor, required", UserContext{Role: "admin", MFA: true}, true, true},
+		{"user with factor", UserContext{Role: "user", MFA: true}, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.user.ActsAsAdmin(tt.mfaRequired); got != tt.want {
+			t.Errorf("%s: ActsAsAdmin = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
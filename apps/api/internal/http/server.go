@@ -18,7 +18,7 @@ func New(app *app.Application) http.Handler {
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	router.Use(httpmw.RealIP(app.Config.TrustedProxies))
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.Timeout(60 * time.Second))
@@ -41,31 +41,104 @@ func New(app *app.Application) http.Handler {
 		r.Post("/auth/refresh", h.Refresh)
 		r.Post("/auth/forgot-password", h.ForgotPassword)
 		r.Post("/auth/reset-password", h.ResetPassword)
+		r.Post("/auth/verify-email", h.VerifyEmail)
+		r.With(httprate.LimitByIP(10, time.Minute)).Post("/auth/mfa/challenge", h.CompleteMFA)
 		r.Get("/auth/oauth/{provider}/start", h.OAuthStart)
 		r.Get("/auth/oauth/{provider}/callback", h.OAuthCallback)
 
-		r.Post("/pricing/estimate", h.EstimatePrice)
+		r.Get("/pricing/options", h.PricingOptions)
+		r.With(func(next http.Handler) http.Handler {
+			return httpmw.OptionalAuth(next, app.Tokens, app.Auth)
+		}).Post("/pricing/estimate", h.EstimatePrice)
+
+		r.Post("/payments/webhook", h.PaymentWebhook)
+
+		r.Get("/catalog/products", h.ListProducts)
+		r.Get("/catalog/products/{slug}", h.GetProduct)
 
 		r.Group(func(protected chi.Router) {
 			protected.Use(func(next http.Handler) http.Handler {
-				return httpmw.WithAuth(next, app.Tokens)
+				return httpmw.WithAuth(next, app.Tokens, app.Auth)
 			})
 			protected.Get("/auth/me", h.Me)
+			protected.With(httprate.LimitByIP(5, time.Hour)).Post("/auth/verify-email/resend", h.ResendVerification)
+			protected.Post("/auth/logout", h.Logout)
+			protected.Post("/auth/logout-all", h.LogoutAll)
+			protected.Get("/auth/sessions", h.ListSessions)
+			protected.Delete("/auth/sessions/{sessionID}", h.RevokeSession)
+			protected.Post("/auth/mfa/enroll", h.EnrollMFA)
+			protected.Post("/auth/mfa/verify", h.ConfirmMFA)
+			protected.Post("/auth/mfa/disable", h.DisableMFA)
+			protected.Post("/auth/mfa/recovery-codes", h.RegenerateRecoveryCodes)
 
 			protected.Get("/cart", h.GetCart)
 			protected.Post("/cart/items", h.AddCartItem)
 			protected.Delete("/cart/items/{itemID}", h.RemoveCartItem)
+			protected.Get("/cart/shipping", h.CartShippingOptions)
+			protected.Post("/cart/promotion", h.ApplyCartPromotion)
+			protected.Delete("/cart/promotion", h.RemoveCartPromotion)
+
+			protected.Get("/addresses", h.ListAddresses)
+			protected.Post("/addresses", h.CreateAddress)
+			protected.Patch("/addresses/{addressID}", h.UpdateAddress)
+			protected.Delete("/addresses/{addressID}", h.DeleteAddress)
+
+			protected.Get("/jobs", h.ListJobs)
+			protected.Get("/jobs/{jobID}", h.GetJob)
+			protected.Patch("/jobs/{jobID}", h.RenameJob)
+			protected.Delete("/jobs/{jobID}", h.DeleteJob)
+			protected.Post("/jobs/{jobID}/estimate", h.ReestimateJob)
+			protected.Get("/jobs/{jobID}/file", h.DownloadJobFile)
 
 			protected.Post("/orders/checkout", h.Checkout)
 			protected.Get("/orders", h.ListOrders)
 			protected.Get("/orders/{orderID}", h.GetOrder)
+			protected.Post("/orders/{orderID}/payment", h.PayOrder)
+			protected.Get("/orders/{orderID}/invoice", h.GetOrderInvoice)
+			protected.Post("/payments/fake/{intentID}/{outcome}", h.FakePaymentOutcome)
 
 			protected.Route("/admin", func(admin chi.Router) {
 				admin.Use(func(next http.Handler) http.Handler {
 					return httpmw.RequireRole("admin", next)
 				})
+				if app.Auth.MFARequired("admin") {
+					admin.Use(httpmw.RequireMFA)
+				}
+				admin.Get("/auth-events", h.AdminListAuthEvents)
+				admin.Get("/payments", h.AdminListPayments)
 				admin.Get("/orders", h.AdminListOrders)
 				admin.Patch("/orders/{orderID}/status", h.AdminUpdateOrderStatus)
+				admin.Patch("/orders/{orderID}/shipment", h.AdminUpdateShipment)
+
+				admin.Get("/printers", h.AdminListPrinters)
+				admin.Post("/printers", h.AdminCreatePrinter)
+				admin.Patch("/printers/{printerID}", h.AdminUpdatePrinter)
+				admin.Delete("/printers/{printerID}", h.AdminDeletePrinter)
+
+				admin.Get("/shipping-rates", h.AdminListShippingRates)
+				admin.Post("/shipping-rates", h.AdminCreateShippingRate)
+				admin.Patch("/shipping-rates/{rateID}", h.AdminUpdateShippingRate)
+				admin.Delete("/shipping-rates/{rateID}", h.AdminDeleteShippingRate)
+				admin.Get("/promotions", h.AdminListPromotions)
+				admin.Post("/promotions", h.AdminCreatePromotion)
+				admin.Patch("/promotions/{promotionID}", h.AdminUpdatePromotion)
+				admin.Delete("/promotions/{promotionID}", h.AdminDeletePromotion)
+
+				admin.Get("/tax-rules", h.AdminListTaxRules)
+				admin.Post("/tax-rules", h.AdminCreateTaxRule)
+				admin.Patch("/tax-rules/{ruleID}", h.AdminUpdateTaxRule)
+				admin.Delete("/tax-rules/{ruleID}", h.AdminDeleteTaxRule)
+
+				admin.Get("/catalog/products", h.AdminListProducts)
+				admin.Post("/catalog/products", h.AdminCreateProduct)
+				admin.Get("/catalog/products/{productID}", h.AdminGetProduct)
+				admin.Patch("/catalog/products/{productID}", h.AdminUpdateProduct)
+				admin.Delete("/catalog/products/{productID}", h.AdminDeleteProduct)
+				admin.Post("/catalog/products/{productID}/variants", h.AdminCreateVariant)
+				admin.Patch("/catalog/variants/{variantID}", h.AdminUpdateVariant)
+				admin.Delete("/catalog/variants/{variantID}", h.AdminDeleteVariant)
+				admin.Post("/catalog/products/{productID}/images", h.AdminAddProductImage)
+				admin.Delete("/catalog/images/{imageID}", h.AdminDeleteProductImage)
 			})
 		})
 	})
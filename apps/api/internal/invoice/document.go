@@ -0,0 +1,149 @@
+package invoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+// Party is the issuer or the customer as printed on an invoice.
+type Party struct {
+	Name    string
+	Address []string
+	Email   string
+	TaxID   string
+}
+
+// Document is everything an invoice shows, independent of its format.
+type Document struct {
+	Number   string
+	IssuedAt time.Time
+	OrderID  uuid.UUID
+	Status   string
+	PaidAt   *time.Time
+	Currency string
+	Issuer   Party
+	Customer Party
+	Lines    []Line
+
+	SubtotalCents  int
+	DiscountCents  int
+	PromotionCode  string
+	ShippingCents  int
+	ShippingMethod string
+	TaxCents       int
+	TaxLabel       string
+	TaxInclusive   bool
+	TotalCents     int
+}
+
+type Line struct {
+	Description    string
+	SKU            string
+	Quantity       int
+	UnitPriceCents int
+	AmountCents    int
+}
+
+// NewDocument lays out order as an invoice from issuer to the customer with
+// email. The order's items must be loaded.
+func NewDocument(order *database.Order, issuer Party, email string) Document {
+	doc := Document{
+		Number:   order.InvoiceNumber,
+		OrderID:  order.ID,
+		Status:   order.Status,
+		PaidAt:   order.PaidAt,
+		Currency: order.Currency,
+		Issuer:   issuer,
+		Customer: Party{
+			Name:    order.ShippingAddress.Name,
+			Address: addressLines(order.ShippingAddress),
+			Email:   email,
+		},
+		SubtotalCents:  order.SubtotalCents,
+		DiscountCents:  order.DiscountCents,
+		PromotionCode:  order.PromotionCode,
+		ShippingCents:  order.ShippingCents,
+		ShippingMethod: order.ShippingMethod,
+		TaxCents:       order.TaxCents,
+		TaxLabel:       taxLabel(order),
+		TaxInclusive:   order.TaxInclusive,
+		TotalCents:     order.TotalCents,
+	}
+	switch {
+	case order.InvoicedAt != nil:
+		doc.IssuedAt = *order.InvoicedAt
+	case order.PlacedAt != nil:
+		doc.IssuedAt = *order.PlacedAt
+	default:
+		doc.IssuedAt = order.CreatedAt
+	}
+	for _, item := range order.Items {
+		doc.Lines = append(doc.Lines, Line{
+			Description:    item.Name,
+			SKU:            item.SKU,
+			Quantity:       item.Quantity,
+			UnitPriceCents: item.UnitPriceCents,
+			AmountCents:    item.Quantity * item.UnitPriceCents,
+		})
+	}
+	return doc
+}
+
+// PaymentStatus is the one-line payment state shown under the invoice
+// number.
+func (d Document) PaymentStatus() string {
+	switch {
+	case d.Status == "refunded":
+		return "Refunded"
+	case d.Status == "cancelled":
+		return "Cancelled"
+	case d.PaidAt != nil:
+		return "Paid " + d.PaidAt.Format("2006-01-02")
+	}
+	return "Amount due"
+}
+
+// Money formats cents in the document's currency, e.g. "12.34 USD".
+func (d Document) Money(cents int) string {
+	return formatCents(cents, d.Currency)
+}
+
+func formatCents(cents int, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, cents/100, cents%100, currency)
+}
+
+func addressLines(a database.PostalAddress) []string {
+	var lines []string
+	for _, line := range []string{
+		a.Line1,
+		a.Line2,
+		strings.TrimSpace(strings.Join([]string{a.PostalCode, a.City, a.Region}, " ")),
+		a.Country,
+	} {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func taxLabel(order *database.Order) string {
+	name := order.TaxRuleName
+	if name == "" {
+		name = "Tax"
+	}
+	rate := fmt.Sprintf("%d.%02d%%", order.TaxRateBasisPoints/100, order.TaxRateBasisPoints%100)
+	if order.TaxInclusive {
+		return fmt.Sprintf("%s %s (included)", name, rate)
+	}
+	return fmt.Sprintf("%s %s", name, rate)
+}
@@ -0,0 +1,85 @@
+package invoice
+
+import (
+	"bytes"
+	"html/template"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 800px; margin: 40px auto; font-size: 14px; }
+header { display: flex; justify-content: space-between; }
+h1 { margin: 0 0 8px; font-size: 24px; }
+.meta, .num { text-align: right; }
+.muted { color: #666; }
+table { width: 100%; border-collapse: collapse; margin-top: 24px; }
+th { text-align: left; border-bottom: 1px solid #222; padding: 6px 0; }
+td { padding: 6px 0; }
+th.num { text-align: right; }
+tfoot td { border-top: 1px solid #ddd; }
+tr.total td { font-weight: bold; font-size: 16px; border-top: 1px solid #222; }
+</style>
+</head>
+<body>
+<header>
+  <div>
+    <h1>{{.Issuer.Name}}</h1>
+    {{range .Issuer.Address}}<div class="muted">{{.}}</div>{{end}}
+    {{with .Issuer.Email}}<div class="muted">{{.}}</div>{{end}}
+    {{with .Issuer.TaxID}}<div class="muted">Tax ID: {{.}}</div>{{end}}
+  </div>
+  <div class="meta">
+    <h1>INVOICE</h1>
+    <div>Invoice no. {{.Number}}</div>
+    <div>Date: {{.IssuedAt.Format "2006-01-02"}}</div>
+    <div>Order: {{.OrderID}}</div>
+    <div><strong>{{.PaymentStatus}}</strong></div>
+  </div>
+</header>
+<section>
+  <h3>Bill to</h3>
+  {{with .Customer.Name}}<div>{{.}}</div>{{end}}
+  {{range .Customer.Address}}<div>{{.}}</div>{{end}}
+  {{with .Customer.Email}}<div>{{.}}</div>{{end}}
+</section>
+<table>
+  <thead>
+    <tr><th>Description</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Amount</th></tr>
+  </thead>
+  <tbody>
+  {{- range .Lines}}
+    <tr>
+      <td>{{.Description}}{{with .SKU}} <span class="muted">({{.}})</span>{{end}}</td>
+      <td class="num">{{.Quantity}}</td>
+      <td class="num">{{$.Money .UnitPriceCents}}</td>
+      <td class="num">{{$.Money .AmountCents}}</td>
+    </tr>
+  {{- end}}
+  </tbody>
+  <tfoot>
+    <tr><td colspan="3" class="num">Subtotal</td><td class="num">{{.Money .SubtotalCents}}</td></tr>
+    {{- if gt .DiscountCents 0}}
+    <tr><td colspan="3" class="num">Discount{{with .PromotionCode}} ({{.}}){{end}}</td><td class="num">-{{.Money .DiscountCents}}</td></tr>
+    {{- end}}
+    <tr><td colspan="3" class="num">Shipping {{.ShippingMethod}}</td><td class="num">{{.Money .ShippingCents}}</td></tr>
+    <tr><td colspan="3" class="num">{{.TaxLabel}}</td><td class="num">{{.Money .TaxCents}}</td></tr>
+    <tr class="total"><td colspan="3" class="num">Total</td><td class="num">{{.Money .TotalCents}}</td></tr>
+  </tfoot>
+</table>
+<p class="muted">Thank you for your order.</p>
+</body>
+</html>
+`))
+
+// HTML renders doc as a standalone HTML page.
+func HTML(doc Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
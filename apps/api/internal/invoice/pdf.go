@@ -0,0 +1,240 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// The PDF is written by hand with the standard Helvetica fonts, which every
+// reader has built in, so no fonts are embedded and no dependency is needed.
+
+const (
+	pageWidth    = 595 // A4 in points
+	pageHeight   = 842
+	margin       = 50
+	bottomMargin = 90
+)
+
+// helveticaWidths are the Helvetica advance widths of ASCII 32-126 in
+// thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth measures s in points. Bold text is measured with the regular
+// widths, which is close enough for right-aligning figures.
+func textWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		if r >= 32 && r < 127 {
+			total += helveticaWidths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// fit shortens s with an ellipsis until it is at most width points wide.
+func fit(s string, size, width float64) string {
+	if textWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+func (p *pdfWriter) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+}
+
+func (p *pdfWriter) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+func (p *pdfWriter) textRight(right, y, size float64, bold bool, s string) {
+	p.text(right-textWidth(s, size), y, size, bold, s)
+}
+
+func (p *pdfWriter) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(p.page, "%.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// bytes assembles the pages into a PDF file with its cross-reference table.
+func (p *pdfWriter) bytes() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // page tree, filled in below once page object numbers are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	kids := make([]string, len(p.pages))
+	for i, content := range p.pages {
+		pageObj := len(objects) + 1
+		kids[i] = fmt.Sprintf("%d 0 R", pageObj)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, pageObj+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString encodes s as WinAnsi for a literal string, replacing characters
+// the standard fonts cannot show.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r == '€':
+			b.WriteByte(0x80)
+		case r >= 32 && r < 127, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// PDF renders doc as a single- or multi-page A4 invoice.
+func PDF(doc Document) []byte {
+	p := &pdfWriter{}
+	p.newPage()
+	right := float64(pageWidth - margin)
+	y := float64(pageHeight - margin - 10)
+
+	p.text(margin, y, 18, true, doc.Issuer.Name)
+	p.textRight(right, y, 18, true, "INVOICE")
+	y -= 20
+	meta := []string{
+		"Invoice no. " + doc.Number,
+		"Date: " + doc.IssuedAt.Format("2006-01-02"),
+		"Order: " + doc.OrderID.String(),
+		doc.PaymentStatus(),
+	}
+	issuer := append(append([]string{}, doc.Issuer.Address...), doc.Issuer.Email)
+	if doc.Issuer.TaxID != "" {
+		issuer = append(issuer, "Tax ID: "+doc.Issuer.TaxID)
+	}
+	for i := 0; i < max(len(meta), len(issuer)); i++ {
+		if i < len(issuer) && issuer[i] != "" {
+			p.text(margin, y, 9, false, issuer[i])
+		}
+		if i < len(meta) {
+			p.textRight(right, y, 9, false, meta[i])
+		}
+		y -= 12
+	}
+
+	y -= 16
+	p.text(margin, y, 10, true, "Bill to")
+	y -= 14
+	for _, line := range append(append([]string{doc.Customer.Name}, doc.Customer.Address...), doc.Customer.Email) {
+		if line != "" {
+			p.text(margin, y, 10, false, line)
+			y -= 13
+		}
+	}
+
+	const (
+		qtyRight   = 360
+		priceRight = 450
+	)
+	header := func() {
+		y -= 20
+		p.text(margin, y, 10, true, "Description")
+		p.textRight(qtyRight, y, 10, true, "Qty")
+		p.textRight(priceRight, y, 10, true, "Unit price")
+		p.textRight(right, y, 10, true, "Amount")
+		y -= 6
+		p.line(margin, y, right, y)
+		y -= 14
+	}
+	header()
+	for _, line := range doc.Lines {
+		if y < bottomMargin {
+			p.newPage()
+			y = float64(pageHeight - margin)
+			header()
+		}
+		description := line.Description
+		if line.SKU != "" {
+			description += " (" + line.SKU + ")"
+		}
+		p.text(margin, y, 10, false, fit(description, 10, qtyRight-margin-40))
+		p.textRight(qtyRight, y, 10, false, fmt.Sprint(line.Quantity))
+		p.textRight(priceRight, y, 10, false, doc.Money(line.UnitPriceCents))
+		p.textRight(right, y, 10, false, doc.Money(line.AmountCents))
+		y -= 16
+	}
+
+	summary := [][2]string{{"Subtotal", doc.Money(doc.SubtotalCents)}}
+	if doc.DiscountCents > 0 {
+		label := "Discount"
+		if doc.PromotionCode != "" {
+			label += " (" + doc.PromotionCode + ")"
+		}
+		summary = append(summary, [2]string{label, doc.Money(-doc.DiscountCents)})
+	}
+	summary = append(summary,
+		[2]string{"Shipping " + doc.ShippingMethod, doc.Money(doc.ShippingCents)},
+		[2]string{doc.TaxLabel, doc.Money(doc.TaxCents)},
+	)
+	if y-float64(len(summary)+2)*16 < bottomMargin {
+		p.newPage()
+		y = float64(pageHeight - margin)
+	}
+	p.line(margin, y+8, right, y+8)
+	y -= 6
+	for _, row := range summary {
+		p.textRight(priceRight, y, 10, false, row[0])
+		p.textRight(right, y, 10, false, row[1])
+		y -= 16
+	}
+	p.line(priceRight-120, y+10, right, y+10)
+	y -= 4
+	p.textRight(priceRight, y, 12, true, "Total")
+	p.textRight(right, y, 12, true, doc.Money(doc.TotalCents))
+
+	p.text(margin, bottomMargin-40, 9, false, "Thank you for your order.")
+	return p.bytes()
+}
@@ -0,0 +1,130 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/mailer"
+)
+
+var ErrNotPaid = errors.New("the invoice is issued once the order is paid")
+
+type Options struct {
+	// Prefix goes in front of the zero-padded sequence number.
+	Prefix string
+	Issuer Party
+}
+
+type Service struct {
+	db     *gorm.DB
+	logger *slog.Logger
+	mailer mailer.Mailer
+	opts   Options
+}
+
+func New(db *gorm.DB, logger *slog.Logger, mailer mailer.Mailer, opts Options) *Service {
+	return &Service{db: db, logger: logger, mailer: mailer, opts: opts}
+}
+
+// Assign gives order the next invoice number inside tx, unless it already
+// has one. The counter row stays locked until tx ends, so concurrent payments
+// take numbers one at a time and a rollback gives its number back.
+func (s *Service) Assign(tx *gorm.DB, order *database.Order) error {
+	if order.InvoiceNumber != "" {
+		return nil
+	}
+	var counter database.InvoiceCounter
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("name = ?", database.InvoiceCounterName).
+		First(&counter).Error; err != nil {
+		return fmt.Errorf("invoice counter: %w", err)
+	}
+	counter.Value++
+	if err := tx.Model(&counter).Update("value", counter.Value).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	number := fmt.Sprintf("%s%06d", s.opts.Prefix, counter.Value)
+	if err := tx.Model(order).Updates(map[string]any{"invoice_number": number, "invoiced_at": now}).Error; err != nil {
+		return err
+	}
+	order.InvoiceNumber = number
+	order.InvoicedAt = &now
+	return nil
+}
+
+// Issue makes sure a paid order has an invoice number, for orders paid
+// before invoicing existed. Unpaid orders have no invoice yet.
+func (s *Service) Issue(ctx context.Context, order *database.Order) error {
+	if order.InvoiceNumber != "" {
+		return nil
+	}
+	if order.PaidAt == nil {
+		return ErrNotPaid
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked database.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", order.ID).First(&locked).Error; err != nil {
+			return err
+		}
+		if err := s.Assign(tx, &locked); err != nil {
+			return err
+		}
+		order.InvoiceNumber = locked.InvoiceNumber
+		order.InvoicedAt = locked.InvoicedAt
+		return nil
+	})
+}
+
+// Document lays out order, which must have its items loaded, as an invoice.
+func (s *Service) Document(ctx context.Context, order *database.Order) (Document, error) {
+	user, err := s.user(ctx, order.UserID)
+	if err != nil {
+		return Document{}, err
+	}
+	return NewDocument(order, s.opts.Issuer, user.Email), nil
+}
+
+// SendConfirmation emails the order confirmation with the invoice attached.
+func (s *Service) SendConfirmation(ctx context.Context, order *database.Order) error {
+	user, err := s.user(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+	doc := NewDocument(order, s.opts.Issuer, user.Email)
+	name := user.Name
+	if name == "" {
+		name = order.ShippingAddress.Name
+	}
+	return s.mailer.SendOrderConfirmation(ctx, user.Email, mailer.OrderConfirmation{
+		Name:          name,
+		OrderID:       order.ID.String(),
+		InvoiceNumber: doc.Number,
+		Total:         doc.Money(doc.TotalCents),
+		Attachments: []mailer.Attachment{
+			{Filename: Filename(doc, "pdf"), Data: PDF(doc)},
+		},
+	})
+}
+
+// Filename names the invoice file with the given extension.
+func Filename(doc Document, ext string) string {
+	return fmt.Sprintf("invoice-%s.%s", doc.Number, ext)
+}
+
+func (s *Service) user(ctx context.Context, id uuid.UUID) (*database.User, error) {
+	var user database.User
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
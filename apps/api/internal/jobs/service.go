@@ -3,7 +3,14 @@ package jobs
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"log/slog"
@@ -14,63 +21,206 @@ import (
 	"github.com/3dprint-hub/api/internal/database"
 	"github.com/3dprint-hub/api/internal/pricing"
 	"github.com/3dprint-hub/api/internal/storage"
+	"github.com/3dprint-hub/api/internal/thumbnail"
+)
+
+var (
+	ErrNotFound        = errors.New("print job not found")
+	ErrInvalidName     = errors.New("file name required")
+	ErrExtensionChange = errors.New("file name must keep its extension")
+	ErrAttached        = errors.New("print job is attached to an order")
+)
+
+const (
+	// thumbnailTimeout bounds how long a preview may take to render.
+	thumbnailTimeout = 30 * time.Second
+	// thumbnailQueue is how many uploads may wait for a preview. Past it
+	// new uploads are left without one rather than pile up.
+	thumbnailQueue = 64
 )
 
 type Service struct {
-	db       *gorm.DB
-	logger   *slog.Logger
-	storage  storage.Provider
+	db      *gorm.DB
+	logger  *slog.Logger
+	storage storage.Provider
+	pricing *pricing.Service
+
+	// thumbnails holds uploads waiting for RunThumbnails to render them.
+	thumbnails chan thumbnailTask
+	render     func(ctx context.Context, task thumbnailTask)
+}
+
+type thumbnailTask struct {
+	jobID    uuid.UUID
+	path     string
+	fileName string
 }
 
 type CreateInput struct {
 	UserID   uuid.UUID
 	FileName string
-	Data     []byte
+	File     io.Reader
 	Estimate *pricing.Estimate
-	Material string
-	Quality  string
 }
 
-func New(db *gorm.DB, logger *slog.Logger, storage storage.Provider) *Service {
-	return &Service{db: db, logger: logger, storage: storage}
+// Owner identifies who is acting on a job. Admins may reach any job; everyone
+// else only their own.
+type Owner struct {
+	UserID uuid.UUID
+	Admin  bool
+}
+
+func New(db *gorm.DB, logger *slog.Logger, storage storage.Provider, pricing *pricing.Service) *Service {
+	s := &Service{db: db, logger: logger, storage: storage, pricing: pricing, thumbnails: make(chan thumbnailTask, thumbnailQueue)}
+	s.render = s.renderThumbnail
+	return s
 }
 
 func (s *Service) Create(ctx context.Context, input CreateInput) (*database.PrintJob, error) {
 	// Save file to storage
-	path, err := s.storage.Save(ctx, input.FileName, bytesReader(input.Data))
+	path, err := s.storage.Save(ctx, input.FileName, input.File)
 	if err != nil {
 		return nil, err
 	}
 	job := &database.PrintJob{
-		UserID:          input.UserID,
-		FileName:        input.FileName,
-		StoragePath:     path,
-		Material:        input.Material,
-		Quality:         input.Quality,
-		EstimatedGrams:  input.Estimate.EstimatedGrams,
-		EstimatedHours:  input.Estimate.EstimatedHours,
-		EstimatedPrice:  int(input.Estimate.EstimatedPrice * 100),
-		Analysis: map[string]any{
-			"surfaceAreaCm2": input.Estimate.SurfaceAreaCM2,
-			"volumeCm3":      input.Estimate.VolumeCM3,
-			"triangleCount":  input.Estimate.TriangleCount,
-			"infill":         input.Estimate.RecommendedInfill,
-		},
-		Status:          "draft",
-		LastEstimatedAt: time.Now(),
-		Source:          "upload",
-		OriginalExt:     filepath.Ext(input.FileName),
-		BoundingBoxMM: map[string]any{
-			"min": input.Estimate.BoundingBoxMM.Min,
-			"max": input.Estimate.BoundingBoxMM.Max,
-		},
+		UserID:      input.UserID,
+		FileName:    input.FileName,
+		StoragePath: path,
+		Status:      "draft",
+		Source:      "upload",
+		OriginalExt: filepath.Ext(input.FileName),
 	}
+	applyEstimate(job, input.Estimate)
 	if err := s.db.WithContext(ctx).Create(job).Error; err != nil {
 		return nil, err
 	}
+	// The upload does not wait for the preview; ThumbnailPath is filled in
+	// once it has rendered.
+	s.queueThumbnail(thumbnailTask{jobID: job.ID, path: path, fileName: input.FileName})
 	return job, nil
 }
 
+func (s *Service) queueThumbnail(task thumbnailTask) {
+	select {
+	case s.thumbnails <- task:
+	default:
+		s.logger.Warn("thumbnail queue full, skipping preview", "job", task.jobID, "file", task.fileName)
+	}
+}
+
+// RunThumbnails renders queued previews on the given number of workers until
+// ctx is cancelled, which also cancels the renders in progress. It returns
+// once every worker has stopped.
+func (s *Service) RunThumbnails(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-s.thumbnails:
+					s.render(ctx, task)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// estimateColumns are the columns applyEstimate sets.
+var estimateColumns = []string{
+	"material", "quality", "estimated_grams", "estimated_hours", "estimated_price",
+	"analysis", "surface_area_cm2", "volume_cm3", "last_estimated_at", "bounding_box_mm",
+	"requires_approval", "approval_status", "updated_at",
+}
+
+// applyEstimate copies an estimate's figures onto the job.
+func applyEstimate(job *database.PrintJob, estimate *pricing.Estimate) {
+	job.Material = estimate.Material
+	job.Quality = estimate.Quality
+	job.EstimatedGrams = estimate.EstimatedGrams
+	job.EstimatedHours = estimate.EstimatedHours
+	job.EstimatedPrice = toCents(estimate.EstimatedPrice)
+	job.Analysis = map[string]any{
+		"surfaceAreaCm2": estimate.SurfaceAreaCM2,
+		"volumeCm3":      estimate.VolumeCM3,
+		"triangleCount":  estimate.TriangleCount,
+		"infill":         estimate.Slicer.InfillPercent,
+		"slicer":         estimate.Slicer,
+		"meshHealth":     estimate.MeshHealth,
+		"units":          estimate.Units,
+		"fit":            estimate.Fit,
+		"supports":       estimate.Supports,
+		"objects":        estimate.Objects,
+		"layerHeightMm":  estimate.LayerHeightMM,
+		"breakdown":      estimate.Breakdown,
+	}
+	job.SurfaceAreaCM2 = estimate.SurfaceAreaCM2
+	job.VolumeCM3 = estimate.VolumeCM3
+	job.LastEstimatedAt = time.Now()
+	job.BoundingBoxMM = map[string]any{
+		"min": estimate.BoundingBoxMM.Min,
+		"max": estimate.BoundingBoxMM.Max,
+	}
+	// Meshes that would not slice cleanly are held for an operator.
+	if health := estimate.MeshHealth; health != nil && !health.Printable() && job.ApprovalStatus == "" {
+		job.RequiresApproval = true
+		job.ApprovalStatus = "pending"
+	}
+}
+
+// toCents converts a price in currency units to whole cents, rounding to the
+// nearest rather than truncating values like 19.99 that floats store as
+// 19.989999….
+func toCents(amount float64) int {
+	return int(math.Round(amount * 100))
+}
+
+// renderThumbnail draws the stored model, saves the PNG next to it and
+// records it on the job. Models that take longer than thumbnailTimeout are
+// left without a preview.
+func (s *Service) renderThumbnail(ctx context.Context, task thumbnailTask) {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+	jobID := task.jobID
+	thumb, err := s.saveThumbnail(ctx, task.path, task.fileName)
+	if err != nil {
+		s.logger.Warn("failed to render thumbnail", "job", jobID, "file", task.fileName, "err", err)
+		return
+	}
+	res := s.db.WithContext(ctx).Model(&database.PrintJob{}).Where("id = ?", jobID).Update("thumbnail_path", thumb)
+	if res.Error == nil && res.RowsAffected == 1 {
+		return
+	}
+	// the job was deleted while rendering, or could not be updated
+	if res.Error != nil {
+		s.logger.Warn("failed to record thumbnail", "job", jobID, "err", res.Error)
+	}
+	if err := s.storage.Delete(ctx, thumb); err != nil {
+		s.logger.Warn("failed to delete thumbnail", "job", jobID, "err", err)
+	}
+}
+
+func (s *Service) saveThumbnail(ctx context.Context, path, fileName string) (string, error) {
+	f, err := s.storage.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := thumbnail.RenderPNG(ctx, &buf, fileName, f, info.Size(), thumbnail.Options{}); err != nil {
+		return "", err
+	}
+	return s.storage.Save(ctx, "thumbnail.png", &buf)
+}
+
 func (s *Service) ListForUser(ctx context.Context, userID uuid.UUID) ([]database.PrintJob, error) {
 	var jobs []database.PrintJob
 	if err := s.db.WithContext(ctx).
@@ -82,6 +232,150 @@ func (s *Service) ListForUser(ctx context.Context, userID uuid.UUID) ([]database
 	return jobs, nil
 }
 
-func bytesReader(data []byte) *bytes.Reader {
-	return bytes.NewReader(data)
+func (s *Service) Get(ctx context.Context, owner Owner, jobID uuid.UUID) (*database.PrintJob, error) {
+	query := s.db.WithContext(ctx).Where("id = ?", jobID)
+	if !owner.Admin {
+		query = query.Where("user_id = ?", owner.UserID)
+	}
+	var job database.PrintJob
+	if err := query.First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Rename changes the display name. The extension is kept because it decides
+// how the stored file is parsed.
+func (s *Service) Rename(ctx context.Context, owner Owner, jobID uuid.UUID, name string) (*database.PrintJob, error) {
+	name = strings.TrimSpace(filepath.Base(name))
+	if name == "" || name == "." || name == "/" {
+		return nil, ErrInvalidName
+	}
+	job, err := s.Get(ctx, owner, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(filepath.Ext(name), job.OriginalExt) {
+		return nil, ErrExtensionChange
+	}
+	job.FileName = name
+	if err := s.db.WithContext(ctx).Model(job).Update("file_name", name).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Delete removes the job and its stored files. Jobs already on an order are
+// kept.
+func (s *Service) Delete(ctx context.Context, owner Owner, jobID uuid.UUID) error {
+	job, err := s.Get(ctx, owner, jobID)
+	if err != nil {
+		return err
+	}
+	if job.OrderID != nil {
+		return ErrAttached
+	}
+	if err := s.db.WithContext(ctx).Delete(job).Error; err != nil {
+		return err
+	}
+	if err := s.storage.Delete(ctx, job.StoragePath); err != nil {
+		s.logger.Warn("failed to delete job file", "job", job.ID, "err", err)
+	}
+	if job.ThumbnailPath != nil {
+		if err := s.storage.Delete(ctx, *job.ThumbnailPath); err != nil {
+			s.logger.Warn("failed to delete job thumbnail", "job", job.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+// Reestimate prices the stored file again with new options. Material and
+// quality default to the job's current choice.
+func (s *Service) Reestimate(ctx context.Context, owner Owner, jobID uuid.UUID, input pricing.EstimateInput) (*database.PrintJob, *pricing.Estimate, error) {
+	job, err := s.Get(ctx, owner, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.OrderID != nil {
+		return nil, nil, ErrAttached
+	}
+	if input.Material == "" {
+		input.Material = job.Material
+	}
+	if input.Quality == "" {
+		input.Quality = job.Quality
+	}
+	f, err := s.storage.Open(job.StoragePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	estimate, err := s.pricing.Estimate(ctx, job.FileName, f, info.Size(), input)
+	if err != nil {
+		return nil, nil, err
+	}
+	applyEstimate(job, estimate)
+	// Only the estimate is written, and only while the job is still
+	// unattached: checkout or a thumbnail may have changed the row while the
+	// file was being priced.
+	res := s.db.WithContext(ctx).Model(job).Where("order_id IS NULL").Select(estimateColumns).Updates(job)
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil, ErrAttached
+	}
+	return job, estimate, nil
+}
+
+// Quote prices a job under the current pricing rules, in cents. Jobs already
+// on an order cannot be quoted again.
+func (s *Service) Quote(ctx context.Context, owner Owner, jobID uuid.UUID) (*database.PrintJob, int, error) {
+	job, err := s.Get(ctx, owner, jobID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if job.OrderID != nil {
+		return nil, 0, ErrAttached
+	}
+	breakdown, err := s.pricing.Reprice(ctx, pricing.Quote{
+		Material:    job.Material,
+		Quality:     job.Quality,
+		Grams:       job.EstimatedGrams,
+		Hours:       job.EstimatedHours,
+		BoundingBox: BoundingBox(job),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return job, toCents(breakdown.Total), nil
+}
+
+// BoundingBox decodes the bounding box stored with the job's last estimate.
+func BoundingBox(job *database.PrintJob) pricing.BoundingBox {
+	var bb pricing.BoundingBox
+	if raw, err := json.Marshal(job.BoundingBoxMM); err == nil {
+		_ = json.Unmarshal(raw, &bb)
+	}
+	return bb
+}
+
+// Open returns the job and its original upload. The caller closes the file.
+func (s *Service) Open(ctx context.Context, owner Owner, jobID uuid.UUID) (*database.PrintJob, *os.File, error) {
+	job, err := s.Get(ctx, owner, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := s.storage.Open(job.StoragePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, f, nil
 }
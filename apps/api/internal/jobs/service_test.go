@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/schema"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/pricing"
+)
+
+func TestToCents(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   int
+	}{
+		{0, 0},
+		{19.99, 1999},
+		{0.29, 29},
+		{1.005, 100}, // stored as 1.00499…
+		{12.345, 1235},
+		{-4.56, -456},
+	}
+	for _, tt := range tests {
+		if got := toCents(tt.amount); got != tt.want {
+			t.Errorf("toCents(%v) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestRunThumbnailsBoundsWorkers(t *testing.T) {
+	const workers = 2
+	var (
+		mu      sync.Mutex
+		running int
+		most    int
+	)
+	release := make(chan struct{})
+	s := &Service{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		thumbnails: make(chan thumbnailTask, thumbnailQueue),
+	}
+	s.render = func(ctx context.Context, task thumbnailTask) {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}
+	// more uploads than the queue holds: the overflow is dropped, not started
+	for range thumbnailQueue + 10 {
+		s.queueThumbnail(thumbnailTask{jobID: uuid.New()})
+	}
+	if len(s.thumbnails) != thumbnailQueue {
+		t.Fatalf("queued %d, want %d", len(s.thumbnails), thumbnailQueue)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.RunThumbnails(ctx, workers)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	busy := running
+	mu.Unlock()
+	if busy != workers {
+		t.Errorf("%d renders running, want %d", busy, workers)
+	}
+	release <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunThumbnails did not return after cancel")
+	}
+	if most > workers {
+		t.Errorf("%d renders ran at once, want at most %d", most, workers)
+	}
+	if running != 0 {
+		t.Errorf("%d renders still running after shutdown", running)
+	}
+}
+
+// Reestimate writes only estimateColumns, so every column applyEstimate
+// sets must be listed or the new figure is silently dropped.
+func TestEstimateColumnsCoverApplyEstimate(t *testing.T) {
+	job := &database.PrintJob{}
+	applyEstimate(job, &pricing.Estimate{
+		Material:       "PLA",
+		Quality:        "standard",
+		EstimatedGrams: 12,
+		EstimatedHours: 1.5,
+		EstimatedPrice: 9.99,
+		VolumeCM3:      10,
+		SurfaceAreaCM2: 20,
+		MeshHealth:     &pricing.MeshHealth{},
+	})
+	s, err := schema.Parse(job, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := map[string]bool{}
+	for _, col := range estimateColumns {
+		listed[col] = true
+	}
+	value := reflect.ValueOf(job)
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if _, zero := field.ValueOf(context.Background(), value); !zero && !listed[field.DBName] {
+			t.Errorf("applyEstimate sets %s, which estimateColumns does not list", field.DBName)
+		}
+	}
+}
@@ -14,6 +14,23 @@ import (
 type Mailer interface {
 	SendWelcome(ctx context.Context, to, name string) error
 	SendPasswordReset(ctx context.Context, to, token string) error
+	SendVerification(ctx context.Context, to, name, token string) error
+	SendOrderConfirmation(ctx context.Context, to string, confirmation OrderConfirmation) error
+}
+
+// OrderConfirmation is what the order-confirmation email says. Total is
+// already formatted with its currency.
+type OrderConfirmation struct {
+	Name          string
+	OrderID       string
+	InvoiceNumber string
+	Total         string
+	Attachments   []Attachment
+}
+
+type Attachment struct {
+	Filename string
+	Data     []byte
 }
 
 func New(cfg *config.Config, logger *slog.Logger) Mailer {
@@ -48,8 +65,25 @@ func (m *mailgunMailer) SendPasswordReset(ctx context.Context, to, token string)
 	return m.send(ctx, to, subject, body)
 }
 
-func (m *mailgunMailer) send(ctx context.Context, to, subject, body string) error {
+func (m *mailgunMailer) SendVerification(ctx context.Context, to, name, token string) error {
+	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", m.config.FrontendURL, token)
+	subject := "Confirm your 3DPrint Hub email address"
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address so you can place orders.\n\nConfirm link: %s\n\nIf you didn't create an account, you can ignore this email.", name, verifyURL)
+	return m.send(ctx, to, subject, body)
+}
+
+func (m *mailgunMailer) SendOrderConfirmation(ctx context.Context, to string, confirmation OrderConfirmation) error {
+	ordersURL := fmt.Sprintf("%s/orders/%s", m.config.FrontendURL, confirmation.OrderID)
+	subject := fmt.Sprintf("Your 3DPrint Hub order - invoice %s", confirmation.InvoiceNumber)
+	body := fmt.Sprintf("Hi %s,\n\nThanks for your order! Your payment has been received and we'll start printing shortly.\n\nInvoice: %s\nTotal: %s\n\nTrack your order: %s\n\nYour invoice is attached.\n", confirmation.Name, confirmation.InvoiceNumber, confirmation.Total, ordersURL)
+	return m.send(ctx, to, subject, body, confirmation.Attachments...)
+}
+
+func (m *mailgunMailer) send(ctx context.Context, to, subject, body string, attachments ...Attachment) error {
 	message := m.client.NewMessage(m.config.Mailgun.From, subject, body, to)
+	for _, a := range attachments {
+		message.AddBufferAttachment(a.Filename, a.Data)
+	}
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	_, _, err := m.client.Send(ctx, message)
@@ -72,3 +106,17 @@ func (m *stdoutMailer) SendPasswordReset(ctx context.Context, to, token string)
 	m.logger.Info("stdout password reset email", "to", to, "token", token)
 	return nil
 }
+
+func (m *stdoutMailer) SendVerification(ctx context.Context, to, name, token string) error {
+	m.logger.Info("stdout verification email", "to", to, "name", name, "token", token)
+	return nil
+}
+
+func (m *stdoutMailer) SendOrderConfirmation(ctx context.Context, to string, confirmation OrderConfirmation) error {
+	names := make([]string, len(confirmation.Attachments))
+	for i, a := range confirmation.Attachments {
+		names[i] = a.Filename
+	}
+	m.logger.Info("stdout order confirmation email", "to", to, "invoice", confirmation.InvoiceNumber, "total", confirmation.Total, "attachments", names)
+	return nil
+}
@@ -3,6 +3,7 @@ package order
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"log/slog"
@@ -10,24 +11,107 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/3dprint-hub/api/internal/catalog"
 	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/jobs"
+	"github.com/3dprint-hub/api/internal/promotions"
+	"github.com/3dprint-hub/api/internal/shipping"
+	"github.com/3dprint-hub/api/internal/tax"
 )
 
 var (
-	ErrEmptyCart = errors.New("cart is empty")
+	ErrNotFound      = errors.New("order not found")
+	ErrEmptyCart     = errors.New("cart is empty")
+	ErrPricesChanged = errors.New("cart prices have changed; review the cart and try again")
+	ErrNotPayable    = errors.New("only pending orders can be paid")
 )
 
 type Service struct {
-	db     *gorm.DB
-	logger *slog.Logger
+	db         *gorm.DB
+	logger     *slog.Logger
+	pricer     ItemPricer
+	payments   PaymentStarter
+	taxes      TaxCalculator
+	addresses  AddressResolver
+	shipping   ShippingQuoter
+	promotions PromotionEvaluator
+	invoices   InvoiceAssigner
+	currency   string
+}
+
+type Options struct {
+	DB         *gorm.DB
+	Logger     *slog.Logger
+	Pricer     ItemPricer
+	Payments   PaymentStarter
+	Taxes      TaxCalculator
+	Addresses  AddressResolver
+	Shipping   ShippingQuoter
+	Promotions PromotionEvaluator
+	Invoices   InvoiceAssigner
+	Currency   string
+}
+
+// ItemPricer recomputes the current unit price of a cart line and describes
+// the lines as parcel contents.
+type ItemPricer interface {
+	UnitPrice(ctx context.Context, userID uuid.UUID, item database.CartItem) (int, error)
+	ShippingItems(ctx context.Context, userID uuid.UUID, items []database.CartItem) ([]shipping.Item, error)
+}
+
+// PaymentStarter opens a payment for a pending order, or returns the one
+// still waiting to be paid.
+type PaymentStarter interface {
+	StartPayment(ctx context.Context, order *database.Order) (*database.Payment, error)
+}
+
+// TaxCalculator works out the tax on a subtotal delivered to a location.
+type TaxCalculator interface {
+	Calculate(ctx context.Context, loc tax.Location, subtotalCents int) (tax.Result, error)
+}
+
+// AddressResolver finds one of the user's saved addresses, or their default
+// when id is nil.
+type AddressResolver interface {
+	Resolve(ctx context.Context, userID uuid.UUID, id *uuid.UUID) (*database.Address, error)
+}
+
+type ShippingQuoter interface {
+	Quote(ctx context.Context, country string, items []shipping.Item) ([]shipping.Quote, error)
+	Select(ctx context.Context, country string, items []shipping.Item, rateID *uuid.UUID) (shipping.Quote, error)
+}
+
+// PromotionEvaluator works out the discount a code gives on the order's
+// lines and shipping.
+type PromotionEvaluator interface {
+	Evaluate(ctx context.Context, userID uuid.UUID, code string, lines []promotions.Line, shippingCents int) (*promotions.Discount, error)
+}
+
+// InvoiceAssigner numbers the invoice of an order being marked paid, inside
+// the transaction that marks it.
+type InvoiceAssigner interface {
+	Assign(tx *gorm.DB, order *database.Order) error
 }
 
 type CheckoutInput struct {
-	Notes string
+	Notes          string
+	AddressID      *uuid.UUID
+	ShippingRateID *uuid.UUID
 }
 
-func New(db *gorm.DB, logger *slog.Logger) *Service {
-	return &Service{db: db, logger: logger}
+func New(opts Options) *Service {
+	return &Service{
+		db:         opts.DB,
+		logger:     opts.Logger,
+		pricer:     opts.Pricer,
+		payments:   opts.Payments,
+		taxes:      opts.Taxes,
+		addresses:  opts.Addresses,
+		shipping:   opts.Shipping,
+		promotions: opts.Promotions,
+		invoices:   opts.Invoices,
+		currency:   opts.Currency,
+	}
 }
 
 func (s *Service) Checkout(ctx context.Context, userID uuid.UUID, input CheckoutInput) (*database.Order, error) {
@@ -38,16 +122,54 @@ func (s *Service) Checkout(ctx context.Context, userID uuid.UUID, input Checkout
 	if len(cart.Items) == 0 {
 		return nil, ErrEmptyCart
 	}
+	// Prices are re-checked against the current rules. Stale lines are
+	// updated so the customer sees the new total before trying again.
+	changed := false
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		price, err := s.pricer.UnitPrice(ctx, userID, *item)
+		if err != nil {
+			return nil, err
+		}
+		if price != item.UnitPriceCents {
+			changed = true
+			item.UnitPriceCents = price
+			if err := s.db.WithContext(ctx).Model(item).Update("unit_price_cents", price).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	if changed {
+		return nil, ErrPricesChanged
+	}
+	address, err := s.addresses.Resolve(ctx, userID, input.AddressID)
+	if err != nil {
+		return nil, err
+	}
+	parcel, err := s.pricer.ShippingItems(ctx, userID, cart.Items)
+	if err != nil {
+		return nil, err
+	}
+	shipment, err := s.shipping.Select(ctx, address.Country, parcel, input.ShippingRateID)
+	if err != nil {
+		return nil, err
+	}
 	order := &database.Order{
-		UserID:   userID,
-		Status:   "pending",
-		Currency: "USD",
-		Notes:    input.Notes,
+		UserID:          userID,
+		Status:          StatusPending,
+		Currency:        s.currency,
+		Notes:           input.Notes,
+		ShippingCents:   shipment.PriceCents,
+		ShippingMethod:  shipment.Name,
+		ShippingAddress: address.PostalAddress,
+		Carrier:         shipment.Carrier,
 	}
 	subtotal := 0
 	items := make([]database.OrderItem, len(cart.Items))
 	for i, item := range cart.Items {
 		items[i] = database.OrderItem{
+			PrintJobID:     item.PrintJobID,
+			SKU:            item.SKU,
 			Name:           item.DisplayName,
 			Description:    "",
 			Quantity:       item.Quantity,
@@ -56,23 +178,75 @@ func (s *Service) Checkout(ctx context.Context, userID uuid.UUID, input Checkout
 		}
 		subtotal += item.Quantity * item.UnitPriceCents
 	}
+	// The cart's code is checked again now that shipping is known; one that
+	// has stopped applying fails checkout rather than being silently dropped.
+	var discount *promotions.Discount
+	if cart.PromotionCode != "" && s.promotions != nil {
+		discount, err = s.promotions.Evaluate(ctx, userID, cart.PromotionCode, promotions.CartLines(cart.Items), shipment.PriceCents)
+		if err != nil {
+			return nil, err
+		}
+		for i := range items {
+			items[i].DiscountCents = discount.LineCents[i]
+		}
+		promotionID := discount.Promotion.ID
+		order.DiscountCents = discount.TotalCents
+		order.PromotionID = &promotionID
+		order.PromotionCode = discount.Promotion.Code
+	}
+	// Shipping is taxed along with the goods, after any discount.
+	location := tax.Location{Country: address.Country, Region: address.Region}
+	taxed, err := s.taxes.Calculate(ctx, location, subtotal+shipment.PriceCents-order.DiscountCents)
+	if err != nil {
+		return nil, err
+	}
 	order.SubtotalCents = subtotal
-	order.TaxCents = int(float64(subtotal) * 0.08)
-	order.TotalCents = order.SubtotalCents + order.TaxCents
+	order.TaxCents = taxed.TaxCents
+	order.TotalCents = taxed.TotalCents
+	order.TaxRuleID = taxed.RuleID
+	order.TaxRuleName = taxed.RuleName
+	order.TaxRateBasisPoints = taxed.RateBasisPoints
+	order.TaxInclusive = taxed.Inclusive
+	order.TaxCountry = taxed.Country
+	order.TaxRegion = taxed.Region
 	now := time.Now()
 	order.PlacedAt = &now
 
-	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(order).Error; err != nil {
 			return err
 		}
+		if err := recordEvent(tx, order.ID, "", StatusPending, Actor{UserID: &userID, Role: "customer"}, ""); err != nil {
+			return err
+		}
 		for i := range items {
 			items[i].OrderID = order.ID
 			if err := tx.Create(&items[i]).Error; err != nil {
 				return err
 			}
+			if jobID := items[i].PrintJobID; jobID != nil {
+				res := tx.Model(&database.PrintJob{}).
+					Where("id = ? AND user_id = ? AND order_id IS NULL", *jobID, userID).
+					Updates(map[string]any{"order_id": order.ID, "order_item_id": items[i].ID, "status": "ordered"})
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected != 1 {
+					return jobs.ErrAttached
+				}
+			} else if err := catalog.TakeStock(tx, items[i].SKU, items[i].Quantity); err != nil {
+				return err
+			}
 		}
 		order.Items = items
+		if discount != nil {
+			if err := promotions.Redeem(tx, discount.Promotion, userID, order.ID, discount.TotalCents); err != nil {
+				return err
+			}
+			if err := tx.Model(&cart).Update("promotion_code", "").Error; err != nil {
+				return err
+			}
+		}
 		if err := tx.Where("cart_id = ?", cart.ID).Delete(&database.CartItem{}).Error; err != nil {
 			return err
 		}
@@ -81,9 +255,72 @@ func (s *Service) Checkout(ctx context.Context, userID uuid.UUID, input Checkout
 	if err != nil {
 		return nil, err
 	}
+	// The order stands even if the provider is unreachable; the customer can
+	// retry with Pay and unpaid orders are cancelled by the payment sweeper.
+	payment, err := s.payments.StartPayment(ctx, order)
+	if err != nil {
+		s.logger.Warn("failed to start payment", "order", order.ID, "err", err)
+		return order, nil
+	}
+	order.Payments = []database.Payment{*payment}
 	return order, nil
 }
 
+// ShippingOptions quotes every rate that can deliver the user's cart to the
+// address, cheapest first.
+func (s *Service) ShippingOptions(ctx context.Context, userID uuid.UUID, addressID *uuid.UUID) ([]shipping.Quote, error) {
+	var cart database.Cart
+	if err := s.db.WithContext(ctx).Preload("Items").Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		return nil, err
+	}
+	if len(cart.Items) == 0 {
+		return nil, ErrEmptyCart
+	}
+	address, err := s.addresses.Resolve(ctx, userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+	parcel, err := s.pricer.ShippingItems(ctx, userID, cart.Items)
+	if err != nil {
+		return nil, err
+	}
+	return s.shipping.Quote(ctx, address.Country, parcel)
+}
+
+// SetShipment records the carrier and tracking number for an order.
+func (s *Service) SetShipment(ctx context.Context, orderID uuid.UUID, carrier, trackingNumber string) (*database.Order, error) {
+	var order database.Order
+	if err := s.db.WithContext(ctx).Where("id = ?", orderID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if carrier = strings.TrimSpace(carrier); carrier != "" {
+		order.Carrier = carrier
+	}
+	order.TrackingNumber = strings.TrimSpace(trackingNumber)
+	if err := s.db.WithContext(ctx).Model(&order).Updates(map[string]any{
+		"carrier":         order.Carrier,
+		"tracking_number": order.TrackingNumber,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Pay starts or resumes payment of one of the user's pending orders.
+func (s *Service) Pay(ctx context.Context, userID, orderID uuid.UUID) (*database.Payment, error) {
+	order, err := s.Get(ctx, userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != StatusPending {
+		return nil, ErrNotPayable
+	}
+	return s.payments.StartPayment(ctx, order)
+}
+
 func (s *Service) ListByUser(ctx context.Context, userID uuid.UUID) ([]database.Order, error) {
 	var orders []database.Order
 	if err := s.db.WithContext(ctx).Preload("Items").
@@ -99,8 +336,13 @@ func (s *Service) Get(ctx context.Context, userID, orderID uuid.UUID) (*database
 	var order database.Order
 	if err := s.db.WithContext(ctx).
 		Preload("Items").
+		Preload("StatusEvents", byCreatedAt).
+		Preload("Payments", byCreatedAt).
 		Where("user_id = ? AND id = ?", userID, orderID).
 		First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 	return &order, nil
@@ -110,6 +352,7 @@ func (s *Service) AdminList(ctx context.Context) ([]database.Order, error) {
 	var orders []database.Order
 	if err := s.db.WithContext(ctx).
 		Preload("Items").
+		Preload("StatusEvents", byCreatedAt).
 		Order("created_at DESC").
 		Find(&orders).Error; err != nil {
 		return nil, err
@@ -117,8 +360,6 @@ func (s *Service) AdminList(ctx context.Context) ([]database.Order, error) {
 	return orders, nil
 }
 
-func (s *Service) UpdateStatus(ctx context.Context, orderID uuid.UUID, status string) error {
-	return s.db.WithContext(ctx).Model(&database.Order{}).
-		Where("id = ?", orderID).
-		Update("status", status).Error
+func byCreatedAt(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at ASC")
 }
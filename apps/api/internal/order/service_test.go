@@ -0,0 +1,68 @@
+package order
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/config"
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/invoice"
+	"github.com/3dprint-hub/api/internal/mailer"
+)
+
+// newTestService returns a service backed by the Postgres database named by
+// TEST_POSTGRES_DSN, skipping the test when it is unset.
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	db, err := database.New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	invoices := invoice.New(db, logger, mailer.New(&config.Config{}, logger), invoice.Options{Prefix: "TEST-"})
+	return New(Options{DB: db, Logger: logger, Invoices: invoices, Currency: "USD"}), db
+}
+
+func TestUpdateStatusPaidAssignsInvoice(t *testing.T) {
+	s, db := newTestService(t)
+	ctx := context.Background()
+	user := database.User{Email: "test-" + uuid.NewString() + "@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	placed := time.Now()
+	o := database.Order{UserID: user.ID, Status: StatusPending, TotalCents: 1999, Currency: "USD", PlacedAt: &placed}
+	if err := db.Create(&o).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// an admin records a payment taken outside the provider
+	paid, err := s.UpdateStatus(ctx, o.ID, StatusPaid, Actor{UserID: &user.ID, Role: "admin"}, "bank transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paid.InvoiceNumber == "" || paid.InvoicedAt == nil {
+		t.Fatalf("paid order has no invoice: %q", paid.InvoiceNumber)
+	}
+	var stored database.Order
+	if err := db.First(&stored, "id = ?", o.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.InvoiceNumber != paid.InvoiceNumber {
+		t.Errorf("stored invoice number = %q, want %q", stored.InvoiceNumber, paid.InvoiceNumber)
+	}
+}
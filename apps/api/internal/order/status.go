@@ -0,0 +1,179 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/3dprint-hub/api/internal/catalog"
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/promotions"
+)
+
+const (
+	StatusPending      = "pending"
+	StatusPaid         = "paid"
+	StatusInProduction = "in_production"
+	StatusPrinted      = "printed"
+	StatusShipped      = "shipped"
+	StatusDelivered    = "delivered"
+	StatusCancelled    = "cancelled"
+	StatusRefunded     = "refunded"
+)
+
+var (
+	ErrUnknownStatus     = errors.New("unknown order status")
+	ErrIllegalTransition = errors.New("illegal order status transition")
+)
+
+// transitions lists the statuses each status may move to. Unpaid orders are
+// cancelled; once money has been taken the way out is a refund.
+var transitions = map[string][]string{
+	StatusPending:      {StatusPaid, StatusCancelled},
+	StatusPaid:         {StatusInProduction, StatusRefunded},
+	StatusInProduction: {StatusPrinted, StatusRefunded},
+	StatusPrinted:      {StatusShipped, StatusRefunded},
+	StatusShipped:      {StatusDelivered, StatusRefunded},
+	StatusDelivered:    {StatusRefunded},
+	StatusCancelled:    nil,
+	StatusRefunded:     nil,
+}
+
+// Actor is who caused a status change. A nil UserID means the system.
+type Actor struct {
+	UserID *uuid.UUID
+	Role   string
+}
+
+var SystemActor = Actor{Role: "system"}
+
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateStatus moves an order to status if the lifecycle allows it, stamps
+// the matching timestamp and records the change. An order marked paid by
+// hand gets its invoice number in the same transaction, as a payment would
+// give it.
+func (s *Service) UpdateStatus(ctx context.Context, orderID uuid.UUID, status string, actor Actor, note string) (*database.Order, error) {
+	var order *database.Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = Transition(tx, orderID, status, actor, note)
+		if err != nil {
+			return err
+		}
+		if status == StatusPaid && s.invoices != nil {
+			return s.invoices.Assign(tx, order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Transition is UpdateStatus inside the caller's transaction, for services
+// that change an order alongside their own rows.
+func Transition(tx *gorm.DB, orderID uuid.UUID, status string, actor Actor, note string) (*database.Order, error) {
+	if _, ok := transitions[status]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+	var order database.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", orderID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := transition(tx, &order, status, actor, note); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// transition applies a status change to a row the caller has locked.
+func transition(tx *gorm.DB, order *database.Order, status string, actor Actor, note string) error {
+	from := order.Status
+	if !CanTransition(from, status) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, status)
+	}
+	now := time.Now()
+	updates := map[string]any{"status": status}
+	switch status {
+	case StatusPaid:
+		order.PaidAt = &now
+		updates["paid_at"] = now
+	case StatusInProduction:
+		order.ProductionStartedAt = &now
+		updates["production_started_at"] = now
+	case StatusPrinted:
+		order.PrintedAt = &now
+		updates["printed_at"] = now
+	case StatusShipped:
+		order.FulfilledAt = &now
+		updates["fulfilled_at"] = now
+	case StatusDelivered:
+		order.DeliveredAt = &now
+		updates["delivered_at"] = now
+	case StatusCancelled:
+		order.CancelledAt = &now
+		updates["cancelled_at"] = now
+		if err := releaseItems(tx, order.ID); err != nil {
+			return err
+		}
+	case StatusRefunded:
+		order.RefundedAt = &now
+		updates["refunded_at"] = now
+	}
+	if err := tx.Model(order).Updates(updates).Error; err != nil {
+		return err
+	}
+	order.Status = status
+	return recordEvent(tx, order.ID, from, status, actor, note)
+}
+
+// releaseItems undoes what checkout reserved for a cancelled order: catalog
+// stock goes back on the shelf, print jobs return to drafts and any
+// promotion use is given back.
+func releaseItems(tx *gorm.DB, orderID uuid.UUID) error {
+	var items []database.OrderItem
+	if err := tx.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.PrintJobID == nil && item.SKU != "" {
+			if err := catalog.ReturnStock(tx, item.SKU, item.Quantity); err != nil {
+				return err
+			}
+		}
+	}
+	if err := promotions.Release(tx, orderID); err != nil {
+		return err
+	}
+	return tx.Model(&database.PrintJob{}).
+		Where("order_id = ?", orderID).
+		Updates(map[string]any{"order_id": nil, "order_item_id": nil, "status": "draft"}).Error
+}
+
+func recordEvent(tx *gorm.DB, orderID uuid.UUID, from, to string, actor Actor, note string) error {
+	return tx.Create(&database.OrderStatusEvent{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actor.UserID,
+		ActorRole:  actor.Role,
+		Note:       note,
+	}).Error
+}
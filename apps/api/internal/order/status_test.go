@@ -0,0 +1,57 @@
+package order
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	statuses := []string{
+		StatusPending, StatusPaid, StatusInProduction, StatusPrinted,
+		StatusShipped, StatusDelivered, StatusCancelled, StatusRefunded,
+	}
+	allowed := map[[2]string]bool{
+		{StatusPending, StatusPaid}:          true,
+		{StatusPending, StatusCancelled}:     true,
+		{StatusPaid, StatusInProduction}:     true,
+		{StatusPaid, StatusRefunded}:         true,
+		{StatusInProduction, StatusPrinted}:  true,
+		{StatusInProduction, StatusRefunded}: true,
+		{StatusPrinted, StatusShipped}:       true,
+		{StatusPrinted, StatusRefunded}:      true,
+		{StatusShipped, StatusDelivered}:     true,
+		{StatusShipped, StatusRefunded}:      true,
+		{StatusDelivered, StatusRefunded}:    true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestCanTransitionUnknown(t *testing.T) {
+	tests := []struct{ from, to string }{
+		{"", StatusPaid},
+		{StatusPending, ""},
+		{"archived", StatusPending},
+		{StatusPending, "archived"},
+	}
+	for _, tt := range tests {
+		if CanTransition(tt.from, tt.to) {
+			t.Errorf("CanTransition(%q, %q) = true, want false", tt.from, tt.to)
+		}
+	}
+}
+
+// Every status must be a key of transitions, or Transition rejects it as
+// unknown before looking at the order.
+func TestTransitionsCoverStatuses(t *testing.T) {
+	for from, nexts := range transitions {
+		for _, to := range nexts {
+			if _, ok := transitions[to]; !ok {
+				t.Errorf("%s may move to %s, which has no entry", from, to)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownIntent  = errors.New("unknown payment intent")
+	ErrFakeDisabled   = errors.New("fake payments are disabled")
+	ErrUnknownOutcome = errors.New("unknown payment outcome")
+)
+
+// Fake is an in-process provider for development and tests. Intents live in
+// memory, and SignedEvent produces webhook deliveries that pass ParseWebhook,
+// so the whole checkout-to-paid flow runs without network access.
+type Fake struct {
+	// CustomerCheckout lets customers settle their own intents through
+	// Service.SettleFake; otherwise only admins may.
+	CustomerCheckout bool
+
+	mu            sync.Mutex
+	webhookSecret string
+	intents       map[string]fakeIntent
+	byKey         map[string]string
+}
+
+type fakeIntent struct {
+	amountCents int
+	currency    string
+	canceled    bool
+}
+
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{
+		webhookSecret: webhookSecret,
+		intents:       make(map[string]fakeIntent),
+		byKey:         make(map[string]string),
+	}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateIntent(_ context.Context, input IntentInput) (*Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id, ok := f.byKey[input.IdempotencyKey]; ok && input.IdempotencyKey != "" {
+		return &Intent{ID: id, ClientSecret: id + "_secret"}, nil
+	}
+	id := "pi_fake_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	f.intents[id] = fakeIntent{amountCents: input.AmountCents, currency: input.Currency}
+	if input.IdempotencyKey != "" {
+		f.byKey[input.IdempotencyKey] = id
+	}
+	return &Intent{ID: id, ClientSecret: id + "_secret"}, nil
+}
+
+func (f *Fake) CancelIntent(_ context.Context, intentID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return ErrUnknownIntent
+	}
+	intent.canceled = true
+	f.intents[intentID] = intent
+	return nil
+}
+
+func (f *Fake) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := verifySignature(payload, header.Get("Stripe-Signature"), f.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+	return parseStripeEvent(payload)
+}
+
+// SignedEvent builds a signed webhook delivery reporting outcome (one of the
+// Event* constants) for an intent created by this provider.
+func (f *Fake) SignedEvent(intentID, outcome string) ([]byte, http.Header, error) {
+	f.mu.Lock()
+	intent, ok := f.intents[intentID]
+	f.mu.Unlock()
+	if !ok {
+		return nil, nil, ErrUnknownIntent
+	}
+	var eventType string
+	for stripeType, normalized := range stripeEventTypes {
+		if normalized == outcome {
+			eventType = stripeType
+		}
+	}
+	if eventType == "" {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownOutcome, outcome)
+	}
+	var raw stripeEvent
+	raw.ID = "evt_fake_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	raw.Type = eventType
+	raw.Data.Object.ID = intentID
+	raw.Data.Object.Amount = intent.amountCents
+	raw.Data.Object.Currency = strings.ToLower(intent.currency)
+	if outcome == EventFailed {
+		raw.Data.Object.LastPaymentError = &struct {
+			Message string `json:"message"`
+		}{Message: "Your card was declined."}
+	}
+	payload, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Stripe-Signature", signPayload(payload, f.webhookSecret, time.Now()))
+	return payload, header, nil
+}
@@ -0,0 +1,52 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFakeSignedEvent(t *testing.T) {
+	fake := NewFake("whsec_test")
+	intent, err := fake.CreateIntent(context.Background(), IntentInput{AmountCents: 1999, Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, header, err := fake.SignedEvent(intent.ID, EventSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := fake.ParseWebhook(payload, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventSucceeded || event.IntentID != intent.ID || event.AmountCents != 1999 || event.Currency != "EUR" {
+		t.Errorf("event = %+v", event)
+	}
+
+	if _, err := NewFake("whsec_other").ParseWebhook(payload, header); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other secret: err = %v, want ErrInvalidSignature", err)
+	}
+	if _, _, err := fake.SignedEvent(intent.ID, "refunded"); !errors.Is(err, ErrUnknownOutcome) {
+		t.Errorf("unknown outcome: err = %v, want ErrUnknownOutcome", err)
+	}
+	if _, _, err := fake.SignedEvent("pi_missing", EventSucceeded); !errors.Is(err, ErrUnknownIntent) {
+		t.Errorf("unknown intent: err = %v, want ErrUnknownIntent", err)
+	}
+}
+
+func TestSettleFakeGate(t *testing.T) {
+	ctx := context.Background()
+	customer := uuid.New()
+	stripe := &Service{provider: NewStripe("sk_test", "whsec_test", "http://127.0.0.1:0")}
+	if err := stripe.SettleFake(ctx, customer, true, "pi_1", EventSucceeded); !errors.Is(err, ErrFakeDisabled) {
+		t.Errorf("stripe provider: err = %v, want ErrFakeDisabled", err)
+	}
+	fake := &Service{provider: NewFake("whsec_test")}
+	if err := fake.SettleFake(ctx, customer, false, "pi_1", EventSucceeded); !errors.Is(err, ErrFakeDisabled) {
+		t.Errorf("customer without fake checkout: err = %v, want ErrFakeDisabled", err)
+	}
+}
@@ -0,0 +1,174 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/3dprint-hub/api/internal/config"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidEvent     = errors.New("invalid webhook payload")
+)
+
+// Normalised webhook event types. Provider events that do not map to one of
+// these are recorded and otherwise ignored.
+const (
+	EventSucceeded = "succeeded"
+	EventFailed    = "failed"
+	EventCanceled  = "canceled"
+)
+
+// signatureTolerance bounds how old a signed webhook may be, limiting replays.
+const signatureTolerance = 5 * time.Minute
+
+// Provider is a payment processor that collects money through payment
+// intents and reports the outcome by webhook.
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, input IntentInput) (*Intent, error)
+	CancelIntent(ctx context.Context, intentID string) error
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+type IntentInput struct {
+	OrderID     uuid.UUID
+	AmountCents int
+	Currency    string
+	// IdempotencyKey makes a retried create return the same intent.
+	IdempotencyKey string
+}
+
+type Intent struct {
+	ID           string
+	ClientSecret string
+}
+
+type Event struct {
+	ID             string
+	Type           string
+	IntentID       string
+	AmountCents    int
+	Currency       string
+	FailureMessage string
+}
+
+// NewProvider returns the provider selected by PAYMENT_PROVIDER.
+func NewProvider(cfg *config.Config, logger *slog.Logger) (Provider, error) {
+	if cfg.Payment.WebhookSecret == "" {
+		return nil, errors.New("payment webhook secret is required")
+	}
+	switch cfg.Payment.Provider {
+	case "stripe":
+		return NewStripe(cfg.Payment.StripeKey, cfg.Payment.WebhookSecret, cfg.Payment.StripeAPIBase), nil
+	case "fake":
+		logger.Warn("using the fake payment provider; no money will be collected")
+		fake := NewFake(cfg.Payment.WebhookSecret)
+		fake.CustomerCheckout = cfg.Payment.FakeCheckout
+		return fake, nil
+	}
+	return nil, fmt.Errorf("unknown payment provider %q", cfg.Payment.Provider)
+}
+
+// Webhooks are signed the way Stripe signs them: the Stripe-Signature header
+// carries a timestamp and one or more HMAC-SHA256 signatures of
+// "<timestamp>.<body>".
+func signPayload(payload []byte, secret string, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(signature(payload, secret, ts))
+}
+
+func signature(payload []byte, secret, ts string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func verifySignature(payload []byte, header, secret string, now time.Time) error {
+	var ts string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+	expected := signature(payload, secret, ts)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// stripeEvent is the subset of a Stripe event the service reads. The fake
+// provider emits the same shape.
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID               string `json:"id"`
+			Amount           int    `json:"amount"`
+			Currency         string `json:"currency"`
+			LastPaymentError *struct {
+				Message string `json:"message"`
+			} `json:"last_payment_error"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+var stripeEventTypes = map[string]string{
+	"payment_intent.succeeded":      EventSucceeded,
+	"payment_intent.payment_failed": EventFailed,
+	"payment_intent.canceled":       EventCanceled,
+}
+
+func parseStripeEvent(payload []byte) (*Event, error) {
+	var raw stripeEvent
+	if err := json.Unmarshal(payload, &raw); err != nil || raw.ID == "" {
+		return nil, ErrInvalidEvent
+	}
+	event := &Event{
+		ID:          raw.ID,
+		Type:        stripeEventTypes[raw.Type],
+		IntentID:    raw.Data.Object.ID,
+		AmountCents: raw.Data.Object.Amount,
+		Currency:    strings.ToUpper(raw.Data.Object.Currency),
+	}
+	if e := raw.Data.Object.LastPaymentError; e != nil {
+		event.FailureMessage = e.Message
+	}
+	return event, nil
+}
@@ -0,0 +1,309 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/order"
+)
+
+// Payment statuses. A failed payment can still succeed if the customer
+// retries the same intent, so only succeeded, needs_refund, canceled and
+// expired are final. needs_refund is money collected for an order that could
+// no longer be paid, such as one the sweeper cancelled before the payment
+// arrived; it waits for an admin to refund it.
+const (
+	StatusRequiresPayment = "requires_payment"
+	StatusSucceeded       = "succeeded"
+	StatusFailed          = "failed"
+	StatusCanceled        = "canceled"
+	StatusExpired         = "expired"
+	StatusNeedsRefund     = "needs_refund"
+)
+
+var openStatuses = []string{StatusRequiresPayment, StatusFailed}
+
+type Service struct {
+	db       *gorm.DB
+	logger   *slog.Logger
+	provider Provider
+	invoices Invoicer
+	ttl      time.Duration
+}
+
+// Invoicer numbers a paid order's invoice inside the payment transaction and
+// then sends the confirmation email with the invoice.
+type Invoicer interface {
+	Assign(tx *gorm.DB, order *database.Order) error
+	SendConfirmation(ctx context.Context, order *database.Order) error
+}
+
+// New builds the payment service. ttl is how long a customer has to pay
+// before the intent is cancelled and the order with it.
+func New(db *gorm.DB, logger *slog.Logger, provider Provider, invoices Invoicer, ttl time.Duration) *Service {
+	return &Service{db: db, logger: logger, provider: provider, invoices: invoices, ttl: ttl}
+}
+
+func (s *Service) Provider() Provider {
+	return s.provider
+}
+
+// StartPayment implements order.PaymentStarter.
+func (s *Service) StartPayment(ctx context.Context, o *database.Order) (*database.Payment, error) {
+	var existing database.Payment
+	err := s.db.WithContext(ctx).
+		Where("order_id = ? AND status IN ? AND expires_at > ?", o.ID, openStatuses, time.Now()).
+		Order("created_at DESC").
+		First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	payment := &database.Payment{
+		OrderID:     o.ID,
+		Provider:    s.provider.Name(),
+		AmountCents: o.TotalCents,
+		Currency:    o.Currency,
+		Status:      StatusRequiresPayment,
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+	payment.ID = uuid.New()
+	intent, err := s.provider.CreateIntent(ctx, IntentInput{
+		OrderID:        o.ID,
+		AmountCents:    o.TotalCents,
+		Currency:       o.Currency,
+		IdempotencyKey: payment.ID.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create payment intent: %w", err)
+	}
+	payment.ProviderIntentID = intent.ID
+	payment.ClientSecret = intent.ClientSecret
+	if err := s.db.WithContext(ctx).Create(payment).Error; err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// HandleWebhook verifies and applies one webhook delivery. Deliveries are
+// recorded by provider event id, so redeliveries are acknowledged without
+// being applied twice.
+func (s *Service) HandleWebhook(ctx context.Context, payload []byte, header http.Header) error {
+	event, err := s.provider.ParseWebhook(payload, header)
+	if err != nil {
+		return err
+	}
+	var paid *database.Order
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record := &database.PaymentEvent{
+			Provider:        s.provider.Name(),
+			ProviderEventID: event.ID,
+			Type:            event.Type,
+			Payload:         string(payload),
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || event.Type == "" {
+			return nil
+		}
+		var payment database.Payment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider_intent_id = ?", event.IntentID).
+			First(&payment).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warn("webhook for unknown payment intent", "intent", event.IntentID, "event", event.ID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(record).Update("payment_id", payment.ID).Error; err != nil {
+			return err
+		}
+		paid, err = s.apply(tx, &payment, event)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if paid != nil {
+		go s.safeSendConfirmation(paid.ID)
+	}
+	return nil
+}
+
+// SettleFake reports outcome for a fake-provider intent through the real
+// webhook path. Unless admin is set, customer checkout must be enabled on the
+// provider and the intent must belong to one of userID's orders.
+func (s *Service) SettleFake(ctx context.Context, userID uuid.UUID, admin bool, intentID, outcome string) error {
+	fake, ok := s.provider.(*Fake)
+	if !ok || (!admin && !fake.CustomerCheckout) {
+		return ErrFakeDisabled
+	}
+	query := s.db.WithContext(ctx).Model(&database.Payment{}).
+		Joins("JOIN orders ON orders.id = payments.order_id").
+		Where("payments.provider_intent_id = ?", intentID)
+	if !admin {
+		query = query.Where("orders.user_id = ?", userID)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUnknownIntent
+	}
+	payload, header, err := fake.SignedEvent(intentID, outcome)
+	if err != nil {
+		return err
+	}
+	return s.HandleWebhook(ctx, payload, header)
+}
+
+// apply records event against payment and returns the order it paid, if
+// any, with its invoice number assigned.
+func (s *Service) apply(tx *gorm.DB, payment *database.Payment, event *Event) (*database.Order, error) {
+	if payment.Status == StatusSucceeded || payment.Status == StatusNeedsRefund {
+		return nil, nil
+	}
+	var paid *database.Order
+	switch event.Type {
+	case EventSucceeded:
+		if event.AmountCents != payment.AmountCents || !strings.EqualFold(event.Currency, payment.Currency) {
+			s.logger.Error("payment amount or currency mismatch", "payment", payment.ID,
+				"expected", payment.AmountCents, "expectedCurrency", payment.Currency,
+				"received", event.AmountCents, "receivedCurrency", event.Currency)
+			payment.Status = StatusFailed
+			payment.FailureMessage = fmt.Sprintf("payment mismatch: expected %d %s, received %d %s",
+				payment.AmountCents, payment.Currency, event.AmountCents, event.Currency)
+			break
+		}
+		now := time.Now()
+		payment.Status = StatusSucceeded
+		payment.SucceededAt = &now
+		payment.FailureMessage = ""
+		o, err := order.Transition(tx, payment.OrderID, order.StatusPaid, order.SystemActor, "payment "+payment.ProviderIntentID)
+		if errors.Is(err, order.ErrIllegalTransition) {
+			// Money arrived for an order that is no longer pending, most
+			// likely one the sweeper already cancelled.
+			s.logger.Error("payment succeeded for an order that cannot be paid; refund required", "payment", payment.ID, "order", payment.OrderID, "err", err)
+			payment.Status = StatusNeedsRefund
+			payment.FailureMessage = "order can no longer be paid: " + err.Error()
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.invoices.Assign(tx, o); err != nil {
+			return nil, err
+		}
+		paid = o
+	case EventFailed:
+		payment.Status = StatusFailed
+		payment.FailureMessage = event.FailureMessage
+	case EventCanceled:
+		payment.Status = StatusCanceled
+	}
+	if err := tx.Save(payment).Error; err != nil {
+		return nil, err
+	}
+	return paid, nil
+}
+
+// List returns payments newest first, only those in status when it is set.
+func (s *Service) List(ctx context.Context, status string) ([]database.Payment, error) {
+	query := s.db.WithContext(ctx).Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var payments []database.Payment
+	if err := query.Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (s *Service) safeSendConfirmation(orderID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	var paid database.Order
+	if err := s.db.WithContext(ctx).Preload("Items").Where("id = ?", orderID).First(&paid).Error; err != nil {
+		s.logger.Warn("failed to load paid order", "order", orderID, "error", err)
+		return
+	}
+	if err := s.invoices.SendConfirmation(ctx, &paid); err != nil {
+		s.logger.Warn("failed to send order confirmation", "order", orderID, "error", err)
+	}
+}
+
+// Sweep expires payments nobody completed and cancels pending orders that
+// have been left without a usable payment for longer than the ttl.
+func (s *Service) Sweep(ctx context.Context) error {
+	now := time.Now()
+	var stale []database.Payment
+	if err := s.db.WithContext(ctx).
+		Where("status IN ? AND expires_at <= ?", openStatuses, now).
+		Find(&stale).Error; err != nil {
+		return err
+	}
+	for _, payment := range stale {
+		if err := s.provider.CancelIntent(ctx, payment.ProviderIntentID); err != nil {
+			s.logger.Warn("failed to cancel payment intent", "payment", payment.ID, "err", err)
+		}
+		if err := s.db.WithContext(ctx).Model(&database.Payment{}).
+			Where("id = ? AND status IN ?", payment.ID, openStatuses).
+			Update("status", StatusExpired).Error; err != nil {
+			return err
+		}
+	}
+
+	var abandoned []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&database.Order{}).
+		Where("status = ? AND placed_at <= ?", order.StatusPending, now.Add(-s.ttl)).
+		Where("NOT EXISTS (SELECT 1 FROM payments WHERE payments.order_id = orders.id AND payments.status IN ?)",
+			append([]string{StatusSucceeded}, openStatuses...)).
+		Pluck("id", &abandoned).Error; err != nil {
+		return err
+	}
+	for _, orderID := range abandoned {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			_, err := order.Transition(tx, orderID, order.StatusCancelled, order.SystemActor, "payment not completed")
+			return err
+		})
+		if err != nil && !errors.Is(err, order.ErrIllegalTransition) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run sweeps every interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sweep(ctx); err != nil {
+				s.logger.Error("payment sweep failed", "err", err)
+			}
+		}
+	}
+}
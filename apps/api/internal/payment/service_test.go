@@ -0,0 +1,101 @@
+package payment
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/order"
+)
+
+// newTestService returns a service on the fake provider, backed by the
+// Postgres database named by TEST_POSTGRES_DSN, skipping the test when it is
+// unset.
+func newTestService(t *testing.T) (*Service, *Fake, *gorm.DB) {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	db, err := database.New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	fake := NewFake("whsec_test")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return New(db, logger, fake, noInvoices{}, time.Minute), fake, db
+}
+
+type noInvoices struct{}
+
+func (noInvoices) Assign(*gorm.DB, *database.Order) error                  { return nil }
+func (noInvoices) SendConfirmation(context.Context, *database.Order) error { return nil }
+
+func TestSuccessAfterSweepNeedsRefund(t *testing.T) {
+	s, fake, db := newTestService(t)
+	ctx := context.Background()
+	user := database.User{Email: "test-" + uuid.NewString() + "@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	placed := time.Now().Add(-time.Hour)
+	o := database.Order{UserID: user.ID, Status: order.StatusPending, TotalCents: 1999, Currency: "USD", PlacedAt: &placed}
+	if err := db.Create(&o).Error; err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.StartPayment(ctx, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the customer is too slow: the payment expires and the order is swept
+	if err := db.Model(p).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	payload, header, err := fake.SignedEvent(p.ProviderIntentID, EventSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.HandleWebhook(ctx, payload, header); err != nil {
+		t.Fatal(err)
+	}
+
+	var got database.Payment
+	if err := db.First(&got, "id = ?", p.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusNeedsRefund {
+		t.Errorf("payment status = %q, want %q", got.Status, StatusNeedsRefund)
+	}
+	var swept database.Order
+	if err := db.First(&swept, "id = ?", o.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if swept.Status != order.StatusCancelled {
+		t.Errorf("order status = %q, want %q", swept.Status, order.StatusCancelled)
+	}
+	listed, err := s.List(ctx, StatusNeedsRefund)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, l := range listed {
+		found = found || l.ID == p.ID
+	}
+	if !found {
+		t.Error("payment missing from the needs_refund list")
+	}
+}
@@ -0,0 +1,89 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stripe talks to the Stripe payment intents API, or anything that speaks
+// it, over plain HTTP.
+type Stripe struct {
+	secretKey     string
+	webhookSecret string
+	baseURL       string
+	client        *http.Client
+}
+
+func NewStripe(secretKey, webhookSecret, baseURL string) *Stripe {
+	return &Stripe{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (s *Stripe) Name() string { return "stripe" }
+
+func (s *Stripe) CreateIntent(ctx context.Context, input IntentInput) (*Intent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.Itoa(input.AmountCents))
+	form.Set("currency", strings.ToLower(input.Currency))
+	form.Set("automatic_payment_methods[enabled]", "true")
+	form.Set("metadata[order_id]", input.OrderID.String())
+	var out struct {
+		ID           string `json:"id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := s.post(ctx, "/v1/payment_intents", form, input.IdempotencyKey, &out); err != nil {
+		return nil, err
+	}
+	return &Intent{ID: out.ID, ClientSecret: out.ClientSecret}, nil
+}
+
+func (s *Stripe) CancelIntent(ctx context.Context, intentID string) error {
+	return s.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentID)+"/cancel", url.Values{}, "", nil)
+}
+
+func (s *Stripe) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := verifySignature(payload, header.Get("Stripe-Signature"), s.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+	return parseStripeEvent(payload)
+}
+
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("stripe %s: %s: %s", path, resp.Status, body.Error.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
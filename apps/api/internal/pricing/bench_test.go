@@ -0,0 +1,134 @@
+package pricing
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// benchSphere builds a closed UV sphere of radius 40 mm with roughly
+// 2*rings*segments triangles, wound outwards.
+func benchSphere(rings, segments int) ([][3]float64, [][3]int) {
+	const r = 40.0
+	verts := [][3]float64{{0, 0, r}}
+	for i := 1; i < rings; i++ {
+		phi := math.Pi * float64(i) / float64(rings)
+		for j := 0; j < segments; j++ {
+			theta := 2 * math.Pi * float64(j) / float64(segments)
+			verts = append(verts, [3]float64{
+				r * math.Sin(phi) * math.Cos(theta),
+				r * math.Sin(phi) * math.Sin(theta),
+				r * math.Cos(phi),
+			})
+		}
+	}
+	verts = append(verts, [3]float64{0, 0, -r})
+	south := len(verts) - 1
+	ring := func(i, j int) int { return 1 + (i-1)*segments + (j % segments) }
+
+	var tris [][3]int
+	for j := 0; j < segments; j++ {
+		tris = append(tris, [3]int{0, ring(1, j), ring(1, j+1)})
+	}
+	for i := 1; i < rings-1; i++ {
+		for j := 0; j < segments; j++ {
+			a, b := ring(i, j), ring(i, j+1)
+			c, d := ring(i+1, j), ring(i+1, j+1)
+			tris = append(tris, [3]int{a, c, d}, [3]int{a, d, b})
+		}
+	}
+	for j := 0; j < segments; j++ {
+		tris = append(tris, [3]int{south, ring(rings-1, j+1), ring(rings-1, j)})
+	}
+	return verts, tris
+}
+
+func benchBinarySTL(verts [][3]float64, tris [][3]int) []byte {
+	buf := make([]byte, stlHeaderBytes, stlHeaderBytes+stlRecordBytes*len(tris))
+	binary.LittleEndian.PutUint32(buf[80:], uint32(len(tris)))
+	var rec [stlRecordBytes]byte
+	for _, t := range tris {
+		for j, idx := range t {
+			for k := 0; k < 3; k++ {
+				binary.LittleEndian.PutUint32(rec[12+j*12+k*4:], math.Float32bits(float32(verts[idx][k])))
+			}
+		}
+		buf = append(buf, rec[:]...)
+	}
+	return buf
+}
+
+func benchASCIISTL(verts [][3]float64, tris [][3]int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("solid bench\n")
+	for _, t := range tris {
+		buf.WriteString("facet normal 0 0 0\n outer loop\n")
+		for _, idx := range t {
+			v := verts[idx]
+			fmt.Fprintf(&buf, "  vertex %g %g %g\n", v[0], v[1], v[2])
+		}
+		buf.WriteString(" endloop\nendfacet\n")
+	}
+	buf.WriteString("endsolid bench\n")
+	return buf.Bytes()
+}
+
+func benchOBJ(verts [][3]float64, tris [][3]int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("o sphere\n")
+	for _, v := range verts {
+		fmt.Fprintf(&buf, "v %g %g %g\n", v[0], v[1], v[2])
+	}
+	for _, t := range tris {
+		fmt.Fprintf(&buf, "f %d/%d %d/%d %d/%d\n", t[0]+1, t[0]+1, t[1]+1, t[1]+1, t[2]+1, t[2]+1)
+	}
+	return buf.Bytes()
+}
+
+func bench3MF(verts [][3]float64, tris [][3]int) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("3D/3dmodel.model")
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="millimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">
+<resources><object id="1" type="model"><mesh><vertices>`)
+	for _, v := range verts {
+		fmt.Fprintf(w, `<vertex x="%g" y="%g" z="%g"/>`, v[0], v[1], v[2])
+	}
+	fmt.Fprint(w, `</vertices><triangles>`)
+	for _, t := range tris {
+		fmt.Fprintf(w, `<triangle v1="%d" v2="%d" v3="%d"/>`, t[0], t[1], t[2])
+	}
+	fmt.Fprint(w, `</triangles></mesh></object></resources><build><item objectid="1"/></build></model>`)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func benchmarkEstimate(b *testing.B, name string, encode func([][3]float64, [][3]int) []byte) {
+	verts, tris := benchSphere(256, 512) // ~260k triangles
+	data := encode(verts, tris)
+	svc := NewService(Options{MaterialCostPLA: 0.12, MachineRate: 12.5, SetupFee: 4.5, PrintSpeed: 5500})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		est, err := svc.Estimate(ctx, name, bytes.NewReader(data), int64(len(data)), EstimateInput{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if est.Confidence == "low" {
+			b.Fatalf("%s: geometry not parsed: %v", name, est.Warnings)
+		}
+	}
+}
+
+func BenchmarkEstimateBinarySTL(b *testing.B) { benchmarkEstimate(b, "bench.stl", benchBinarySTL) }
+func BenchmarkEstimateASCIISTL(b *testing.B)  { benchmarkEstimate(b, "bench.stl", benchASCIISTL) }
+func BenchmarkEstimateOBJ(b *testing.B)       { benchmarkEstimate(b, "bench.obj", benchOBJ) }
+func BenchmarkEstimate3MF(b *testing.B)       { benchmarkEstimate(b, "bench.3mf", bench3MF) }
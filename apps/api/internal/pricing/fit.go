@@ -0,0 +1,194 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Printer is a machine profile the estimator can assign parts to.
+type Printer struct {
+	ID            uuid.UUID
+	Name          string
+	BuildVolumeMM [3]float64
+	NozzleMM      float64
+	Materials     []string
+	HourlyRate    float64
+}
+
+// PrinterCatalog supplies the printers currently in service.
+type PrinterCatalog interface {
+	ActivePrinters(ctx context.Context) ([]Printer, error)
+}
+
+// PrinterFit is a printer that can take the part, and the axis-aligned
+// orientation it fits in. Orientation[i] is the part axis laid along printer
+// axis i. When the print orientation was chosen from the mesh, the axes are
+// those of that orientation (0 and 1 across the bed, 2 up); otherwise they
+// are the model's (0 = X, 1 = Y, 2 = Z).
+type PrinterFit struct {
+	PrinterID        uuid.UUID `json:"printerId"`
+	Name             string    `json:"name"`
+	Orientation      [3]int    `json:"orientation"`
+	Materials        []string  `json:"materials"`
+	SupportsMaterial bool      `json:"supportsMaterial"`
+	HourlyRate       float64   `json:"hourlyRate"`
+}
+
+type FitReport struct {
+	Fits          bool         `json:"fits"`
+	RequiresSplit bool         `json:"requiresSplit"`
+	Printers      []PrinterFit `json:"printers"`
+}
+
+// orientations lists the six axis permutations, upright first.
+var orientations = [6][3]int{
+	{0, 1, 2}, {1, 0, 2},
+	{0, 2, 1}, {2, 0, 1},
+	{1, 2, 0}, {2, 1, 0},
+}
+
+func (s *Service) activePrinters(ctx context.Context) ([]Printer, error) {
+	if s.opts.Printers == nil {
+		return nil, nil
+	}
+	return s.opts.Printers.ActivePrinters(ctx)
+}
+
+// checkFit reports the printers that take a part with bounding box bb in any
+// axis-aligned orientation.
+func (s *Service) checkFit(ctx context.Context, bb BoundingBox, material Material) (*FitReport, error) {
+	printers, err := s.activePrinters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dims := bb.dims()
+	return fitReport(printers, material, func(volume [3]float64) ([3]int, bool) {
+		return fitOrientation(dims, volume)
+	}), nil
+}
+
+// orient chooses the print orientation for g, preferring the least support
+// among the orientations that fit at least one printer, and reports the
+// printers that take the part laid that way. Without scored orientations the
+// bounding box is checked instead.
+func orient(g *geometry, printers []Printer, material Material) *FitReport {
+	if len(g.orientations) == 0 {
+		dims := g.BoundingBox.dims()
+		return fitReport(printers, material, func(volume [3]float64) ([3]int, bool) {
+			return fitOrientation(dims, volume)
+		})
+	}
+	g.Orientation = bestOrientation(g.orientations, func(o *orientationResult) bool {
+		for _, p := range printers {
+			if _, ok := o.placeIn(p.BuildVolumeMM); ok {
+				return true
+			}
+		}
+		return false
+	})
+	if g.Orientation == nil {
+		// no printer takes the part, or there are none to check
+		g.Orientation = bestOrientation(g.orientations, nil)
+	}
+	return fitReport(printers, material, g.Orientation.placeIn)
+}
+
+// fitReport lists the printers place finds room in. It is nil when there are
+// no printers to check against.
+func fitReport(printers []Printer, material Material, place func(volume [3]float64) ([3]int, bool)) *FitReport {
+	if len(printers) == 0 {
+		return nil
+	}
+	report := &FitReport{}
+	for _, p := range printers {
+		orientation, ok := place(p.BuildVolumeMM)
+		if !ok {
+			continue
+		}
+		report.Printers = append(report.Printers, PrinterFit{
+			PrinterID:        p.ID,
+			Name:             p.Name,
+			Orientation:      orientation,
+			Materials:        p.Materials,
+			SupportsMaterial: supportsMaterial(p.Materials, material.Code),
+			HourlyRate:       p.HourlyRate,
+		})
+	}
+	report.Fits = len(report.Printers) > 0
+	report.RequiresSplit = !report.Fits
+	return report
+}
+
+func (bb BoundingBox) dims() [3]float64 {
+	return [3]float64{bb.Max[0] - bb.Min[0], bb.Max[1] - bb.Min[1], bb.Max[2] - bb.Min[2]}
+}
+
+func fitOrientation(dims, volume [3]float64) ([3]int, bool) {
+	for _, o := range orientations {
+		if dims[o[0]] <= volume[0] && dims[o[1]] <= volume[1] && dims[o[2]] <= volume[2] {
+			return o, true
+		}
+	}
+	return [3]int{}, false
+}
+
+// placeIn reports whether the part laid this way fits a build volume, turned
+// a quarter turn on the bed if that helps.
+func (o *orientationResult) placeIn(volume [3]float64) ([3]int, bool) {
+	if o.heightMM > volume[2] {
+		return [3]int{}, false
+	}
+	a, b := o.footprintMM[0], o.footprintMM[1]
+	switch {
+	case a <= volume[0] && b <= volume[1]:
+		return [3]int{0, 1, 2}, true
+	case b <= volume[0] && a <= volume[1]:
+		return [3]int{1, 0, 2}, true
+	}
+	return [3]int{}, false
+}
+
+func supportsMaterial(materials []string, code string) bool {
+	for _, m := range materials {
+		if strings.EqualFold(m, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// machineRateFor returns the hourly rate of the cheapest printer that fits
+// the part and runs the material, or the configured default.
+func (s *Service) machineRateFor(fit *FitReport, material Material) float64 {
+	rate := 0.0
+	if fit != nil {
+		for _, p := range fit.Printers {
+			if p.HourlyRate > 0 && (rate == 0 || p.HourlyRate < rate) && supportsMaterial(p.Materials, material.Code) {
+				rate = p.HourlyRate
+			}
+		}
+	}
+	if rate == 0 {
+		rate = s.opts.MachineRate
+	}
+	return rate * material.MachineRateMultiplier
+}
+
+func fitWarnings(fit *FitReport, bb BoundingBox, material Material) []string {
+	if fit == nil {
+		return nil
+	}
+	if !fit.Fits {
+		return []string{fmt.Sprintf("At %.0f x %.0f x %.0f mm the part does not fit any of our printers in any orientation; it must be split into pieces.",
+			bb.Max[0]-bb.Min[0], bb.Max[1]-bb.Min[1], bb.Max[2]-bb.Min[2])}
+	}
+	for _, p := range fit.Printers {
+		if p.SupportsMaterial {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("None of the printers large enough for this part can print %s.", material.Name)}
+}
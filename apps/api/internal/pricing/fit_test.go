@@ -0,0 +1,45 @@
+package pricing
+
+import "testing"
+
+func TestOrientChoosesAnOrientationThatFits(t *testing.T) {
+	// a 200 x 20 x 20 mm bar, which lies flat unless the printer is too small
+	bar := cubeTriangles([3]float64{0, 0, 0}, 20)
+	for i, tri := range bar {
+		for j := range tri {
+			bar[i][j][0] *= 10
+		}
+	}
+	tests := []struct {
+		name     string
+		volume   [3]float64
+		fits     bool
+		heightMM float64
+	}{
+		{"lies flat", [3]float64{250, 250, 250}, true, 20},
+		{"stands up on a narrow bed", [3]float64{100, 100, 250}, true, 200},
+		{"fits nowhere", [3]float64{100, 100, 100}, false, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesh := newMeshBuilder(unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}, 0)
+			for _, tri := range bar {
+				mesh.add(tri[0], tri[1], tri[2])
+			}
+			g := mesh.geometry("high")
+			g.orientations = mesh.scoreOrientations(defaultSupportAngleDeg)
+			fit := orient(&g, []Printer{{Name: "test", BuildVolumeMM: tt.volume}}, Material{Code: "PLA"})
+			if fit == nil || fit.Fits != tt.fits {
+				t.Fatalf("fit = %+v, want fits = %v", fit, tt.fits)
+			}
+			if g.Orientation == nil || g.Orientation.heightMM != tt.heightMM {
+				t.Fatalf("orientation = %+v, want height %g mm", g.Orientation, tt.heightMM)
+			}
+			if tt.fits {
+				if _, ok := g.Orientation.placeIn(tt.volume); !ok {
+					t.Errorf("chosen orientation %s does not fit the printer", g.Orientation.candidate.name)
+				}
+			}
+		})
+	}
+}
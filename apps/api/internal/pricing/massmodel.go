@@ -0,0 +1,119 @@
+package pricing
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrInvalidInfill = errors.New("infill must be between 0 and 100")
+
+const (
+	processFDM = "fdm"
+	processSLA = "sla"
+
+	// wallSpeedFactor slows perimeters relative to infill, as the slicer does.
+	wallSpeedFactor = 0.7
+	// layerChangeSeconds covers travel, retraction and z-hop per layer.
+	layerChangeSeconds = 6.0
+	// purgeMargin accounts for skirt, priming and ooze.
+	purgeMargin = 1.03
+)
+
+// SlicerSettings mirrors the slicer profile the farm prints with.
+type SlicerSettings struct {
+	InfillPercent int     `json:"infillPercent"`
+	WallCount     int     `json:"wallCount"`
+	TopLayers     int     `json:"topLayers"`
+	BottomLayers  int     `json:"bottomLayers"`
+	LineWidthMM   float64 `json:"lineWidthMm"`
+	LayerHeightMM float64 `json:"layerHeightMm"`
+}
+
+func defaultSlicer(opts Options) SlicerSettings {
+	s := SlicerSettings{
+		WallCount:    opts.WallCount,
+		TopLayers:    opts.TopLayers,
+		BottomLayers: opts.BottomLayers,
+		LineWidthMM:  opts.LineWidthMM,
+	}
+	if s.WallCount <= 0 {
+		s.WallCount = 3
+	}
+	if s.TopLayers <= 0 {
+		s.TopLayers = 4
+	}
+	if s.BottomLayers <= 0 {
+		s.BottomLayers = 4
+	}
+	if s.LineWidthMM <= 0 {
+		s.LineWidthMM = 0.45
+	}
+	return s
+}
+
+// massModel is the outcome of slicing a part with a given profile.
+type massModel struct {
+	Grams            float64
+	Hours            float64
+	ShellVolumeCM3   float64
+	InfillVolumeCM3  float64
+	PrintedVolumeCM3 float64
+}
+
+// recommendedInfill picks a default infill from solid volume: small parts get
+// denser infill for strength, large parts lighter infill to save time.
+func recommendedInfill(g geometry) int {
+	switch {
+	case g.VolumeCM3 > 90:
+		return 15
+	case g.VolumeCM3 < 25:
+		return 25
+	default:
+		return 20
+	}
+}
+
+// slice splits the part into perimeter walls, top/bottom skins and sparse
+// infill. The average cross-section (volume / height) stands in for the
+// footprint of the top and bottom skins.
+func (s *Service) slice(g geometry, material Material, quality QualityProfile, settings SlicerSettings) massModel {
+	if g.VolumeCM3 == 0 {
+		// fallback heuristic using bounding box diagonal
+		grams := math.Max(8, diagonal(g.BoundingBox)*0.9)
+		return massModel{Grams: grams, Hours: grams / 12.0 * quality.TimeMultiplier}
+	}
+	volume := g.VolumeCM3 * 1000 // mm3
+	area := g.SurfaceArea * 100  // mm2
+	height := g.buildHeight()
+	layerHeight := settings.LayerHeightMM
+	if layerHeight <= 0 {
+		layerHeight = quality.LayerHeightMM
+	}
+
+	shell := volume
+	if material.Process != processSLA && height > 0 {
+		footprint := volume / height
+		skinArea := math.Min(2*footprint, area/2)
+		sideArea := math.Max(area-skinArea, 0)
+		walls := sideArea * float64(settings.WallCount) * settings.LineWidthMM
+		skins := footprint * float64(settings.TopLayers+settings.BottomLayers) * layerHeight
+		shell = math.Min(volume, walls+skins)
+	}
+	infill := (volume - shell) * float64(settings.InfillPercent) / 100
+	printed := shell + infill
+	grams := math.Max(8, printed/1000*material.Density*purgeMargin)
+
+	hours := grams / 12.0 * quality.TimeMultiplier
+	if s.opts.PrintSpeed > 0 {
+		rate := s.opts.PrintSpeed / quality.TimeMultiplier // mm3/h
+		layers := math.Ceil(height / layerHeight)
+		hours = shell/(rate*wallSpeedFactor) + infill/rate + layers*layerChangeSeconds/3600
+	}
+	return massModel{
+		Grams:            grams,
+		Hours:            hours,
+		ShellVolumeCM3:   shell / 1000,
+		InfillVolumeCM3:  infill / 1000,
+		PrintedVolumeCM3: printed / 1000,
+	}
+}
@@ -0,0 +1,97 @@
+package pricing
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnknownMaterial     = errors.New("unknown material")
+	ErrMaterialUnavailable = errors.New("material currently unavailable")
+	ErrUnknownQuality      = errors.New("unknown quality profile")
+)
+
+const (
+	DefaultMaterial = "PLA"
+	DefaultQuality  = "standard"
+)
+
+type Material struct {
+	Code                  string  `json:"code"`
+	Name                  string  `json:"name"`
+	Density               float64 `json:"density"`     // g/cm3
+	CostPerGram           float64 `json:"costPerGram"` // USD
+	MachineRateMultiplier float64 `json:"machineRateMultiplier"`
+	Process               string  `json:"process"` // fdm or sla
+	Available             bool    `json:"available"`
+}
+
+type QualityProfile struct {
+	Code            string  `json:"code"`
+	Name            string  `json:"name"`
+	LayerHeightMM   float64 `json:"layerHeightMm"`
+	TimeMultiplier  float64 `json:"timeMultiplier"`
+	PriceMultiplier float64 `json:"priceMultiplier"`
+}
+
+// DefaultMaterials is the stock catalog. costPLA replaces the PLA cost per
+// gram when positive so PRICING_MATERIAL_COST_PLA keeps working.
+func DefaultMaterials(costPLA float64) []Material {
+	if costPLA <= 0 {
+		costPLA = 0.12
+	}
+	return []Material{
+		{Code: "PLA", Name: "PLA", Density: 1.24, CostPerGram: costPLA, MachineRateMultiplier: 1.0, Process: processFDM, Available: true},
+		{Code: "PETG", Name: "PETG", Density: 1.27, CostPerGram: 0.14, MachineRateMultiplier: 1.05, Process: processFDM, Available: true},
+		{Code: "ABS", Name: "ABS", Density: 1.04, CostPerGram: 0.14, MachineRateMultiplier: 1.15, Process: processFDM, Available: true},
+		{Code: "ASA", Name: "ASA", Density: 1.07, CostPerGram: 0.16, MachineRateMultiplier: 1.15, Process: processFDM, Available: true},
+		{Code: "TPU", Name: "TPU 95A", Density: 1.21, CostPerGram: 0.22, MachineRateMultiplier: 1.6, Process: processFDM, Available: true},
+		{Code: "NYLON", Name: "Nylon (PA12)", Density: 1.01, CostPerGram: 0.28, MachineRateMultiplier: 1.35, Process: processFDM, Available: true},
+		{Code: "RESIN", Name: "Standard resin", Density: 1.15, CostPerGram: 0.30, MachineRateMultiplier: 1.2, Process: processSLA, Available: true},
+	}
+}
+
+func DefaultQualities() []QualityProfile {
+	return []QualityProfile{
+		{Code: "draft", Name: "Draft (0.28 mm)", LayerHeightMM: 0.28, TimeMultiplier: 0.75, PriceMultiplier: 0.9},
+		{Code: "standard", Name: "Standard (0.20 mm)", LayerHeightMM: 0.2, TimeMultiplier: 1.0, PriceMultiplier: 1.0},
+		{Code: "fine", Name: "Fine (0.12 mm)", LayerHeightMM: 0.12, TimeMultiplier: 1.6, PriceMultiplier: 1.15},
+	}
+}
+
+// Materials returns the configured material catalog.
+func (s *Service) Materials() []Material {
+	return append([]Material(nil), s.materials...)
+}
+
+// Qualities returns the configured quality profiles.
+func (s *Service) Qualities() []QualityProfile {
+	return append([]QualityProfile(nil), s.qualities...)
+}
+
+func (s *Service) material(code string) (Material, error) {
+	if code == "" {
+		code = DefaultMaterial
+	}
+	for _, m := range s.materials {
+		if strings.EqualFold(m.Code, code) {
+			if !m.Available {
+				return Material{}, ErrMaterialUnavailable
+			}
+			return m, nil
+		}
+	}
+	return Material{}, ErrUnknownMaterial
+}
+
+func (s *Service) quality(code string) (QualityProfile, error) {
+	if code == "" {
+		code = DefaultQuality
+	}
+	for _, q := range s.qualities {
+		if strings.EqualFold(q.Code, code) {
+			return q, nil
+		}
+	}
+	return QualityProfile{}, ErrUnknownQuality
+}
@@ -0,0 +1,114 @@
+package pricing
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+// TestEstimateMemoryBounded checks that analysing a model allocates no more
+// than the configured budget plus a fixed allowance for read buffers, both
+// for a model that fits and one that has to be truncated. encoding/xml
+// allocates a short-lived token per element, so 3MF is held to the budget in
+// peak heap rather than in total allocation.
+func TestEstimateMemoryBounded(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a large model")
+	}
+	const (
+		budget = 8 << 20
+		slack  = 1 << 20
+	)
+	formats := []struct {
+		name    string
+		encode  func([][3]float64, [][3]int) []byte
+		measure func(func()) uint64
+	}{
+		{"model.stl", benchBinarySTL, measureAlloc},
+		{"model.stl", benchASCIISTL, measureAlloc},
+		{"model.obj", benchOBJ, measureAlloc},
+		{"model.3mf", bench3MF, measurePeakHeap},
+	}
+	sizes := []struct {
+		name      string
+		rings     int
+		segments  int
+		truncated bool
+	}{
+		{"fits", 64, 128, false},      // ~16k triangles
+		{"truncated", 256, 512, true}, // ~260k triangles
+	}
+	svc := NewService(Options{MaterialCostPLA: 0.12, MachineRate: 12.5, SetupFee: 4.5, PrintSpeed: 5500, MaxAnalysisBytes: budget})
+	for _, size := range sizes {
+		verts, tris := benchSphere(size.rings, size.segments)
+		for _, format := range formats {
+			data := format.encode(verts, tris)
+			var est *Estimate
+			var err error
+			allocated := format.measure(func() {
+				est, err = svc.Estimate(context.Background(), format.name, bytes.NewReader(data), int64(len(data)), EstimateInput{})
+			})
+			if err != nil {
+				t.Fatalf("%s/%s: %v", size.name, format.name, err)
+			}
+			if allocated > budget+slack {
+				t.Errorf("%s/%s: allocated %d MB, budget %d MB", size.name, format.name, allocated>>20, budget>>20)
+			}
+			if got := est.MeshHealth == nil; got != size.truncated {
+				t.Errorf("%s/%s: health skipped = %v, want %v", size.name, format.name, got, size.truncated)
+			}
+			if est.TriangleCount != len(tris) {
+				t.Errorf("%s/%s: %d triangles, want %d", size.name, format.name, est.TriangleCount, len(tris))
+			}
+		}
+	}
+}
+
+// measureAlloc returns the bytes allocated on the heap while fn runs, which
+// bounds the peak it reached.
+func measureAlloc(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// measurePeakHeap returns the most the heap grew by while fn ran. The
+// collector runs far more often than usual so that short-lived garbage
+// barely counts, and the heap is sampled from another goroutine.
+func measurePeakHeap(fn func()) uint64 {
+	defer debug.SetGCPercent(debug.SetGCPercent(5))
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var m runtime.MemStats
+		var most uint64
+		tick := time.NewTicker(time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				peak <- most
+				return
+			case <-tick.C:
+				runtime.ReadMemStats(&m)
+				most = max(most, m.HeapAlloc)
+			}
+		}
+	}()
+	fn()
+	close(done)
+	most := <-peak
+	if most < before.HeapAlloc {
+		return 0
+	}
+	return most - before.HeapAlloc
+}
@@ -0,0 +1,780 @@
+package pricing
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	// weldToleranceMM is how close two corners must be to become one vertex.
+	weldToleranceMM = 1e-4
+	// weldCellMM is the size of the grid cells corners are sorted into
+	// while welding. A few times the tolerance keeps most corners clear of
+	// a cell's edge, where the neighbouring cells have to be searched too.
+	weldCellMM = 4 * weldToleranceMM
+	// degenerateAreaMM2 is the area below which a triangle is treated as
+	// having collapsed to a line or a point.
+	degenerateAreaMM2 = 1e-9
+
+	// DefaultMaxAnalysisBytes is the analysis memory budget used when none
+	// is configured.
+	DefaultMaxAnalysisBytes = 64 << 20
+
+	// triangleCostBytes is the most the builder holds per kept triangle at
+	// any point: its corners, then the sort keys, indexed faces, the
+	// union-find over welded positions and the vertices while welding, then
+	// the edge list and face adjacency while validating.
+	triangleCostBytes = 116
+	// listVertexBytes is the cost of one entry in an indexed format's vertex
+	// list: a single-precision position plus a key while duplicates are
+	// counted.
+	listVertexBytes = 20
+)
+
+// errModelTooLarge means an indexed format's vertex list alone does not fit
+// the analysis budget, or a 3MF build places more copies than it allows.
+var errModelTooLarge = errors.New("model too large to analyse")
+
+// MeshHealth summarises the mesh validation pass.
+type MeshHealth struct {
+	Vertices            int  `json:"vertices"`
+	Edges               int  `json:"edges"`
+	NonManifoldEdges    int  `json:"nonManifoldEdges"`
+	BoundaryEdges       int  `json:"boundaryEdges"`
+	FlippedNormals      int  `json:"flippedNormals"`
+	InvertedShells      int  `json:"invertedShells"`
+	DegenerateTriangles int  `json:"degenerateTriangles"`
+	DuplicateVertices   int  `json:"duplicateVertices"`
+	Shells              int  `json:"shells"`
+	Watertight          bool `json:"watertight"`
+}
+
+// Printable reports whether the mesh can be sliced without repair.
+func (h MeshHealth) Printable() bool {
+	return h.Watertight && h.FlippedNormals == 0 && h.InvertedShells == 0
+}
+
+// Warnings describes each problem in customer-facing terms.
+func (h MeshHealth) Warnings() []string {
+	var out []string
+	if h.BoundaryEdges > 0 {
+		out = append(out, fmt.Sprintf("Mesh is not closed: %d open boundary edges. Volume and price may be inaccurate.", h.BoundaryEdges))
+	}
+	if h.NonManifoldEdges > 0 {
+		out = append(out, fmt.Sprintf("Mesh has %d non-manifold edges shared by more than two faces.", h.NonManifoldEdges))
+	}
+	if h.FlippedNormals > 0 {
+		out = append(out, fmt.Sprintf("%d triangles have flipped normals.", h.FlippedNormals))
+	}
+	if h.InvertedShells > 0 {
+		out = append(out, fmt.Sprintf("%d shells are inside out, with every normal pointing inwards.", h.InvertedShells))
+	}
+	if h.DegenerateTriangles > 0 {
+		out = append(out, fmt.Sprintf("%d degenerate (zero-area) triangles were ignored.", h.DegenerateTriangles))
+	}
+	if h.DuplicateVertices > 0 {
+		out = append(out, fmt.Sprintf("%d duplicate vertices were merged.", h.DuplicateVertices))
+	}
+	if h.Shells > 1 {
+		out = append(out, fmt.Sprintf("Model contains %d separate shells; each will be printed as its own part.", h.Shells))
+	}
+	return out
+}
+
+// meshStats accumulates triangle count, bounds, signed volume and area.
+type meshStats struct {
+	triangles int
+	min       [3]float64
+	max       [3]float64
+	volume    float64
+	area      float64
+}
+
+func newMeshStats() meshStats {
+	return meshStats{
+		min: [3]float64{math.MaxFloat64, math.MaxFloat64, math.MaxFloat64},
+		max: [3]float64{-math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64},
+	}
+}
+
+func (m *meshStats) add(a, b, c [3]float64) {
+	for _, v := range [3][3]float64{a, b, c} {
+		for i := 0; i < 3; i++ {
+			m.min[i] = math.Min(m.min[i], v[i])
+			m.max[i] = math.Max(m.max[i], v[i])
+		}
+	}
+	m.volume += signedVolumeOfTriangle(a, b, c)
+	m.area += triangleArea(a, b, c)
+	m.triangles++
+}
+
+// ObjectSummary measures one named object or group within a file.
+type ObjectSummary struct {
+	Name           string      `json:"name"`
+	TriangleCount  int         `json:"triangleCount"`
+	BoundingBoxMM  BoundingBox `json:"boundingBoxMm"`
+	VolumeCM3      float64     `json:"volumeCm3"`
+	SurfaceAreaCM2 float64     `json:"surfaceAreaCm2"`
+}
+
+type meshGroup struct {
+	name  string
+	stats meshStats
+}
+
+// meshBuilder feeds every parsed triangle into the running stats and keeps
+// its corners for the validation pass. Vertices are welded and edges matched
+// by sorting once the file has been read, which needs far less memory than
+// maintaining hash maps while parsing.
+type meshBuilder struct {
+	units unitScale
+	stats meshStats
+	// corners holds kept triangles in fixed-size chunks, so growing it never
+	// copies what is already stored.
+	corners [][]triangle32
+	kept    int
+	// vertices and faces are filled in by weld.
+	vertices [][3]float64
+	faces    [][3]uint32
+
+	groups []meshGroup
+	group  int
+
+	// visit, when set, receives each triangle instead of it being kept.
+	visit func(a, b, c [3]float64)
+
+	// budget bounds the bytes held for validation plus the vertex list a
+	// parser is holding (listBytes). Past it the kept triangles are dropped,
+	// only the running stats are updated and truncated is set.
+	budget    int64
+	listBytes int64
+	truncated bool
+
+	degenerate int
+	duplicates int
+}
+
+type triangle32 [3][3]float32
+
+const chunkTriangles = 1 << 14
+
+// newMeshBuilder returns a builder that holds at most about budget bytes;
+// zero means DefaultMaxAnalysisBytes.
+func newMeshBuilder(units unitScale, budget int64) *meshBuilder {
+	if budget <= 0 {
+		budget = DefaultMaxAnalysisBytes
+	}
+	return &meshBuilder{
+		units:  units,
+		budget: budget,
+		stats:  newMeshStats(),
+		group:  -1,
+	}
+}
+
+// usage is the most the builder and the parser's vertex list will hold once
+// the kept triangles are validated.
+func (b *meshBuilder) usage() int64 {
+	return b.listBytes + int64(b.kept)*triangleCostBytes
+}
+
+// holdVertices tells the builder the parser is holding an indexed vertex list
+// of n entries. The list cannot be dropped like the kept triangles, so a list
+// that does not fit the budget on its own is an error.
+func (b *meshBuilder) holdVertices(n int) error {
+	b.listBytes = int64(n) * listVertexBytes
+	if b.listBytes > b.budget {
+		return errModelTooLarge
+	}
+	if b.usage() > b.budget {
+		b.truncate()
+	}
+	return nil
+}
+
+// truncate drops the kept triangles rather than validate a partial mesh.
+func (b *meshBuilder) truncate() {
+	b.truncated = true
+	b.corners, b.kept = nil, 0
+}
+
+// beginGroup directs the following triangles to the named group. Returning
+// to a name seen before continues that group.
+func (b *meshBuilder) beginGroup(name string) {
+	for i, g := range b.groups {
+		if g.name == name {
+			b.group = i
+			return
+		}
+	}
+	b.groups = append(b.groups, meshGroup{name: name, stats: newMeshStats()})
+	b.group = len(b.groups) - 1
+}
+
+// objects summarises each group that received triangles. Files with no
+// groups, or only an unnamed one, report nothing.
+func (b *meshBuilder) objects() []ObjectSummary {
+	var out []ObjectSummary
+	named := false
+	for _, g := range b.groups {
+		if g.stats.triangles == 0 {
+			continue
+		}
+		if g.name != "" {
+			named = true
+		}
+		name := g.name
+		if name == "" {
+			name = "default"
+		}
+		out = append(out, ObjectSummary{
+			Name:           name,
+			TriangleCount:  g.stats.triangles,
+			BoundingBoxMM:  BoundingBox{Min: g.stats.min, Max: g.stats.max},
+			VolumeCM3:      round2(math.Abs(g.stats.volume) / 1000.0),
+			SurfaceAreaCM2: round2(g.stats.area / 100.0),
+		})
+	}
+	if !named {
+		return nil
+	}
+	return out
+}
+
+// noteDuplicates records vertices that indexed formats declare more than once.
+func (b *meshBuilder) noteDuplicates(n int) {
+	b.duplicates += n
+}
+
+// add records a triangle given in file units. Vertices are converted to
+// millimetres first so every measurement downstream is in mm.
+func (b *meshBuilder) add(p0, p1, p2 [3]float64) {
+	if f := b.units.factor(); f != 1 {
+		p0 = [3]float64{p0[0] * f, p0[1] * f, p0[2] * f}
+		p1 = [3]float64{p1[0] * f, p1[1] * f, p1[2] * f}
+		p2 = [3]float64{p2[0] * f, p2[1] * f, p2[2] * f}
+	}
+	b.stats.add(p0, p1, p2)
+	if b.visit != nil {
+		b.visit(p0, p1, p2)
+		return
+	}
+	if b.group >= 0 {
+		b.groups[b.group].stats.add(p0, p1, p2)
+	}
+	if b.truncated {
+		return
+	}
+	if b.usage()+triangleCostBytes > b.budget {
+		b.truncate()
+		return
+	}
+	last := len(b.corners) - 1
+	if last < 0 || len(b.corners[last]) == chunkTriangles {
+		b.corners = append(b.corners, make([]triangle32, 0, chunkTriangles))
+		last++
+	}
+	b.corners[last] = append(b.corners[last], triangle32{to32(p0), to32(p1), to32(p2)})
+	b.kept++
+}
+
+// corner returns corner c%3 of kept triangle c/3.
+func (b *meshBuilder) corner(c int) [3]float32 {
+	t := c / 3
+	return b.corners[t/chunkTriangles][t%chunkTriangles][c%3]
+}
+
+// weld merges corners within weldToleranceMM of one another into vertices
+// and builds the indexed faces, dropping degenerate ones. Corners are sorted
+// by a hash of their grid cell; positions are always compared, since cells
+// can share a hash, and corners near a cell's edge are matched against the
+// neighbouring cells. The corners are released afterwards.
+func (b *meshBuilder) weld() {
+	keys := make([]cellKey, 3*b.kept)
+	for c := range keys {
+		keys[c] = cellKey{hash: cellHash(weldCell(from32(b.corner(c)))), corner: uint32(c)}
+	}
+	slices.SortFunc(keys, func(x, y cellKey) int {
+		if x.hash != y.hash {
+			return cmp.Compare(x.hash, y.hash)
+		}
+		return cmp.Compare(x.corner, y.corner)
+	})
+
+	// Within each run of equal hashes, a corner joins the first
+	// representative it is within tolerance of, or becomes one. The
+	// representatives are compacted into the front of keys, still sorted.
+	b.faces = make([][3]uint32, b.kept)
+	reps := keys[:0]
+	for i := 0; i < len(keys); {
+		j := i + 1
+		for j < len(keys) && keys[j].hash == keys[i].hash {
+			j++
+		}
+		first := len(reps)
+		for _, k := range keys[i:j] {
+			p := b.corner(int(k.corner))
+			rep := -1
+			for r := first; r < len(reps); r++ {
+				if withinWeld(p, b.corner(int(reps[r].corner))) {
+					rep = r
+					break
+				}
+			}
+			if rep < 0 {
+				rep = len(reps)
+				reps = append(reps, k)
+			}
+			b.faces[k.corner/3][k.corner%3] = uint32(rep)
+		}
+		i = j
+	}
+
+	// Join representatives in neighbouring cells. Each pair is found from
+	// the cell that comes first, so only the forward neighbours are looked
+	// up, and only those near enough to hold a point within tolerance.
+	parent := make([]uint32, len(reps))
+	for r := range parent {
+		parent[r] = uint32(r)
+	}
+	find := func(x uint32) uint32 {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	for r, k := range reps {
+		p := b.corner(int(k.corner))
+		cell := weldCell(from32(p))
+		for _, d := range forwardNeighbours {
+			if !nearCell(from32(p), cell, d) {
+				continue
+			}
+			h := cellHash([3]int64{cell[0] + d[0], cell[1] + d[1], cell[2] + d[2]})
+			n, _ := slices.BinarySearchFunc(reps, h, func(k cellKey, h uint64) int { return cmp.Compare(k.hash, h) })
+			for ; n < len(reps) && reps[n].hash == h; n++ {
+				if !withinWeld(p, b.corner(int(reps[n].corner))) {
+					continue
+				}
+				// the lower index is the root, so every run welds to
+				// the same position
+				x, y := find(uint32(r)), find(uint32(n))
+				parent[max(x, y)] = min(x, y)
+			}
+		}
+	}
+
+	// Number the roots in order; parent is reused to map each
+	// representative to its vertex. A root's index is below every member's,
+	// so it is numbered before they are.
+	for r := range parent {
+		if root := find(uint32(r)); root != uint32(r) {
+			parent[r] = root
+		}
+	}
+	b.vertices = make([][3]float64, 0, len(reps))
+	for r := range parent {
+		if root := parent[r]; root != uint32(r) {
+			parent[r] = parent[root]
+			continue
+		}
+		parent[r] = uint32(len(b.vertices))
+		b.vertices = append(b.vertices, from32(b.corner(int(reps[r].corner))))
+	}
+	for i, f := range b.faces {
+		b.faces[i] = [3]uint32{parent[f[0]], parent[f[1]], parent[f[2]]}
+	}
+	keys, reps, parent = nil, nil, nil
+	b.corners = nil
+
+	kept := b.faces[:0]
+	for _, f := range b.faces {
+		if f[0] == f[1] || f[1] == f[2] || f[0] == f[2] ||
+			triangleArea(b.vertices[f[0]], b.vertices[f[1]], b.vertices[f[2]]) < degenerateAreaMM2 {
+			b.degenerate++
+			continue
+		}
+		kept = append(kept, f)
+	}
+	b.faces = kept
+}
+
+type cellKey struct {
+	hash   uint64
+	corner uint32
+}
+
+// forwardNeighbours are the offsets of the 13 neighbouring cells that sort
+// after a cell.
+var forwardNeighbours = func() [][3]int64 {
+	var out [][3]int64
+	for x := int64(-1); x <= 1; x++ {
+		for y := int64(-1); y <= 1; y++ {
+			for z := int64(-1); z <= 1; z++ {
+				if x > 0 || (x == 0 && y > 0) || (x == 0 && y == 0 && z > 0) {
+					out = append(out, [3]int64{x, y, z})
+				}
+			}
+		}
+	}
+	return out
+}()
+
+// weldCell is the cell of the weld grid that holds p.
+func weldCell(p [3]float64) [3]int64 {
+	var c [3]int64
+	for i := range c {
+		c[i] = int64(math.Floor(p[i] / weldCellMM))
+	}
+	return c
+}
+
+// nearCell reports whether p, in cell, is close enough to the cell offset by
+// d for a point there to be within weldToleranceMM of it.
+func nearCell(p [3]float64, cell, d [3]int64) bool {
+	for i := range d {
+		offset := p[i] - float64(cell[i])*weldCellMM
+		switch {
+		case d[i] > 0 && offset < weldCellMM-weldToleranceMM:
+			return false
+		case d[i] < 0 && offset > weldToleranceMM:
+			return false
+		}
+	}
+	return true
+}
+
+func withinWeld(p, q [3]float32) bool {
+	var d2 float64
+	for i := range p {
+		d := float64(p[i]) - float64(q[i])
+		d2 += d * d
+	}
+	return d2 <= weldToleranceMM*weldToleranceMM
+}
+
+func cellHash(c [3]int64) uint64 {
+	var h uint64
+	for i := 0; i < 3; i++ {
+		h = mix64(h ^ uint64(c[i]))
+	}
+	return h
+}
+
+// geometry finalises the stats and runs the validation pass. When every shell
+// is closed but some faces are wound the wrong way, or whole shells are
+// inside out, the volume is recomputed with those faces corrected.
+func (b *meshBuilder) geometry(confidence string) geometry {
+	g := geometry{
+		TriangleCount: b.stats.triangles,
+		BoundingBox:   BoundingBox{Min: b.stats.min, Max: b.stats.max},
+		VolumeCM3:     math.Abs(b.stats.volume) / 1000.0,
+		SurfaceArea:   b.stats.area / 100.0,
+		Confidence:    confidence,
+		Units:         b.units,
+		Objects:       b.objects(),
+	}
+	if b.truncated {
+		// too large to validate, so the volume is taken on trust
+		if g.Confidence == "high" {
+			g.Confidence = "medium"
+		}
+		return g
+	}
+	b.weld()
+	health, corrected := b.validate()
+	g.Health = &health
+	if health.Watertight && (health.FlippedNormals > 0 || health.InvertedShells > 0) {
+		g.VolumeCM3 = math.Abs(corrected) / 1000.0
+	}
+	return g
+}
+
+// edgeRef is one face's use of an undirected edge; key packs the low and
+// high vertex indices and forward is set when the face walks it low->high.
+type edgeRef struct {
+	key     uint64
+	face    int32
+	forward bool
+}
+
+func (b *meshBuilder) validate() (MeshHealth, float64) {
+	health := MeshHealth{
+		Vertices:            len(b.vertices),
+		DegenerateTriangles: b.degenerate,
+		DuplicateVertices:   b.duplicates,
+	}
+	edges := make([]edgeRef, 0, 3*len(b.faces))
+	for i, f := range b.faces {
+		for j := 0; j < 3; j++ {
+			from, to := f[j], f[(j+1)%3]
+			lo, hi := min(from, to), max(from, to)
+			edges = append(edges, edgeRef{key: uint64(lo)<<32 | uint64(hi), face: int32(i), forward: from < to})
+		}
+	}
+	slices.SortFunc(edges, func(x, y edgeRef) int {
+		if x.key != y.key {
+			return cmp.Compare(x.key, y.key)
+		}
+		return cmp.Compare(x.face, y.face)
+	})
+	// Each run of equal keys is one edge; only those shared by exactly two
+	// faces join them for the orientation walk.
+	forEachEdge := func(fn func(run []edgeRef)) {
+		for i := 0; i < len(edges); {
+			j := i + 1
+			for j < len(edges) && edges[j].key == edges[i].key {
+				j++
+			}
+			fn(edges[i:j])
+			i = j
+		}
+	}
+
+	// Walk each shell across manifold edges, propagating orientation from a
+	// seed face. The minority orientation in a shell is counted as flipped.
+	// Adjacency is stored flat: the neighbours of face f are
+	// adjacency[start[f]:start[f+1]].
+	start := make([]int32, len(b.faces)+1)
+	forEachEdge(func(run []edgeRef) {
+		health.Edges++
+		switch {
+		case len(run) == 1:
+			health.BoundaryEdges++
+		case len(run) > 2:
+			health.NonManifoldEdges++
+		default:
+			start[run[0].face+1]++
+			start[run[1].face+1]++
+		}
+	})
+	health.Watertight = health.BoundaryEdges == 0 && health.NonManifoldEdges == 0
+	for i := 1; i < len(start); i++ {
+		start[i] += start[i-1]
+	}
+	adjacency := make([]int32, start[len(b.faces)])
+	fill := append([]int32(nil), start[:len(b.faces)]...)
+	forEachEdge(func(run []edgeRef) {
+		if len(run) != 2 {
+			return
+		}
+		f0, f1 := run[0].face, run[1].face
+		flag := int32(0)
+		if run[0].forward == run[1].forward {
+			flag = 1
+		}
+		// pack the neighbour index with the flip bit in the low bit
+		adjacency[fill[f0]] = (f1 << 1) | flag
+		fill[f0]++
+		adjacency[fill[f1]] = (f0 << 1) | flag
+		fill[f1]++
+	})
+	edges, fill = nil, nil
+
+	orient := make([]int8, len(b.faces)) // 0 unvisited, 1 as seed, -1 flipped vs seed
+	var queue []int32
+	var parts []orientedPart
+	for seed := range b.faces {
+		if orient[seed] != 0 {
+			continue
+		}
+		orient[seed] = 1
+		queue = append(queue[:0], int32(seed))
+		var same, opposite int
+		var volSame, volOpposite float64
+		part := orientedPart{min: b.vertices[b.faces[seed][0]], max: b.vertices[b.faces[seed][0]]}
+		for len(queue) > 0 {
+			f := queue[0]
+			queue = queue[1:]
+			v := b.faceVolume(f)
+			for _, vi := range b.faces[f] {
+				for i, x := range b.vertices[vi] {
+					part.min[i] = math.Min(part.min[i], x)
+					part.max[i] = math.Max(part.max[i], x)
+				}
+			}
+			if orient[f] == 1 {
+				same++
+				volSame += v
+			} else {
+				opposite++
+				volOpposite += v
+			}
+			for _, packed := range adjacency[start[f]:start[f+1]] {
+				n := packed >> 1
+				if orient[n] != 0 {
+					continue
+				}
+				if packed&1 == 1 {
+					orient[n] = -orient[f]
+				} else {
+					orient[n] = orient[f]
+				}
+				queue = append(queue, n)
+			}
+		}
+		if opposite > same {
+			health.FlippedNormals += same
+			part.volume = volOpposite - volSame
+		} else {
+			health.FlippedNormals += opposite
+			part.volume = volSame - volOpposite
+		}
+		parts = append(parts, part)
+	}
+	var corrected float64
+	for _, p := range parts {
+		// A closed part with negative volume is either a cavity inside
+		// another part or a shell wound inside out. Only the latter is an
+		// error, and it counts towards the volume as if it were wound
+		// outwards.
+		if health.Watertight && p.volume < 0 && !p.insideAny(parts) {
+			health.InvertedShells++
+			corrected -= p.volume
+			continue
+		}
+		corrected += p.volume
+	}
+	health.Shells = b.countShells()
+	return health, corrected
+}
+
+// orientedPart is a set of faces joined by manifold edges, with its signed
+// volume taken in the majority orientation.
+type orientedPart struct {
+	min, max [3]float64
+	volume   float64
+}
+
+// insideAny reports whether p lies within the bounds of a larger part wound
+// outwards, which is how a cavity looks.
+func (p orientedPart) insideAny(parts []orientedPart) bool {
+	for _, o := range parts {
+		if o.volume <= -p.volume {
+			continue
+		}
+		inside := true
+		for i := 0; i < 3; i++ {
+			if p.min[i] < o.min[i] || p.max[i] > o.max[i] {
+				inside = false
+				break
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+// countShells counts connected components over shared vertices, so parts
+// touching only along a non-manifold edge still count as one shell.
+func (b *meshBuilder) countShells() int {
+	parent := make([]uint32, len(b.vertices))
+	for i := range parent {
+		parent[i] = uint32(i)
+	}
+	find := func(x uint32) uint32 {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	for _, f := range b.faces {
+		a, c, d := find(f[0]), find(f[1]), find(f[2])
+		parent[c] = a
+		parent[d] = a
+	}
+	counted := make([]bool, len(b.vertices))
+	shells := 0
+	for _, f := range b.faces {
+		if r := find(f[0]); !counted[r] {
+			counted[r] = true
+			shells++
+		}
+	}
+	return shells
+}
+
+func (b *meshBuilder) faceVolume(f int32) float64 {
+	face := b.faces[f]
+	return signedVolumeOfTriangle(b.vertices[face[0]], b.vertices[face[1]], b.vertices[face[2]])
+}
+
+// vertexList is the vertex list of an indexed format (OBJ, 3MF), kept in
+// single precision like the builder's corners; STL stores floats at that
+// precision anyway. It grows in chunks for the same reason.
+type vertexList struct {
+	chunks [][][3]float32
+	n      int
+}
+
+const chunkVertices = 1 << 14
+
+func (l *vertexList) len() int { return l.n }
+
+func (l *vertexList) at(i int) [3]float64 {
+	return from32(l.chunks[i/chunkVertices][i%chunkVertices])
+}
+
+func (l *vertexList) add(p [3]float64) {
+	last := len(l.chunks) - 1
+	if last < 0 || len(l.chunks[last]) == chunkVertices {
+		l.chunks = append(l.chunks, make([][3]float32, 0, chunkVertices))
+		last++
+	}
+	l.chunks[last] = append(l.chunks[last], to32(p))
+	l.n++
+}
+
+// countDuplicates reports how many entries repeat an earlier position. It
+// sorts hashes of the welded positions rather than building a set, to stay
+// within listVertexBytes per vertex.
+func (l *vertexList) countDuplicates() int {
+	hashes := make([]uint64, l.n)
+	for i := range hashes {
+		hashes[i] = weldHash(l.at(i))
+	}
+	slices.Sort(hashes)
+	dups := 0
+	for i := 1; i < len(hashes); i++ {
+		if hashes[i] == hashes[i-1] {
+			dups++
+		}
+	}
+	return dups
+}
+
+// weldHash hashes p rounded to weldToleranceMM. It is only used to count
+// repeated entries in a vertex list; welding itself compares positions.
+func weldHash(p [3]float64) uint64 {
+	var h uint64
+	for i := 0; i < 3; i++ {
+		h = mix64(h ^ uint64(int64(math.Round(p[i]/weldToleranceMM))))
+	}
+	return h
+}
+
+// mix64 is the splitmix64 finaliser.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func to32(p [3]float64) [3]float32 {
+	return [3]float32{float32(p[0]), float32(p[1]), float32(p[2])}
+}
+
+func from32(p [3]float32) [3]float64 {
+	return [3]float64{float64(p[0]), float64(p[1]), float64(p[2])}
+}
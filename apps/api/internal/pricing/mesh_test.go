@@ -0,0 +1,144 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+// cubeTriangles returns a closed cube of side size with its low corner at
+// origin, wound outwards, as six faces of two triangles each.
+func cubeTriangles(origin [3]float64, size float64) [][3][3]float64 {
+	corner := func(x, y, z float64) [3]float64 {
+		return [3]float64{origin[0] + x*size, origin[1] + y*size, origin[2] + z*size}
+	}
+	quads := [6][4][3]float64{
+		{corner(0, 0, 0), corner(0, 1, 0), corner(1, 1, 0), corner(1, 0, 0)}, // bottom
+		{corner(0, 0, 1), corner(1, 0, 1), corner(1, 1, 1), corner(0, 1, 1)}, // top
+		{corner(0, 0, 0), corner(1, 0, 0), corner(1, 0, 1), corner(0, 0, 1)}, // front
+		{corner(1, 0, 0), corner(1, 1, 0), corner(1, 1, 1), corner(1, 0, 1)}, // right
+		{corner(1, 1, 0), corner(0, 1, 0), corner(0, 1, 1), corner(1, 1, 1)}, // back
+		{corner(0, 1, 0), corner(0, 0, 0), corner(0, 0, 1), corner(0, 1, 1)}, // left
+	}
+	var tris [][3][3]float64
+	for _, q := range quads {
+		tris = append(tris, [3][3]float64{q[0], q[1], q[2]}, [3][3]float64{q[0], q[2], q[3]})
+	}
+	return tris
+}
+
+func TestMeshBuilderHealth(t *testing.T) {
+	origin := [3]float64{5, 5, 5} // away from the origin so every face adds volume
+	cube := cubeTriangles(origin, 10)
+	flip := func(tri [3][3]float64) [3][3]float64 { return [3][3]float64{tri[0], tri[2], tri[1]} }
+	flipAll := func(tris [][3][3]float64) [][3][3]float64 {
+		out := make([][3][3]float64, len(tris))
+		for i, tri := range tris {
+			out[i] = flip(tri)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		tris      [][3][3]float64
+		want      MeshHealth
+		volumeCM3 float64
+	}{
+		{
+			name:      "closed cube",
+			tris:      cube,
+			want:      MeshHealth{Vertices: 8, Edges: 18, Shells: 1, Watertight: true},
+			volumeCM3: 1,
+		},
+		{
+			name: "open cube",
+			tris: cube[2:], // no bottom
+			want: MeshHealth{Vertices: 8, Edges: 17, BoundaryEdges: 4, Shells: 1},
+		},
+		{
+			name: "cube with a fin",
+			tris: append(append([][3][3]float64{}, cube...),
+				// a third face on the bottom front edge
+				[3][3]float64{{5, 5, 5}, {15, 5, 5}, {10, -5, 5}}),
+			want: MeshHealth{Vertices: 9, Edges: 20, NonManifoldEdges: 1, BoundaryEdges: 2, Shells: 1},
+		},
+		{
+			name: "cube with one face flipped",
+			tris: append(append(append([][3][3]float64{}, cube[:2]...), flip(cube[2]), flip(cube[3])), cube[4:]...),
+			want: MeshHealth{Vertices: 8, Edges: 18, FlippedNormals: 2, Shells: 1, Watertight: true},
+			// the corrected volume, not what the flipped winding sums to
+			volumeCM3: 1,
+		},
+		{
+			name: "cube with degenerate triangles",
+			tris: append(append([][3][3]float64{}, cube...),
+				[3][3]float64{{5, 5, 5}, {10, 5, 5}, {15, 5, 5}},  // collinear
+				[3][3]float64{{5, 5, 5}, {5, 5, 5}, {15, 15, 15}}, // repeated corner
+			),
+			// the collinear triangle's midpoint is still welded as a vertex
+			want:      MeshHealth{Vertices: 9, Edges: 18, DegenerateTriangles: 2, Shells: 1, Watertight: true},
+			volumeCM3: 1,
+		},
+		{
+			name:      "two cubes",
+			tris:      append(append([][3][3]float64{}, cube...), cubeTriangles([3]float64{30, 0, 0}, 10)...),
+			want:      MeshHealth{Vertices: 16, Edges: 36, Shells: 2, Watertight: true},
+			volumeCM3: 2,
+		},
+		{
+			name: "cube with a corner nudged across a weld cell",
+			tris: func() [][3][3]float64 {
+				tris := append([][3][3]float64{}, cube...)
+				tris[len(tris)-1][2][1] -= 6e-5 // (5, 15, 15), still within tolerance
+				return tris
+			}(),
+			want: MeshHealth{Vertices: 8, Edges: 18, Shells: 1, Watertight: true},
+		},
+		{
+			name: "cube with a corner moved beyond tolerance",
+			tris: func() [][3][3]float64 {
+				tris := append([][3][3]float64{}, cube...)
+				tris[len(tris)-1][2][1] -= 2.5e-4
+				return tris
+			}(),
+			want: MeshHealth{Vertices: 9, Edges: 20, BoundaryEdges: 4, Shells: 1},
+		},
+		{
+			name:      "inside-out cube",
+			tris:      flipAll(cube),
+			want:      MeshHealth{Vertices: 8, Edges: 18, InvertedShells: 1, Shells: 1, Watertight: true},
+			volumeCM3: 1,
+		},
+		{
+			name:      "cube beside an inside-out cube",
+			tris:      append(append([][3][3]float64{}, cube...), flipAll(cubeTriangles([3]float64{30, 0, 0}, 10))...),
+			want:      MeshHealth{Vertices: 16, Edges: 36, InvertedShells: 1, Shells: 2, Watertight: true},
+			volumeCM3: 2,
+		},
+		{
+			name: "cube with a cavity",
+			// the inner cube is wound inwards, as a hollow part's void is
+			tris:      append(append([][3][3]float64{}, cube...), flipAll(cubeTriangles([3]float64{8, 8, 8}, 4))...),
+			want:      MeshHealth{Vertices: 16, Edges: 36, Shells: 2, Watertight: true},
+			volumeCM3: 0.936,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesh := newMeshBuilder(unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}, 0)
+			for _, tri := range tt.tris {
+				mesh.add(tri[0], tri[1], tri[2])
+			}
+			g := mesh.geometry("high")
+			if g.Health == nil {
+				t.Fatal("no health report")
+			}
+			if *g.Health != tt.want {
+				t.Errorf("health = %+v\nwant     %+v", *g.Health, tt.want)
+			}
+			if tt.volumeCM3 > 0 && math.Abs(g.VolumeCM3-tt.volumeCM3) > 1e-9 {
+				t.Errorf("volume = %g cm³, want %g", g.VolumeCM3, tt.volumeCM3)
+			}
+		})
+	}
+}
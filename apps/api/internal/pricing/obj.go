@@ -0,0 +1,138 @@
+package pricing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseOBJ reads Wavefront OBJ geometry. Faces may use any of the v, v/vt,
+// v//vn and v/vt/vn forms with absolute or negative (relative) indices, and
+// polygons are fan-triangulated. Each o and g statement starts a new group so
+// objects can be reported separately.
+func parseOBJ(src io.ReaderAt, size int64, mesh *meshBuilder) (geometry, error) {
+	var (
+		vertices vertexList
+		polygon  [][3]float64
+		pending  []byte
+		faces    int
+		lineNo   int
+	)
+	if err := declareOBJUnits(src, size, &mesh.units); err != nil {
+		return geometry{}, fmt.Errorf("obj: %w", err)
+	}
+	sc := bufio.NewScanner(io.NewSectionReader(src, 0, size))
+	sc.Buffer(make([]byte, 64<<10), maxLineBytes)
+	for sc.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(sc.Bytes())
+		// a trailing backslash continues the statement on the next line;
+		// the joined statement is held to the same limit as a single line
+		if len(pending)+len(line) > maxLineBytes {
+			return geometry{}, fmt.Errorf("obj: line %d: statement longer than %d bytes", lineNo, maxLineBytes)
+		}
+		if bytes.HasSuffix(line, []byte("\\")) {
+			pending = append(pending, line[:len(line)-1]...)
+			pending = append(pending, ' ')
+			continue
+		}
+		if len(pending) > 0 {
+			line = append(pending, line...)
+			pending = pending[:0]
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '#' {
+			continue
+		}
+		keyword, rest := nextField(line)
+		switch string(keyword) {
+		case "v":
+			v, ok := parseVec3(rest)
+			if !ok {
+				return geometry{}, fmt.Errorf("obj: line %d: vertex needs 3 numeric coordinates", lineNo)
+			}
+			vertices.add(v)
+			if err := mesh.holdVertices(vertices.len()); err != nil {
+				return geometry{}, fmt.Errorf("obj: %w", err)
+			}
+		case "f":
+			polygon = polygon[:0]
+			for {
+				var ref []byte
+				ref, rest = nextField(rest)
+				if len(ref) == 0 {
+					break
+				}
+				idx, err := objVertexIndex(ref, vertices.len())
+				if err != nil {
+					return geometry{}, fmt.Errorf("obj: line %d: %w", lineNo, err)
+				}
+				polygon = append(polygon, vertices.at(idx))
+			}
+			if len(polygon) < 3 {
+				return geometry{}, fmt.Errorf("obj: line %d: face needs at least 3 vertices", lineNo)
+			}
+			if mesh.group < 0 {
+				mesh.beginGroup("")
+			}
+			for i := 1; i+1 < len(polygon); i++ {
+				mesh.add(polygon[0], polygon[i], polygon[i+1])
+			}
+			faces++
+		case "o", "g":
+			mesh.beginGroup(strings.Join(strings.Fields(string(rest)), " "))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return geometry{}, fmt.Errorf("obj: line %d: %w", lineNo+1, err)
+	}
+	if vertices.len() == 0 || faces == 0 {
+		return geometry{}, errors.New("obj missing vertices/faces")
+	}
+	mesh.noteDuplicates(vertices.countDuplicates())
+	return mesh.geometry("high"), nil
+}
+
+// declareOBJUnits adopts the first recognised units comment in the file. It
+// reads ahead of the geometry so the units apply to every face, wherever the
+// exporter put the comment.
+func declareOBJUnits(src io.ReaderAt, size int64, units *unitScale) error {
+	sc := bufio.NewScanner(io.NewSectionReader(src, 0, size))
+	sc.Buffer(make([]byte, 64<<10), maxLineBytes)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 || line[0] != '#' {
+			continue
+		}
+		// ignore comments that merely mention units
+		if m := objUnitsComment.FindSubmatch(line); m != nil && units.declare(string(m[1])) == nil {
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+// objVertexIndex resolves the position part of a face reference such as
+// "7", "7/2", "7//3" or "-1/-1/-1" to a zero-based index into the count
+// vertices defined so far.
+func objVertexIndex(ref []byte, count int) (int, error) {
+	pos, _, _ := bytes.Cut(ref, []byte("/"))
+	i, err := strconv.Atoi(string(pos))
+	if err != nil {
+		return 0, fmt.Errorf("invalid vertex reference %q", ref)
+	}
+	idx := i - 1
+	if i < 0 {
+		idx = count + i
+	}
+	if i == 0 || idx < 0 || idx >= count {
+		return 0, fmt.Errorf("vertex index %d out of range (%d vertices defined)", i, count)
+	}
+	return idx, nil
+}
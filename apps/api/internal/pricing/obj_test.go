@@ -0,0 +1,75 @@
+package pricing
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const objCube = `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+f 1 4 3 2
+f 5 6 7 8
+f 1 2 6 5
+f 2 3 7 6
+f 3 4 8 7
+f 4 1 5 8
+`
+
+func TestParseOBJUnitsComment(t *testing.T) {
+	const inch3 = 16.387064 // cm³ in a cubic inch
+	tests := []struct {
+		name string
+		src  string
+		want float64
+	}{
+		{name: "none", src: objCube, want: 0.001},
+		{name: "before geometry", src: "# units: inches\n" + objCube, want: inch3},
+		{name: "after faces", src: objCube + "# Units=in\n", want: inch3},
+		{name: "mention only", src: "# units are whatever the slicer says\n" + objCube, want: 0.001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesh := newMeshBuilder(unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}, 0)
+			src := strings.NewReader(tt.src)
+			g, err := parseOBJ(src, src.Size(), mesh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(g.VolumeCM3-tt.want) > 1e-6 {
+				t.Errorf("volume = %g cm³, want %g", g.VolumeCM3, tt.want)
+			}
+			if g.TriangleCount != 12 {
+				t.Errorf("triangles = %d, want 12", g.TriangleCount)
+			}
+		})
+	}
+}
+
+func TestParseOBJContinuations(t *testing.T) {
+	mesh := newMeshBuilder(unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}, 0)
+	split := strings.Replace(objCube, "f 1 4 3 2", "f 1 4 \\\n3 2", 1)
+	src := strings.NewReader(split)
+	g, err := parseOBJ(src, src.Size(), mesh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.TriangleCount != 12 {
+		t.Errorf("triangles = %d, want 12", g.TriangleCount)
+	}
+
+	// short lines that never end their statement must not be buffered
+	// without limit
+	endless := objCube + strings.Repeat("v 0 0 \\\n", maxLineBytes/4)
+	mesh = newMeshBuilder(unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}, 0)
+	src = strings.NewReader(endless)
+	if _, err := parseOBJ(src, src.Size(), mesh); err == nil || !strings.Contains(err.Error(), "statement longer than") {
+		t.Errorf("endless continuation: got %v, want a statement length error", err)
+	}
+}
@@ -1,9 +1,7 @@
 package pricing
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +15,8 @@ import (
 	"github.com/google/uuid"
 )
 
+var ErrUnsupportedFormat = errors.New("unsupported file type")
+
 type Options struct {
 	MaterialCostPLA float64
 	MachineRate     float64
@@ -24,33 +24,96 @@ type Options struct {
 	PrintSpeed      float64
 	Logger          *slog.Logger
 	StoragePath     string
+	Materials       []Material
+	Qualities       []QualityProfile
+	WallCount       int
+	TopLayers       int
+	BottomLayers    int
+	LineWidthMM     float64
+	Printers        PrinterCatalog
+	// MaxAnalysisBytes bounds the memory kept per model for mesh validation
+	// and orientation. Larger models are priced from running totals only.
+	// Zero means DefaultMaxAnalysisBytes.
+	MaxAnalysisBytes int64
+	// SupportAngleDeg is the overhang angle from vertical beyond which faces
+	// need support. SupportDensity is the fill fraction of support regions.
+	SupportAngleDeg float64
+	SupportDensity  float64
 }
 
 type Service struct {
-	opts Options
+	opts      Options
+	materials []Material
+	qualities []QualityProfile
+}
+
+// EstimateInput carries the customer's print choices. Empty fields fall back
+// to DefaultMaterial and DefaultQuality.
+type EstimateInput struct {
+	Material string
+	Quality  string
+	// Infill overrides RecommendedInfill when set.
+	Infill *int
+	// Units names the unit the file was exported in, overriding any unit the
+	// file declares. Scale is an extra multiplier applied on top.
+	Units string
+	Scale float64
 }
 
 type Estimate struct {
-	ID               uuid.UUID       `json:"id"`
-	Material         string          `json:"material"`
-	MaterialCost     float64         `json:"materialCost"`
-	EstimatedGrams   float64         `json:"estimatedGrams"`
-	EstimatedHours   float64         `json:"estimatedHours"`
-	EstimatedPrice   float64         `json:"estimatedPrice"`
-	SetupFee         float64         `json:"setupFee"`
-	MachineRate      float64         `json:"machineRate"`
-	PrintSpeed       float64         `json:"printSpeed"`
-	Density          float64         `json:"density"`
-	FileName         string          `json:"fileName"`
-	FileSizeBytes    int64           `json:"fileSizeBytes"`
-	TriangleCount    int             `json:"triangleCount"`
-	BoundingBoxMM    BoundingBox     `json:"boundingBoxMm"`
-	VolumeCM3        float64         `json:"volumeCm3"`
-	SurfaceAreaCM2   float64         `json:"surfaceAreaCm2"`
-	Confidence       string          `json:"confidence"`
-	Warnings         []string        `json:"warnings"`
-	Metadata         map[string]any  `json:"metadata"`
-	RecommendedInfill int            `json:"recommendedInfill"`
+	ID                uuid.UUID        `json:"id"`
+	Material          string           `json:"material"`
+	Quality           string           `json:"quality"`
+	LayerHeightMM     float64          `json:"layerHeightMm"`
+	MaterialCost      float64          `json:"materialCost"`
+	EstimatedGrams    float64          `json:"estimatedGrams"`
+	EstimatedHours    float64          `json:"estimatedHours"`
+	EstimatedPrice    float64          `json:"estimatedPrice"`
+	SetupFee          float64          `json:"setupFee"`
+	MachineRate       float64          `json:"machineRate"`
+	PrintSpeed        float64          `json:"printSpeed"`
+	Density           float64          `json:"density"`
+	Slicer            SlicerSettings   `json:"slicer"`
+	PrintedVolumeCM3  float64          `json:"printedVolumeCm3"`
+	Breakdown         PriceBreakdown   `json:"breakdown"`
+	MaterialOptions   []MaterialQuote  `json:"materialOptions"`
+	FileName          string           `json:"fileName"`
+	FileSizeBytes     int64            `json:"fileSizeBytes"`
+	TriangleCount     int              `json:"triangleCount"`
+	BoundingBoxMM     BoundingBox      `json:"boundingBoxMm"`
+	VolumeCM3         float64          `json:"volumeCm3"`
+	SurfaceAreaCM2    float64          `json:"surfaceAreaCm2"`
+	Confidence        string           `json:"confidence"`
+	Fit               *FitReport       `json:"fit,omitempty"`
+	Supports          *SupportEstimate `json:"supports,omitempty"`
+	Objects           []ObjectSummary  `json:"objects,omitempty"`
+	Units             UnitReport       `json:"units"`
+	MeshHealth        *MeshHealth      `json:"meshHealth,omitempty"`
+	Warnings          []string         `json:"warnings"`
+	Metadata          map[string]any   `json:"metadata"`
+	RecommendedInfill int              `json:"recommendedInfill"`
+	// JobID is set when the estimate was saved as a print job.
+	JobID *uuid.UUID `json:"jobId,omitempty"`
+}
+
+// PriceBreakdown itemises EstimatedPrice for the selected material and quality.
+type PriceBreakdown struct {
+	MaterialCost        float64 `json:"materialCost"`
+	MachineCost         float64 `json:"machineCost"`
+	SupportMaterialCost float64 `json:"supportMaterialCost"`
+	SupportMachineCost  float64 `json:"supportMachineCost"`
+	SetupFee            float64 `json:"setupFee"`
+	QualityAdjust       float64 `json:"qualityAdjust"`
+	Total               float64 `json:"total"`
+}
+
+// MaterialQuote prices the same geometry and quality in another material.
+type MaterialQuote struct {
+	Material       string  `json:"material"`
+	Name           string  `json:"name"`
+	EstimatedGrams float64 `json:"estimatedGrams"`
+	EstimatedHours float64 `json:"estimatedHours"`
+	EstimatedPrice float64 `json:"estimatedPrice"`
 }
 
 type BoundingBox struct {
@@ -59,285 +122,279 @@ type BoundingBox struct {
 }
 
 func NewService(opts Options) *Service {
-	return &Service{opts: opts}
+	materials := opts.Materials
+	if len(materials) == 0 {
+		materials = DefaultMaterials(opts.MaterialCostPLA)
+	}
+	qualities := opts.Qualities
+	if len(qualities) == 0 {
+		qualities = DefaultQualities()
+	}
+	return &Service{opts: opts, materials: materials, qualities: qualities}
 }
 
-func (s *Service) EstimateFromUpload(ctx context.Context, fileHeader *multipart.FileHeader) (*Estimate, []byte, error) {
+// EstimateFromUpload prices an uploaded model without buffering it.
+func (s *Service) EstimateFromUpload(ctx context.Context, fileHeader *multipart.FileHeader, input EstimateInput) (*Estimate, error) {
 	src, err := fileHeader.Open()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer src.Close()
-	buf := &bytes.Buffer{}
-	if _, err := io.Copy(buf, src); err != nil {
-		return nil, nil, err
+	return s.Estimate(ctx, fileHeader.Filename, src, fileHeader.Size, input)
+}
+
+// Estimate prices the model in src, which holds size bytes. The format is
+// chosen from name's extension, and the file is streamed rather than loaded
+// into memory.
+func (s *Service) Estimate(ctx context.Context, name string, src io.ReaderAt, size int64, input EstimateInput) (*Estimate, error) {
+	material, err := s.material(input.Material)
+	if err != nil {
+		return nil, err
+	}
+	quality, err := s.quality(input.Quality)
+	if err != nil {
+		return nil, err
+	}
+	if input.Infill != nil && (*input.Infill < 0 || *input.Infill > 100) {
+		return nil, ErrInvalidInfill
+	}
+	units, err := unitScaleFor(input)
+	if err != nil {
+		return nil, err
 	}
-	data := buf.Bytes()
 
-	analysis, warn := s.analyseGeometry(fileHeader.Filename, data)
-	estimate := s.pricingFor(analysis)
-	estimate.FileName = fileHeader.Filename
-	estimate.FileSizeBytes = int64(len(data))
-	estimate.Warnings = warn
+	analysis, warn := s.analyseGeometry(name, src, size, units)
+	printers, err := s.activePrinters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fit := orient(&analysis, printers, material)
+	if fit != nil && !fit.Fits {
+		analysis.Confidence = "low"
+	}
+	estimate := s.pricingFor(analysis, material, quality, input.Infill, fit)
+	estimate.FileName = name
+	estimate.FileSizeBytes = size
+	estimate.Warnings = append(warn, fitWarnings(fit, analysis.BoundingBox, material)...)
 	estimate.Metadata = map[string]any{
 		"generatedAt": time.Now().UTC(),
 	}
-	return estimate, data, nil
+	return estimate, nil
 }
 
 type geometry struct {
-	TriangleCount int
-	BoundingBox   BoundingBox
-	VolumeCM3     float64
-	SurfaceArea   float64
-	Confidence    string
+	TriangleCount  int
+	BoundingBox    BoundingBox
+	VolumeCM3      float64
+	SurfaceArea    float64
+	Confidence     string
+	Health         *MeshHealth
+	Units          unitScale
+	SuggestedUnits string
+	Orientation    *orientationResult
+	Objects        []ObjectSummary
+	// orientations are the scored candidates Orientation is chosen from.
+	orientations []orientationResult
 }
 
-func (s *Service) pricingFor(g geometry) *Estimate {
-	const densityPLA = 1.24 // g/cm3
-	grams := math.Max(8, g.VolumeCM3*densityPLA*1.05) // add 5% margin
-	if g.VolumeCM3 == 0 {
-		// fallback heuristic using bounding box diagonal
-		size := diagonal(g.BoundingBox)
-		grams = math.Max(8, size*0.9)
+// buildHeight is the part's height in its chosen print orientation.
+func (g geometry) buildHeight() float64 {
+	if g.Orientation != nil {
+		return g.Orientation.heightMM
 	}
-	hours := grams / 12.0
-	if s.opts.PrintSpeed > 0 && g.VolumeCM3 > 0 {
-		printHours := (g.VolumeCM3 * 1000) / s.opts.PrintSpeed
-		hours = math.Max(hours, printHours)
-	}
-	setup := s.opts.SetupFee
-	machine := hours * s.opts.MachineRate
-	material := grams * s.opts.MaterialCostPLA
-	total := setup + machine + material
-	infill := 20
-	if grams > 120 {
-		infill = 15
+	return g.BoundingBox.Max[2] - g.BoundingBox.Min[2]
+}
+
+func (s *Service) pricingFor(g geometry, material Material, quality QualityProfile, infill *int, fit *FitReport) *Estimate {
+	recommended := recommendedInfill(g)
+	settings := defaultSlicer(s.opts)
+	settings.LayerHeightMM = quality.LayerHeightMM
+	settings.InfillPercent = recommended
+	if infill != nil {
+		settings.InfillPercent = *infill
 	}
-	if grams < 30 {
-		infill = 25
+	mass := s.slice(g, material, quality, settings)
+	machineRate := s.machineRateFor(fit, material)
+	supports := s.supportsFor(g.Orientation, material, quality, machineRate)
+	breakdown := s.price(material, quality, machineRate, mass.Grams, mass.Hours, supports)
+	options := make([]MaterialQuote, 0, len(s.materials))
+	for _, m := range s.materials {
+		if !m.Available {
+			continue
+		}
+		mm := s.slice(g, m, quality, settings)
+		rate := s.machineRateFor(fit, m)
+		ms := s.supportsFor(g.Orientation, m, quality, rate)
+		options = append(options, MaterialQuote{
+			Material:       m.Code,
+			Name:           m.Name,
+			EstimatedGrams: round1(mm.Grams + ms.grams()),
+			EstimatedHours: round2(mm.Hours + ms.hours()),
+			EstimatedPrice: s.price(m, quality, rate, mm.Grams, mm.Hours, ms).Total,
+		})
 	}
 	return &Estimate{
-		ID:               uuid.New(),
-		Material:         "PLA",
-		MaterialCost:     material,
-		EstimatedGrams:   round1(grams),
-		EstimatedHours:   round2(hours),
-		EstimatedPrice:   round2(total),
-		SetupFee:         setup,
-		MachineRate:      s.opts.MachineRate,
-		PrintSpeed:       s.opts.PrintSpeed,
-		Density:          densityPLA,
-		TriangleCount:    g.TriangleCount,
-		BoundingBoxMM:    g.BoundingBox,
-		VolumeCM3:        round2(g.VolumeCM3),
-		SurfaceAreaCM2:   round2(g.SurfaceArea),
-		Confidence:       g.Confidence,
-		RecommendedInfill: infill,
+		ID:                uuid.New(),
+		Material:          material.Code,
+		Quality:           quality.Code,
+		LayerHeightMM:     quality.LayerHeightMM,
+		MaterialCost:      breakdown.MaterialCost,
+		EstimatedGrams:    round1(mass.Grams + supports.grams()),
+		EstimatedHours:    round2(mass.Hours + supports.hours()),
+		EstimatedPrice:    breakdown.Total,
+		SetupFee:          breakdown.SetupFee,
+		MachineRate:       round2(machineRate),
+		PrintSpeed:        s.opts.PrintSpeed,
+		Density:           material.Density,
+		Slicer:            settings,
+		PrintedVolumeCM3:  round2(mass.PrintedVolumeCM3),
+		Breakdown:         breakdown,
+		MaterialOptions:   options,
+		TriangleCount:     g.TriangleCount,
+		BoundingBoxMM:     g.BoundingBox,
+		VolumeCM3:         round2(g.VolumeCM3),
+		SurfaceAreaCM2:    round2(g.SurfaceArea),
+		Confidence:        g.Confidence,
+		Fit:               fit,
+		Supports:          supports,
+		Objects:           g.Objects,
+		Units:             g.unitReport(),
+		MeshHealth:        g.Health,
+		RecommendedInfill: recommended,
 	}
 }
 
-func (s *Service) analyseGeometry(name string, data []byte) (geometry, []string) {
-	ext := strings.ToLower(filepath.Ext(name))
-	switch ext {
-	case ".stl":
-		if g, err := parseBinarySTL(data); err == nil {
-			return g, nil
-		}
-	case ".obj":
-		if g, err := parseOBJ(data); err == nil {
-			return g, nil
-		}
-	case ".3mf":
-		if g, err := parse3MF(data); err == nil {
-			return g, nil
+// Quote is the stored outcome of an earlier estimate: what the part weighs
+// and takes to print, supports included, and the options it was quoted in.
+type Quote struct {
+	Material    string
+	Quality     string
+	Grams       float64
+	Hours       float64
+	BoundingBox BoundingBox
+}
+
+// Reprice prices a stored quote under the current materials, rates and
+// printer catalog without re-reading the model.
+func (s *Service) Reprice(ctx context.Context, q Quote) (PriceBreakdown, error) {
+	material, err := s.material(q.Material)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	quality, err := s.quality(q.Quality)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	fit, err := s.checkFit(ctx, q.BoundingBox, material)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	return s.price(material, quality, s.machineRateFor(fit, material), q.Grams, q.Hours, nil), nil
+}
+
+// price itemises a job. machineRate is the hourly rate with the material
+// multiplier already applied; grams and hours exclude supports.
+func (s *Service) price(material Material, quality QualityProfile, machineRate, grams, hours float64, supports *SupportEstimate) PriceBreakdown {
+	materialCost := grams * material.CostPerGram
+	machineCost := hours * machineRate
+	supportMaterial := supports.grams() * material.CostPerGram
+	supportMachine := supports.hours() * machineRate
+	subtotal := materialCost + machineCost + supportMaterial + supportMachine
+	adjust := subtotal * (quality.PriceMultiplier - 1)
+	total := s.opts.SetupFee + subtotal + adjust
+	return PriceBreakdown{
+		MaterialCost:        round2(materialCost),
+		MachineCost:         round2(machineCost),
+		SupportMaterialCost: round2(supportMaterial),
+		SupportMachineCost:  round2(supportMachine),
+		SetupFee:            round2(s.opts.SetupFee),
+		QualityAdjust:       round2(adjust),
+		Total:               round2(total),
+	}
+}
+
+func (s *Service) analyseGeometry(name string, src io.ReaderAt, size int64, units unitScale) (geometry, []string) {
+	mesh := newMeshBuilder(units, s.opts.MaxAnalysisBytes)
+	g, err := parseModel(name, src, size, mesh)
+	if err == nil {
+		g.orientations = mesh.scoreOrientations(s.supportAngle())
+		warnings := applyMeshHealth(&g)
+		if mesh.truncated {
+			warnings = append(warnings, "Model is too large to check in full; mesh checks and orientation were skipped.")
 		}
+		return g, append(warnings, checkUnits(&g)...)
 	}
 	// fallback heuristic based on size
-	size := len(data)
 	grams := math.Max(8, math.Min(250, float64(size)/7000))
 	bb := BoundingBox{
 		Min: [3]float64{0, 0, 0},
 		Max: [3]float64{grams * 0.9, grams * 0.5, grams * 0.4},
 	}
 	return geometry{
-		TriangleCount: size / 50,
+		TriangleCount: int(size / 50),
 		BoundingBox:   bb,
 		VolumeCM3:     grams / 1.24,
 		SurfaceArea:   grams * 1.5,
 		Confidence:    "low",
-	}, []string{"Used heuristic estimation because detailed geometry parsing failed."}
+		Units:         units,
+	}, []string{fmt.Sprintf("Used heuristic estimation because detailed geometry parsing failed: %v.", err)}
 }
 
-func parseBinarySTL(data []byte) (geometry, error) {
-	if len(data) < 84 {
-		return geometry{}, errors.New("stl too small")
-	}
-	triCount := int(binary.LittleEndian.Uint32(data[80:84]))
-	offset := 84
-	if len(data) < offset+50*triCount {
-		// likely ASCII STL; fallback
-		return parseASCIISTL(data)
+// parseModel feeds the model in src to mesh using the parser for name's
+// extension.
+func parseModel(name string, src io.ReaderAt, size int64, mesh *meshBuilder) (geometry, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".stl":
+		return parseSTL(src, size, mesh)
+	case ".obj":
+		return parseOBJ(src, size, mesh)
+	case ".3mf":
+		return parse3MF(src, size, mesh)
 	}
-	var (
-		minX, minY, minZ = math.MaxFloat64, math.MaxFloat64, math.MaxFloat64
-		maxX, maxY, maxZ = -math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64
-		volume           float64
-		area             float64
-	)
+	return geometry{}, ErrUnsupportedFormat
+}
 
-	for i := 0; i < triCount; i++ {
-		if offset+50 > len(data) {
-			break
-		}
-		// skip normal (12 bytes)
-		offset += 12
-		v := make([][3]float64, 3)
-		for j := 0; j < 3; j++ {
-			x := math.Float32frombits(binary.LittleEndian.Uint32(data[offset : offset+4]))
-			y := math.Float32frombits(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
-			z := math.Float32frombits(binary.LittleEndian.Uint32(data[offset+8 : offset+12]))
-			offset += 12
-			v[j] = [3]float64{float64(x), float64(y), float64(z)}
-			minX = math.Min(minX, float64(x))
-			minY = math.Min(minY, float64(y))
-			minZ = math.Min(minZ, float64(z))
-			maxX = math.Max(maxX, float64(x))
-			maxY = math.Max(maxY, float64(y))
-			maxZ = math.Max(maxZ, float64(z))
-		}
-		volume += signedVolumeOfTriangle(v[0], v[1], v[2])
-		area += triangleArea(v[0], v[1], v[2])
-		offset += 2 // attribute byte count
+// ForEachTriangle streams every triangle of the model in src to fn, in
+// millimetres, without keeping the mesh in memory. Indexed formats still
+// hold their vertex list, within DefaultMaxAnalysisBytes. It stops with the
+// context's error once ctx is done.
+func ForEachTriangle(ctx context.Context, name string, src io.ReaderAt, size int64, fn func(a, b, c [3]float64)) error {
+	mesh := newMeshBuilder(unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}, 0)
+	mesh.visit = fn
+	_, err := parseModel(name, contextReaderAt{ctx: ctx, r: src}, size, mesh)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
 	}
-	if triCount == 0 {
-		return geometry{}, errors.New("no triangles parsed")
-	}
-	bb := BoundingBox{
-		Min: [3]float64{minX, minY, minZ},
-		Max: [3]float64{maxX, maxY, maxZ},
-	}
-	return geometry{
-		TriangleCount: triCount,
-		BoundingBox:   bb,
-		VolumeCM3:     math.Abs(volume) / 1000.0,
-		SurfaceArea:   area / 100.0,
-		Confidence:    "high",
-	}, nil
+	return err
 }
 
-func parseASCIISTL(data []byte) (geometry, error) {
-	lines := bytes.Split(data, []byte("\n"))
-	var (
-		minX, minY, minZ = math.MaxFloat64, math.MaxFloat64, math.MaxFloat64
-		maxX, maxY, maxZ = -math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64
-		volume           float64
-		area             float64
-		triCount         int
-		current          [][3]float64
-	)
-	for _, line := range lines {
-		line = bytes.TrimSpace(line)
-		if len(line) == 0 {
-			continue
-		}
-		if bytes.HasPrefix(line, []byte("vertex")) {
-			var x, y, z float64
-			if _, err := fmtSscanf(string(line), "vertex %f %f %f", &x, &y, &z); err == nil {
-				current = append(current, [3]float64{x, y, z})
-				minX = math.Min(minX, x)
-				minY = math.Min(minY, y)
-				minZ = math.Min(minZ, z)
-				maxX = math.Max(maxX, x)
-				maxY = math.Max(maxY, y)
-				maxZ = math.Max(maxZ, z)
-			}
-		}
-		if bytes.HasPrefix(line, []byte("endfacet")) {
-			if len(current) >= 3 {
-				v0, v1, v2 := current[0], current[1], current[2]
-				volume += signedVolumeOfTriangle(v0, v1, v2)
-				area += triangleArea(v0, v1, v2)
-				triCount++
-			}
-			current = current[:0]
-		}
-	}
-	if triCount == 0 {
-		return geometry{}, errors.New("ascii stl parse failed")
-	}
-	bb := BoundingBox{
-		Min: [3]float64{minX, minY, minZ},
-		Max: [3]float64{maxX, maxY, maxZ},
-	}
-	return geometry{
-		TriangleCount: triCount,
-		BoundingBox:   bb,
-		VolumeCM3:     math.Abs(volume) / 1000.0,
-		SurfaceArea:   area / 100.0,
-		Confidence:    "medium",
-	}, nil
+// contextReaderAt fails reads once ctx is done, which the parsers report
+// like any other read error.
+type contextReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
 }
 
-func parseOBJ(data []byte) (geometry, error) {
-	lines := bytes.Split(data, []byte("\n"))
-	var vertices [][3]float64
-	var faces [][3]int
-	for _, line := range lines {
-		line = bytes.TrimSpace(line)
-		if len(line) == 0 || line[0] == '#' {
-			continue
-		}
-		if bytes.HasPrefix(line, []byte("v ")) {
-			var x, y, z float64
-			if _, err := fmtSscanf(string(line), "v %f %f %f", &x, &y, &z); err == nil {
-				vertices = append(vertices, [3]float64{x, y, z})
-			}
-		}
-		if bytes.HasPrefix(line, []byte("f ")) {
-			var a, b, c int
-			if _, err := fmtSscanf(string(line), "f %d %d %d", &a, &b, &c); err == nil {
-				faces = append(faces, [3]int{a - 1, b - 1, c - 1})
-			}
-		}
-	}
-	if len(vertices) == 0 || len(faces) == 0 {
-		return geometry{}, errors.New("obj missing vertices/faces")
+func (c contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
 	}
-	minX, minY, minZ := math.MaxFloat64, math.MaxFloat64, math.MaxFloat64
-	maxX, maxY, maxZ := -math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64
-	for _, v := range vertices {
-		minX = math.Min(minX, v[0])
-		minY = math.Min(minY, v[1])
-		minZ = math.Min(minZ, v[2])
-		maxX = math.Max(maxX, v[0])
-		maxY = math.Max(maxY, v[1])
-		maxZ = math.Max(maxZ, v[2])
-	}
-	var volume, area float64
-	for _, f := range faces {
-		v0 := vertices[f[0]]
-		v1 := vertices[f[1]]
-		v2 := vertices[f[2]]
-		volume += signedVolumeOfTriangle(v0, v1, v2)
-		area += triangleArea(v0, v1, v2)
-	}
-	bb := BoundingBox{
-		Min: [3]float64{minX, minY, minZ},
-		Max: [3]float64{maxX, maxY, maxZ},
-	}
-	return geometry{
-		TriangleCount: len(faces),
-		BoundingBox:   bb,
-		VolumeCM3:     math.Abs(volume) / 1000.0,
-		SurfaceArea:   area / 100.0,
-		Confidence:    "medium",
-	}, nil
+	return c.r.ReadAt(p, off)
 }
 
-func parse3MF(data []byte) (geometry, error) {
-	// TODO: implement proper 3MF parsing. For now return heuristic error.
-	return geometry{}, errors.New("3mf parsing not implemented")
+// applyMeshHealth lowers confidence for meshes that cannot be trusted and
+// returns the warnings to show the customer.
+func applyMeshHealth(g *geometry) []string {
+	if g.Health == nil {
+		return nil
+	}
+	switch {
+	case !g.Health.Watertight:
+		g.Confidence = "low"
+	case (g.Health.FlippedNormals > 0 || g.Health.InvertedShells > 0) && g.Confidence == "high":
+		g.Confidence = "medium"
+	}
+	return g.Health.Warnings()
 }
 
 func signedVolumeOfTriangle(p1, p2, p3 [3]float64) float64 {
@@ -371,8 +428,3 @@ func round1(v float64) float64 {
 func round2(v float64) float64 {
 	return math.Round(v*100) / 100
 }
-
-// fmtSscanf wraps fmt.Sscanf but avoids importing fmt globally in this file.
-func fmtSscanf(str, format string, a ...any) (int, error) {
-	return fmt.Sscanf(str, format, a...)
-}
@@ -0,0 +1,120 @@
+package pricing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+const (
+	stlHeaderBytes = 84
+	stlRecordBytes = 50
+	// maxLineBytes bounds a single line of a text format.
+	maxLineBytes = 1 << 20
+)
+
+// parseSTL reads binary STL when the declared triangle count fits the file,
+// and ASCII STL otherwise.
+func parseSTL(src io.ReaderAt, size int64, mesh *meshBuilder) (geometry, error) {
+	if size < stlHeaderBytes {
+		return geometry{}, errors.New("stl too small")
+	}
+	var header [stlHeaderBytes]byte
+	if _, err := src.ReadAt(header[:], 0); err != nil {
+		return geometry{}, err
+	}
+	triCount := int64(binary.LittleEndian.Uint32(header[80:84]))
+	if size < stlHeaderBytes+stlRecordBytes*triCount {
+		// likely ASCII STL; fallback
+		return parseASCIISTL(io.NewSectionReader(src, 0, size), mesh)
+	}
+	if triCount == 0 {
+		return geometry{}, errors.New("no triangles parsed")
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(src, stlHeaderBytes, stlRecordBytes*triCount), 64<<10)
+	var rec [stlRecordBytes]byte
+	for i := int64(0); i < triCount; i++ {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			return geometry{}, err
+		}
+		// skip the normal (12 bytes); the attribute count trails the vertices
+		var v [3][3]float64
+		for j := 0; j < 3; j++ {
+			off := 12 + j*12
+			v[j] = [3]float64{
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(rec[off:]))),
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(rec[off+4:]))),
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(rec[off+8:]))),
+			}
+		}
+		mesh.add(v[0], v[1], v[2])
+	}
+	return mesh.geometry("high"), nil
+}
+
+func parseASCIISTL(r io.Reader, mesh *meshBuilder) (geometry, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), maxLineBytes)
+	var current [3][3]float64
+	n := 0
+	for sc.Scan() {
+		keyword, rest := nextField(sc.Bytes())
+		switch {
+		case bytes.Equal(keyword, []byte("vertex")):
+			v, ok := parseVec3(rest)
+			if ok && n < 3 {
+				current[n] = v
+				n++
+			}
+		case bytes.Equal(keyword, []byte("endfacet")):
+			if n == 3 {
+				mesh.add(current[0], current[1], current[2])
+			}
+			n = 0
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return geometry{}, err
+	}
+	if mesh.stats.triangles == 0 {
+		return geometry{}, errors.New("ascii stl parse failed")
+	}
+	return mesh.geometry("medium"), nil
+}
+
+// nextField splits the first whitespace-separated field off line without
+// allocating.
+func nextField(line []byte) (field, rest []byte) {
+	i := 0
+	for i < len(line) && isSpace(line[i]) {
+		i++
+	}
+	j := i
+	for j < len(line) && !isSpace(line[j]) {
+		j++
+	}
+	return line[i:j], line[j:]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+// parseVec3 reads three numbers from the start of line.
+func parseVec3(line []byte) ([3]float64, bool) {
+	var v [3]float64
+	for i := 0; i < 3; i++ {
+		var f []byte
+		f, line = nextField(line)
+		x, err := strconv.ParseFloat(string(f), 64)
+		if err != nil {
+			return v, false
+		}
+		v[i] = x
+	}
+	return v, true
+}
@@ -0,0 +1,219 @@
+package pricing
+
+import (
+	"math"
+)
+
+const (
+	defaultSupportAngleDeg = 45.0
+	defaultSupportDensity  = 0.2
+	// bedContactMM is how close to the lowest point a face must be to rest on
+	// the build plate rather than need support.
+	bedContactMM = 0.05
+)
+
+type orientationCandidate struct {
+	name string
+	up   [3]float64
+}
+
+var sin45 = math.Sqrt2 / 2
+
+// orientationCandidates are the rotations tried when choosing how to lay a
+// part on the bed, named by the model direction that ends up pointing up.
+var orientationCandidates = []orientationCandidate{
+	{"+Z", [3]float64{0, 0, 1}},
+	{"-Z", [3]float64{0, 0, -1}},
+	{"+X", [3]float64{1, 0, 0}},
+	{"-X", [3]float64{-1, 0, 0}},
+	{"+Y", [3]float64{0, 1, 0}},
+	{"-Y", [3]float64{0, -1, 0}},
+	{"+Z+Y 45°", [3]float64{0, sin45, sin45}},
+	{"+Z-Y 45°", [3]float64{0, -sin45, sin45}},
+	{"+Z+X 45°", [3]float64{sin45, 0, sin45}},
+	{"+Z-X 45°", [3]float64{-sin45, 0, sin45}},
+}
+
+// SupportEstimate describes the chosen print orientation and the support
+// structures it needs.
+type SupportEstimate struct {
+	Orientation     string     `json:"orientation"`
+	UpVector        [3]float64 `json:"upVector"`
+	HeightMM        float64    `json:"heightMm"`
+	OverhangAreaCM2 float64    `json:"overhangAreaCm2"`
+	VolumeCM3       float64    `json:"volumeCm3"`
+	Grams           float64    `json:"grams"`
+	Hours           float64    `json:"hours"`
+	MaterialCost    float64    `json:"materialCost"`
+	MachineCost     float64    `json:"machineCost"`
+}
+
+type orientationResult struct {
+	candidate orientationCandidate
+	heightMM  float64
+	// footprintMM is the part's extent along two perpendicular directions
+	// across the bed.
+	footprintMM [2]float64
+	overhangMM2 float64
+	supportMM3  float64
+}
+
+// scoreOrientations measures every candidate: the build height and
+// footprint, the area of faces that overhang more than angleDeg from
+// vertical, ignoring faces resting on the bed, and the support volume, which
+// is the overhang area projected down to the bed.
+func (b *meshBuilder) scoreOrientations(angleDeg float64) []orientationResult {
+	if len(b.faces) == 0 {
+		return nil
+	}
+	threshold := math.Cos(angleDeg * math.Pi / 180)
+	results := make([]orientationResult, 0, len(orientationCandidates))
+	for _, c := range orientationCandidates {
+		across := acrossBed(c.up)
+		var lo, hi [3]float64
+		for i := range lo {
+			lo[i], hi[i] = math.MaxFloat64, -math.MaxFloat64
+		}
+		for _, v := range b.vertices {
+			for i, axis := range [3][3]float64{across[0], across[1], c.up} {
+				d := dot(v, axis)
+				lo[i] = math.Min(lo[i], d)
+				hi[i] = math.Max(hi[i], d)
+			}
+		}
+		minH := lo[2]
+		r := orientationResult{
+			candidate:   c,
+			heightMM:    hi[2] - lo[2],
+			footprintMM: [2]float64{hi[0] - lo[0], hi[1] - lo[1]},
+		}
+		for _, f := range b.faces {
+			p0, p1, p2 := b.vertices[f[0]], b.vertices[f[1]], b.vertices[f[2]]
+			n, area := faceNormal(p0, p1, p2)
+			down := -dot(n, c.up)
+			if down < threshold {
+				continue
+			}
+			h0, h1, h2 := dot(p0, c.up)-minH, dot(p1, c.up)-minH, dot(p2, c.up)-minH
+			if math.Max(h0, math.Max(h1, h2)) <= bedContactMM {
+				continue
+			}
+			r.overhangMM2 += area
+			r.supportMM3 += area * down * (h0 + h1 + h2) / 3
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// bestOrientation returns the scored orientation with the least overhang
+// among those allowed accepts, or among all of them when allowed is nil.
+// Ties go to the lower build height.
+func bestOrientation(results []orientationResult, allowed func(*orientationResult) bool) *orientationResult {
+	var best *orientationResult
+	for i := range results {
+		r := &results[i]
+		if allowed != nil && !allowed(r) {
+			continue
+		}
+		if best == nil || r.overhangMM2 < best.overhangMM2*0.99 ||
+			(r.overhangMM2 <= best.overhangMM2*1.01 && r.heightMM < best.heightMM) {
+			best = r
+		}
+	}
+	return best
+}
+
+// acrossBed returns two unit directions perpendicular to up and to each
+// other. The first is the model axis closest to level, so an axis-aligned
+// orientation keeps the model's own axes across the bed.
+func acrossBed(up [3]float64) [2][3]float64 {
+	k := 0
+	for i := 1; i < 3; i++ {
+		if math.Abs(up[i]) < math.Abs(up[k]) {
+			k = i
+		}
+	}
+	var first [3]float64
+	first[k] = 1
+	for i := range first {
+		first[i] -= up[k] * up[i]
+	}
+	l := math.Sqrt(dot(first, first))
+	first = [3]float64{first[0] / l, first[1] / l, first[2] / l}
+	second := [3]float64{
+		up[1]*first[2] - up[2]*first[1],
+		up[2]*first[0] - up[0]*first[2],
+		up[0]*first[1] - up[1]*first[0],
+	}
+	return [2][3]float64{first, second}
+}
+
+func (s *Service) supportAngle() float64 {
+	if s.opts.SupportAngleDeg > 0 {
+		return s.opts.SupportAngleDeg
+	}
+	return defaultSupportAngleDeg
+}
+
+func (s *Service) supportDensity() float64 {
+	if s.opts.SupportDensity > 0 {
+		return s.opts.SupportDensity
+	}
+	return defaultSupportDensity
+}
+
+// supportsFor turns the orientation analysis into material, time and cost.
+// Supports print at infill speed.
+func (s *Service) supportsFor(o *orientationResult, material Material, quality QualityProfile, machineRate float64) *SupportEstimate {
+	if o == nil {
+		return nil
+	}
+	volume := o.supportMM3 * s.supportDensity() // mm3 actually extruded
+	grams := volume / 1000 * material.Density
+	hours := 0.0
+	if s.opts.PrintSpeed > 0 {
+		hours = volume / (s.opts.PrintSpeed / quality.TimeMultiplier)
+	}
+	return &SupportEstimate{
+		Orientation:     o.candidate.name,
+		UpVector:        o.candidate.up,
+		HeightMM:        round2(o.heightMM),
+		OverhangAreaCM2: round2(o.overhangMM2 / 100),
+		VolumeCM3:       round2(volume / 1000),
+		Grams:           round1(grams),
+		Hours:           round2(hours),
+		MaterialCost:    round2(grams * material.CostPerGram),
+		MachineCost:     round2(hours * machineRate),
+	}
+}
+
+func (e *SupportEstimate) grams() float64 {
+	if e == nil {
+		return 0
+	}
+	return e.Grams
+}
+
+func (e *SupportEstimate) hours() float64 {
+	if e == nil {
+		return 0
+	}
+	return e.Hours
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// faceNormal returns the unit normal implied by the winding, and the area.
+func faceNormal(p1, p2, p3 [3]float64) ([3]float64, float64) {
+	ax, ay, az := p2[0]-p1[0], p2[1]-p1[1], p2[2]-p1[2]
+	bx, by, bz := p3[0]-p1[0], p3[1]-p1[1], p3[2]-p1[2]
+	cx, cy, cz := ay*bz-az*by, az*bx-ax*bz, ax*by-ay*bx
+	l := math.Sqrt(cx*cx + cy*cy + cz*cz)
+	if l == 0 {
+		return [3]float64{}, 0
+	}
+	return [3]float64{cx / l, cy / l, cz / l}, l / 2
+}
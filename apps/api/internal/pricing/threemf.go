@@ -0,0 +1,495 @@
+package pricing
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	threeMFModelRelType   = "http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"
+	threeMFProductionNS   = "http://schemas.microsoft.com/3dmanufacturing/production/2015/06"
+	threeMFDefaultModel   = "3D/3dmodel.model"
+	threeMFMaxModelBytes  = 512 << 20
+	threeMFMaxNestedDepth = 16
+	// threeMFMaxInstances bounds how many placements the build may expand
+	// to. Components multiply, so a few bytes of nesting can otherwise name
+	// billions of copies.
+	threeMFMaxInstances = 1 << 16
+)
+
+type tmfRelationships struct {
+	Relationships []struct {
+		Target string `xml:"Target,attr"`
+		Type   string `xml:"Type,attr"`
+	} `xml:"Relationship"`
+}
+
+// tmfModel is the structure of one model part: its objects and build items.
+// Mesh data is not kept; it is streamed once the transforms are known.
+type tmfModel struct {
+	Unit    string
+	Objects map[int]*tmfObject
+	Items   []tmfItem
+}
+
+type tmfObject struct {
+	ID         int
+	Type       string
+	HasMesh    bool
+	Triangles  int
+	Components []tmfComponent
+}
+
+type tmfComponent struct {
+	ObjectID  int
+	Transform string
+	Path      string
+}
+
+type tmfItem = tmfComponent
+
+// transform3MF is a 3MF affine matrix in file order:
+// m00 m01 m02 m10 m11 m12 m20 m21 m22 m30 m31 m32.
+type transform3MF [12]float64
+
+var identity3MF = transform3MF{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0}
+
+func parseTransform3MF(s string) (transform3MF, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return identity3MF, nil
+	}
+	if len(fields) != 12 {
+		return transform3MF{}, fmt.Errorf("3mf: transform needs 12 values, got %d", len(fields))
+	}
+	var t transform3MF
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return transform3MF{}, fmt.Errorf("3mf: invalid transform value %q", f)
+		}
+		t[i] = v
+	}
+	return t, nil
+}
+
+func (t transform3MF) apply(p [3]float64) [3]float64 {
+	return [3]float64{
+		p[0]*t[0] + p[1]*t[3] + p[2]*t[6] + t[9],
+		p[0]*t[1] + p[1]*t[4] + p[2]*t[7] + t[10],
+		p[0]*t[2] + p[1]*t[5] + p[2]*t[8] + t[11],
+	}
+}
+
+// then returns the transform that applies t first and parent second.
+func (t transform3MF) then(parent transform3MF) transform3MF {
+	var out transform3MF
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			out[r*3+c] = t[r*3]*parent[c] + t[r*3+1]*parent[3+c] + t[r*3+2]*parent[6+c]
+		}
+	}
+	moved := parent.apply([3]float64{t[9], t[10], t[11]})
+	out[9], out[10], out[11] = moved[0], moved[1], moved[2]
+	return out
+}
+
+// mirrors reports whether t reverses triangle winding.
+func (t transform3MF) mirrors() bool {
+	det := t[0]*(t[4]*t[8]-t[5]*t[7]) - t[1]*(t[3]*t[8]-t[5]*t[6]) + t[2]*(t[3]*t[7]-t[4]*t[6])
+	return det < 0
+}
+
+// threeMFPackage reads a package in two passes. The build items that place
+// each mesh come after the meshes in a model part, so the first pass reads
+// only the structure and collects the transforms every mesh object is
+// instanced with; the second streams each part's vertices and triangles
+// straight into the builder, holding one object's vertex list at a time.
+type threeMFPackage struct {
+	files  map[string]*zip.File
+	models map[string]*tmfModel
+	// instances maps model part to object ID to the transforms it is
+	// placed with; parts lists the parts in the order first seen.
+	instances map[string]map[int][]transform3MF
+	parts     []string
+	// placements counts every object walkObject visits.
+	placements int
+}
+
+func parse3MF(src io.ReaderAt, size int64, mesh *meshBuilder) (geometry, error) {
+	zr, err := zip.NewReader(src, size)
+	if err != nil {
+		return geometry{}, fmt.Errorf("3mf: open package: %w", err)
+	}
+	pkg := &threeMFPackage{
+		files:     make(map[string]*zip.File, len(zr.File)),
+		models:    map[string]*tmfModel{},
+		instances: map[string]map[int][]transform3MF{},
+	}
+	for _, f := range zr.File {
+		pkg.files[normalize3MFPath(f.Name)] = f
+	}
+
+	rootPath := normalize3MFPath(pkg.rootModelPath())
+	root, err := pkg.model(rootPath)
+	if err != nil {
+		return geometry{}, err
+	}
+	if root.Unit != "" {
+		if err := mesh.units.declare(root.Unit); err != nil {
+			return geometry{}, fmt.Errorf("3mf: %w", err)
+		}
+	}
+	if len(root.Items) == 0 {
+		return geometry{}, errors.New("3mf: build has no items")
+	}
+
+	for _, item := range root.Items {
+		t, err := parseTransform3MF(item.Transform)
+		if err != nil {
+			return geometry{}, err
+		}
+		modelPath := rootPath
+		if item.Path != "" {
+			modelPath = normalize3MFPath(item.Path)
+		}
+		if err := pkg.walkObject(modelPath, item.ObjectID, t, 0); err != nil {
+			return geometry{}, err
+		}
+	}
+	if err := pkg.checkCopies(mesh.budget); err != nil {
+		return geometry{}, err
+	}
+	for _, part := range pkg.parts {
+		if err := pkg.streamMeshes(part, mesh); err != nil {
+			return geometry{}, err
+		}
+	}
+	if mesh.stats.triangles == 0 {
+		return geometry{}, errors.New("3mf: no triangles parsed")
+	}
+	return mesh.geometry("high"), nil
+}
+
+func (p *threeMFPackage) rootModelPath() string {
+	f, ok := p.files[normalize3MFPath("_rels/.rels")]
+	if !ok {
+		return threeMFDefaultModel
+	}
+	var rels tmfRelationships
+	if err := p.decode(f, &rels); err != nil {
+		return threeMFDefaultModel
+	}
+	for _, rel := range rels.Relationships {
+		if rel.Type == threeMFModelRelType && rel.Target != "" {
+			return normalize3MFPath(rel.Target)
+		}
+	}
+	return threeMFDefaultModel
+}
+
+func (p *threeMFPackage) model(name string) (*tmfModel, error) {
+	key := normalize3MFPath(name)
+	if m, ok := p.models[key]; ok {
+		return m, nil
+	}
+	rc, err := p.open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	m, err := read3MFModel(rc)
+	if err != nil {
+		return nil, fmt.Errorf("3mf: decode %s: %w", name, err)
+	}
+	p.models[key] = m
+	return m, nil
+}
+
+func (p *threeMFPackage) open(key string) (io.ReadCloser, error) {
+	f, ok := p.files[key]
+	if !ok {
+		return nil, fmt.Errorf("3mf: missing model part %q", key)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, threeMFMaxModelBytes), rc}, nil
+}
+
+func (p *threeMFPackage) decode(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, threeMFMaxModelBytes)).Decode(v)
+}
+
+// read3MFModel reads the structure of a model part, skipping mesh data.
+func read3MFModel(r io.Reader) (*tmfModel, error) {
+	m := &tmfModel{Objects: map[int]*tmfObject{}}
+	d := xml.NewDecoder(bufio.NewReaderSize(r, 64<<10))
+	var obj *tmfObject
+	inBuild := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "model":
+				m.Unit = xmlAttr(t, "", "unit")
+			case "object":
+				id, err := strconv.Atoi(xmlAttr(t, "", "id"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid object id %q", xmlAttr(t, "", "id"))
+				}
+				obj = &tmfObject{ID: id, Type: xmlAttr(t, "", "type")}
+				m.Objects[id] = obj
+			case "mesh":
+				n, err := countTriangles3MF(d)
+				if err != nil {
+					return nil, err
+				}
+				if obj != nil {
+					obj.HasMesh = true
+					obj.Triangles += n
+				}
+			case "build":
+				inBuild = true
+			case "component", "item":
+				id, err := strconv.Atoi(xmlAttr(t, "", "objectid"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s objectid %q", t.Name.Local, xmlAttr(t, "", "objectid"))
+				}
+				c := tmfComponent{
+					ObjectID:  id,
+					Transform: xmlAttr(t, "", "transform"),
+					Path:      xmlAttr(t, threeMFProductionNS, "path"),
+				}
+				switch {
+				case t.Name.Local == "item" && inBuild:
+					m.Items = append(m.Items, c)
+				case t.Name.Local == "component" && obj != nil:
+					obj.Components = append(obj.Components, c)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "object":
+				obj = nil
+			case "build":
+				inBuild = false
+			}
+		}
+	}
+}
+
+// countTriangles3MF skips the rest of a mesh element, counting its
+// triangles.
+func countTriangles3MF(d *xml.Decoder) (int, error) {
+	n, depth := 0, 1
+	for depth > 0 {
+		tok, err := d.Token()
+		if err != nil {
+			return 0, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if t.Name.Local == "triangle" {
+				n++
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return n, nil
+}
+
+// checkCopies refuses a build whose instancing adds more triangles than the
+// analysis budget could hold. Each placed copy is streamed and measured like
+// the file's own triangles, so the copies are paid for the same way; a mesh
+// placed once costs nothing here.
+func (p *threeMFPackage) checkCopies(budget int64) error {
+	var copies int64
+	for part, objects := range p.instances {
+		m := p.models[part]
+		for id, placed := range objects {
+			copies += int64(m.Objects[id].Triangles) * int64(len(placed)-1)
+		}
+	}
+	if copies*triangleCostBytes > budget {
+		return fmt.Errorf("3mf: %d instanced triangles: %w", copies, errModelTooLarge)
+	}
+	return nil
+}
+
+// streamMeshes reads the part at modelPath again and emits each instanced
+// mesh object's triangles into mesh, once per transform. Mirroring
+// transforms have their winding restored so normals keep pointing outwards.
+func (p *threeMFPackage) streamMeshes(modelPath string, mesh *meshBuilder) error {
+	instances := p.instances[modelPath]
+	rc, err := p.open(modelPath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	d := xml.NewDecoder(bufio.NewReaderSize(rc, 64<<10))
+	var (
+		id       int
+		placed   []transform3MF
+		vertices vertexList
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("3mf: decode %s: %w", modelPath, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "object":
+				id, _ = strconv.Atoi(xmlAttr(t, "", "id"))
+				placed = instances[id]
+			case "mesh":
+				if len(placed) == 0 {
+					if err := d.Skip(); err != nil {
+						return fmt.Errorf("3mf: decode %s: %w", modelPath, err)
+					}
+				}
+			case "vertex":
+				if len(placed) == 0 {
+					continue
+				}
+				var v [3]float64
+				for i, name := range [3]string{"x", "y", "z"} {
+					f, err := strconv.ParseFloat(xmlAttr(t, "", name), 64)
+					if err != nil {
+						return fmt.Errorf("3mf: object %d: invalid vertex %s", id, name)
+					}
+					v[i] = f
+				}
+				vertices.add(v)
+				if err := mesh.holdVertices(vertices.len()); err != nil {
+					return fmt.Errorf("3mf: %w", err)
+				}
+			case "triangle":
+				if len(placed) == 0 {
+					continue
+				}
+				var tri [3]int
+				for i, name := range [3]string{"v1", "v2", "v3"} {
+					n, err := strconv.Atoi(xmlAttr(t, "", name))
+					if err != nil {
+						return fmt.Errorf("3mf: object %d: invalid triangle %s", id, name)
+					}
+					if n < 0 || n >= vertices.len() {
+						return fmt.Errorf("3mf: object %d references missing vertex", id)
+					}
+					tri[i] = n
+				}
+				for _, tf := range placed {
+					a, b, c := tf.apply(vertices.at(tri[0])), tf.apply(vertices.at(tri[1])), tf.apply(vertices.at(tri[2]))
+					if tf.mirrors() {
+						b, c = c, b
+					}
+					mesh.add(a, b, c)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "vertices":
+				if len(placed) > 0 {
+					mesh.noteDuplicates(vertices.countDuplicates())
+				}
+			case "object":
+				placed, vertices = nil, vertexList{}
+				if err := mesh.holdVertices(0); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func xmlAttr(el xml.StartElement, space, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local && a.Name.Space == space {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// walkObject records that objectID is placed with transform t, and walks its
+// components with their transforms composed onto t.
+func (p *threeMFPackage) walkObject(modelPath string, objectID int, t transform3MF, depth int) error {
+	if depth > threeMFMaxNestedDepth {
+		return errors.New("3mf: component nesting too deep")
+	}
+	if p.placements++; p.placements > threeMFMaxInstances {
+		return fmt.Errorf("3mf: more than %d placed objects: %w", threeMFMaxInstances, errModelTooLarge)
+	}
+	m, err := p.model(modelPath)
+	if err != nil {
+		return err
+	}
+	obj, ok := m.Objects[objectID]
+	if !ok {
+		return fmt.Errorf("3mf: object %d not found in %s", objectID, modelPath)
+	}
+	if obj.Type == "other" {
+		return nil
+	}
+	if obj.HasMesh {
+		placed, ok := p.instances[modelPath]
+		if !ok {
+			placed = map[int][]transform3MF{}
+			p.instances[modelPath] = placed
+			p.parts = append(p.parts, modelPath)
+		}
+		placed[objectID] = append(placed[objectID], t)
+	}
+	for _, comp := range obj.Components {
+		ct, err := parseTransform3MF(comp.Transform)
+		if err != nil {
+			return err
+		}
+		next := modelPath
+		if comp.Path != "" {
+			next = normalize3MFPath(comp.Path)
+		}
+		if err := p.walkObject(next, comp.ObjectID, ct.then(t), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize3MFPath turns OPC part names ("/3D/3dmodel.model") into zip entry
+// keys. Part names are case-insensitive in OPC.
+func normalize3MFPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	return strings.ToLower(name)
+}
@@ -0,0 +1,107 @@
+package pricing
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRead3MFModelScopesNamespaces(t *testing.T) {
+	const model = `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="millimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02"
+	xmlns:p="http://schemas.microsoft.com/3dmanufacturing/production/2015/06">
+	<resources>
+		<object id="1" type="model">
+			<components>
+				<component objectid="2" p:path="/3D/part.model"/>
+				<component objectid="3" p:path="/3D/ignored.model" xmlns:p="urn:example:other"/>
+			</components>
+		</object>
+	</resources>
+	<build><item objectid="1"/></build>
+</model>`
+	m, err := read3MFModel(strings.NewReader(model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	components := m.Objects[1].Components
+	if len(components) != 2 {
+		t.Fatalf("got %d components, want 2", len(components))
+	}
+	if got := components[0].Path; got != "/3D/part.model" {
+		t.Errorf("production path = %q, want /3D/part.model", got)
+	}
+	if got := components[1].Path; got != "" {
+		t.Errorf("path in a redeclared namespace = %q, want none", got)
+	}
+	if len(m.Items) != 1 || m.Unit != "millimeter" {
+		t.Errorf("items = %v, unit = %q", m.Items, m.Unit)
+	}
+}
+
+// nested3MF packages a tetrahedron (object 1) under levels of objects that
+// each place the one below copies times.
+func nested3MF(levels, copies int) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("3D/3dmodel.model")
+	fmt.Fprint(w, `<model unit="millimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02"><resources>`+
+		`<object id="1" type="model"><mesh><vertices>`+
+		`<vertex x="0" y="0" z="0"/><vertex x="10" y="0" z="0"/><vertex x="0" y="10" z="0"/><vertex x="0" y="0" z="10"/>`+
+		`</vertices><triangles>`+
+		`<triangle v1="0" v2="2" v3="1"/><triangle v1="0" v2="1" v3="3"/><triangle v1="0" v2="3" v3="2"/><triangle v1="1" v2="2" v3="3"/>`+
+		`</triangles></mesh></object>`)
+	for id := 2; id <= levels+1; id++ {
+		fmt.Fprintf(w, `<object id="%d" type="model"><components>`, id)
+		for range copies {
+			fmt.Fprintf(w, `<component objectid="%d"/>`, id-1)
+		}
+		fmt.Fprint(w, `</components></object>`)
+	}
+	fmt.Fprintf(w, `</resources><build><item objectid="%d"/></build></model>`, levels+1)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestParse3MFInstancing(t *testing.T) {
+	tests := []struct {
+		name           string
+		levels, copies int
+		budget         int64
+		wantErr        bool
+	}{
+		{"few copies", 3, 4, 0, false},
+		// 4^16 placements from a file of a few hundred bytes
+		{"component bomb", 16, 4, 0, true},
+		// 4^5 tetrahedra cost more than a small budget holds
+		{"copies over budget", 5, 4, 1024 * triangleCostBytes, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := nested3MF(tt.levels, tt.copies)
+			mesh := newMeshBuilder(unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}, tt.budget)
+			start := time.Now()
+			_, err := parse3MF(bytes.NewReader(data), int64(len(data)), mesh)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("parse took %v", elapsed)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, errModelTooLarge) {
+					t.Fatalf("%d-byte file: got %v, want errModelTooLarge", len(data), err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 4 * int(math.Pow(float64(tt.copies), float64(tt.levels))); mesh.stats.triangles != want {
+				t.Errorf("triangles = %d, want %d", mesh.stats.triangles, want)
+			}
+		})
+	}
+}
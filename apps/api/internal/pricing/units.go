@@ -0,0 +1,171 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrUnknownUnits = errors.New("unknown units")
+	ErrInvalidScale = errors.New("scale must be a positive number")
+)
+
+const (
+	UnitSourceDefault  = "default"
+	UnitSourceDeclared = "declared"
+	UnitSourceCustomer = "customer"
+
+	// plausibleMinMM and plausibleMaxMM bound the longest side of parts we
+	// expect to print. Anything outside is probably in the wrong unit.
+	plausibleMinMM = 5.0
+	plausibleMaxMM = 600.0
+)
+
+type unitDef struct {
+	code string
+	name string
+	mm   float64
+}
+
+// unitAliases maps every spelling we accept, from customers or from files,
+// to a canonical unit.
+var unitAliases = map[string]unitDef{
+	"um":          {"um", "micrometres", 0.001},
+	"micron":      {"um", "micrometres", 0.001},
+	"microns":     {"um", "micrometres", 0.001},
+	"micrometer":  {"um", "micrometres", 0.001},
+	"micrometre":  {"um", "micrometres", 0.001},
+	"mm":          {"mm", "millimetres", 1},
+	"millimeter":  {"mm", "millimetres", 1},
+	"millimeters": {"mm", "millimetres", 1},
+	"millimetre":  {"mm", "millimetres", 1},
+	"millimetres": {"mm", "millimetres", 1},
+	"cm":          {"cm", "centimetres", 10},
+	"centimeter":  {"cm", "centimetres", 10},
+	"centimeters": {"cm", "centimetres", 10},
+	"centimetre":  {"cm", "centimetres", 10},
+	"centimetres": {"cm", "centimetres", 10},
+	"in":          {"in", "inches", 25.4},
+	"inch":        {"in", "inches", 25.4},
+	"inches":      {"in", "inches", 25.4},
+	"ft":          {"ft", "feet", 304.8},
+	"foot":        {"ft", "feet", 304.8},
+	"feet":        {"ft", "feet", 304.8},
+	"m":           {"m", "metres", 1000},
+	"meter":       {"m", "metres", 1000},
+	"meters":      {"m", "metres", 1000},
+	"metre":       {"m", "metres", 1000},
+	"metres":      {"m", "metres", 1000},
+}
+
+// unitSuggestions is the order candidate units are tried in when a part's
+// size looks implausible.
+var unitSuggestions = []string{"in", "cm", "m", "um"}
+
+// objUnitsComment matches exporter comments such as "# units: inches" or
+// "#Units=mm".
+var objUnitsComment = regexp.MustCompile(`(?i)^#\s*units?\s*[:=]?\s*([a-z]+)`)
+
+func lookupUnits(name string) (unitDef, bool) {
+	u, ok := unitAliases[strings.ToLower(strings.TrimSpace(name))]
+	return u, ok
+}
+
+// UnitReport explains which unit the model was read in and why.
+type UnitReport struct {
+	Units          string  `json:"units"`
+	Source         string  `json:"source"`
+	Scale          float64 `json:"scale"`
+	SuggestedUnits string  `json:"suggestedUnits,omitempty"`
+}
+
+// unitScale is the conversion a meshBuilder applies to every vertex before
+// measuring it.
+type unitScale struct {
+	units  unitDef
+	source string
+	scale  float64
+}
+
+func unitScaleFor(input EstimateInput) (unitScale, error) {
+	us := unitScale{units: unitAliases["mm"], source: UnitSourceDefault, scale: 1}
+	if input.Units != "" {
+		u, ok := lookupUnits(input.Units)
+		if !ok {
+			return unitScale{}, ErrUnknownUnits
+		}
+		us.units = u
+		us.source = UnitSourceCustomer
+	}
+	if input.Scale != 0 {
+		if input.Scale < 0 || math.IsNaN(input.Scale) || math.IsInf(input.Scale, 0) {
+			return unitScale{}, ErrInvalidScale
+		}
+		us.scale = input.Scale
+	}
+	return us, nil
+}
+
+func (u unitScale) factor() float64 {
+	return u.units.mm * u.scale
+}
+
+// declare adopts units stated by the file unless the customer chose some.
+func (u *unitScale) declare(name string) error {
+	def, ok := lookupUnits(name)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownUnits, name)
+	}
+	if u.source == UnitSourceCustomer {
+		return nil
+	}
+	u.units = def
+	u.source = UnitSourceDeclared
+	return nil
+}
+
+// checkUnits flags parts whose size suggests the file was exported in a
+// different unit, and proposes the first unit that would make it plausible.
+func checkUnits(g *geometry) []string {
+	longest := 0.0
+	for i := 0; i < 3; i++ {
+		longest = math.Max(longest, g.BoundingBox.Max[i]-g.BoundingBox.Min[i])
+	}
+	if longest >= plausibleMinMM && longest <= plausibleMaxMM {
+		return nil
+	}
+	u := g.Units
+	if u.source != UnitSourceCustomer {
+		raw := longest / u.factor()
+		for _, code := range unitSuggestions {
+			candidate := raw * unitAliases[code].mm * u.scale
+			if code != u.units.code && candidate >= plausibleMinMM && candidate <= plausibleMaxMM {
+				g.SuggestedUnits = code
+				break
+			}
+		}
+	}
+	var warnings []string
+	if longest < plausibleMinMM {
+		warnings = append(warnings, fmt.Sprintf("Model is only %.2f mm across; check that it was exported in the right units.", longest))
+	} else {
+		warnings = append(warnings, fmt.Sprintf("Model is %.0f mm across, larger than we usually print; check that it was exported in the right units.", longest))
+	}
+	if g.SuggestedUnits != "" {
+		warnings = append(warnings, fmt.Sprintf("The file may be in %s. Re-quote with units=%s if so.", unitAliases[g.SuggestedUnits].name, g.SuggestedUnits))
+		g.Confidence = "low"
+	}
+	return warnings
+}
+
+func (g geometry) unitReport() UnitReport {
+	return UnitReport{
+		Units:          g.Units.units.code,
+		Source:         g.Units.source,
+		Scale:          g.Units.scale,
+		SuggestedUnits: g.SuggestedUnits,
+	}
+}
@@ -0,0 +1,168 @@
+package printers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+	"github.com/3dprint-hub/api/internal/pricing"
+)
+
+var (
+	ErrNotFound     = errors.New("printer not found")
+	ErrInvalidInput = errors.New("name and a positive build volume are required")
+)
+
+type Service struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+type Input struct {
+	Name          string
+	BuildVolumeMM [3]float64
+	NozzleMM      float64
+	Materials     []string
+	HourlyRate    float64
+	Active        *bool
+}
+
+// defaultProfiles seeds an empty catalog with the machines on the farm.
+var defaultProfiles = []database.PrinterProfile{
+	{Name: "Prusa MK4", BuildXMM: 250, BuildYMM: 210, BuildZMM: 220, NozzleMM: 0.4, Materials: []string{"PLA", "PETG", "ASA", "TPU"}, HourlyRate: 12.5, Active: true},
+	{Name: "Bambu Lab X1C", BuildXMM: 256, BuildYMM: 256, BuildZMM: 256, NozzleMM: 0.4, Materials: []string{"PLA", "PETG", "ABS", "ASA", "TPU", "NYLON"}, HourlyRate: 14, Active: true},
+	{Name: "Raise3D Pro3", BuildXMM: 300, BuildYMM: 300, BuildZMM: 300, NozzleMM: 0.6, Materials: []string{"PLA", "PETG", "ABS", "ASA", "NYLON"}, HourlyRate: 18, Active: true},
+	{Name: "Formlabs Form 3", BuildXMM: 145, BuildYMM: 145, BuildZMM: 185, Materials: []string{"RESIN"}, HourlyRate: 16, Active: true},
+}
+
+func New(db *gorm.DB, logger *slog.Logger) *Service {
+	return &Service{db: db, logger: logger}
+}
+
+// EnsureDefaults seeds the catalog the first time the table is created.
+func (s *Service) EnsureDefaults(ctx context.Context) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&database.PrinterProfile{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	profiles := make([]database.PrinterProfile, len(defaultProfiles))
+	copy(profiles, defaultProfiles)
+	return s.db.WithContext(ctx).Create(&profiles).Error
+}
+
+func (s *Service) List(ctx context.Context) ([]database.PrinterProfile, error) {
+	var profiles []database.PrinterProfile
+	if err := s.db.WithContext(ctx).Order("name ASC").Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// ActivePrinters implements pricing.PrinterCatalog.
+func (s *Service) ActivePrinters(ctx context.Context) ([]pricing.Printer, error) {
+	var profiles []database.PrinterProfile
+	if err := s.db.WithContext(ctx).Where("active = ?", true).Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	printers := make([]pricing.Printer, len(profiles))
+	for i, p := range profiles {
+		printers[i] = pricing.Printer{
+			ID:            p.ID,
+			Name:          p.Name,
+			BuildVolumeMM: [3]float64{p.BuildXMM, p.BuildYMM, p.BuildZMM},
+			NozzleMM:      p.NozzleMM,
+			Materials:     p.Materials,
+			HourlyRate:    p.HourlyRate,
+		}
+	}
+	return printers, nil
+}
+
+func (s *Service) Create(ctx context.Context, input Input) (*database.PrinterProfile, error) {
+	if strings.TrimSpace(input.Name) == "" || !positive(input.BuildVolumeMM) {
+		return nil, ErrInvalidInput
+	}
+	profile := &database.PrinterProfile{
+		Name:       strings.TrimSpace(input.Name),
+		BuildXMM:   input.BuildVolumeMM[0],
+		BuildYMM:   input.BuildVolumeMM[1],
+		BuildZMM:   input.BuildVolumeMM[2],
+		NozzleMM:   input.NozzleMM,
+		Materials:  normalizeMaterials(input.Materials),
+		HourlyRate: input.HourlyRate,
+		Active:     input.Active == nil || *input.Active,
+	}
+	if err := s.db.WithContext(ctx).Create(profile).Error; err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Update applies the non-zero fields of input.
+func (s *Service) Update(ctx context.Context, id uuid.UUID, input Input) (*database.PrinterProfile, error) {
+	var profile database.PrinterProfile
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&profile).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if name := strings.TrimSpace(input.Name); name != "" {
+		profile.Name = name
+	}
+	if positive(input.BuildVolumeMM) {
+		profile.BuildXMM = input.BuildVolumeMM[0]
+		profile.BuildYMM = input.BuildVolumeMM[1]
+		profile.BuildZMM = input.BuildVolumeMM[2]
+	}
+	if input.NozzleMM > 0 {
+		profile.NozzleMM = input.NozzleMM
+	}
+	if input.Materials != nil {
+		profile.Materials = normalizeMaterials(input.Materials)
+	}
+	if input.HourlyRate > 0 {
+		profile.HourlyRate = input.HourlyRate
+	}
+	if input.Active != nil {
+		profile.Active = *input.Active
+	}
+	if err := s.db.WithContext(ctx).Save(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&database.PrinterProfile{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func positive(v [3]float64) bool {
+	return v[0] > 0 && v[1] > 0 && v[2] > 0
+}
+
+func normalizeMaterials(materials []string) []string {
+	out := make([]string, 0, len(materials))
+	for _, m := range materials {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
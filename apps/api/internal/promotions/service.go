@@ -0,0 +1,446 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+const (
+	KindPercent      = "percent"
+	KindFixed        = "fixed"
+	KindFreeShipping = "free_shipping"
+)
+
+var (
+	ErrNotFound        = errors.New("promotion not found")
+	ErrInvalidInput    = errors.New("a code and a valid kind and amount are required")
+	ErrCodeTaken       = errors.New("promotion code already in use")
+	ErrRedeemed        = errors.New("promotion has been redeemed; deactivate it instead")
+	ErrInvalidCode     = errors.New("promotion code is not valid")
+	ErrExpired         = errors.New("promotion code has expired")
+	ErrExhausted       = errors.New("promotion code has been fully redeemed")
+	ErrUserLimit       = errors.New("you have already used this promotion code")
+	ErrMinimumSubtotal = errors.New("cart subtotal is below the promotion minimum")
+	ErrNotEligible     = errors.New("no items in the cart qualify for this promotion")
+)
+
+const basisPoints = 10000
+
+type Service struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+type Input struct {
+	Code               string
+	Description        string
+	Kind               string
+	PercentBasisPoints *int
+	AmountCents        *int
+	MinSubtotalCents   *int
+	Materials          []string
+	MaxRedemptions     *int
+	MaxPerUser         *int
+	StartsAt           *time.Time
+	ExpiresAt          *time.Time
+	Active             *bool
+}
+
+// Line is one cart line as the promotion sees it.
+type Line struct {
+	PrintJobID  *uuid.UUID
+	AmountCents int
+}
+
+// Discount is what a promotion takes off a cart. LineCents is parallel to the
+// lines it was computed for.
+type Discount struct {
+	Promotion     *database.Promotion
+	LineCents     []int
+	ShippingCents int
+	TotalCents    int
+}
+
+// CartLines describes cart items as promotion lines, in the same order.
+func CartLines(items []database.CartItem) []Line {
+	lines := make([]Line, len(items))
+	for i, item := range items {
+		lines[i] = Line{PrintJobID: item.PrintJobID, AmountCents: item.Quantity * item.UnitPriceCents}
+	}
+	return lines
+}
+
+func New(db *gorm.DB, logger *slog.Logger) *Service {
+	return &Service{db: db, logger: logger}
+}
+
+func (s *Service) List(ctx context.Context) ([]database.Promotion, error) {
+	var promotions []database.Promotion
+	if err := s.db.WithContext(ctx).Order("created_at DESC").Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+func (s *Service) Create(ctx context.Context, input Input) (*database.Promotion, error) {
+	promotion := &database.Promotion{Active: input.Active == nil || *input.Active}
+	if normalizeCode(input.Code) == "" || !apply(promotion, input) || !valid(promotion) {
+		return nil, ErrInvalidInput
+	}
+	if err := s.checkCode(ctx, promotion.Code, uuid.Nil); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(promotion).Error; err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
+
+// Update applies the set fields of input.
+func (s *Service) Update(ctx context.Context, id uuid.UUID, input Input) (*database.Promotion, error) {
+	var promotion database.Promotion
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&promotion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	code := promotion.Code
+	if !apply(&promotion, input) || !valid(&promotion) {
+		return nil, ErrInvalidInput
+	}
+	if promotion.Code != code {
+		if err := s.checkCode(ctx, promotion.Code, promotion.ID); err != nil {
+			return nil, err
+		}
+	}
+	if input.Active != nil {
+		promotion.Active = *input.Active
+	}
+	columns := changedColumns(input)
+	if len(columns) == 0 {
+		return &promotion, nil
+	}
+	// Only the edited columns are written; redemption_count belongs to
+	// Redeem, which checkouts run while the admin edits.
+	if err := s.db.WithContext(ctx).Model(&promotion).Select(columns).Updates(&promotion).Error; err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// changedColumns lists the columns the set fields of input change.
+func changedColumns(input Input) []string {
+	var columns []string
+	set := func(column string, ok bool) {
+		if ok {
+			columns = append(columns, column)
+		}
+	}
+	set("code", normalizeCode(input.Code) != "")
+	set("description", strings.TrimSpace(input.Description) != "")
+	set("kind", input.Kind != "")
+	set("percent_basis_points", input.PercentBasisPoints != nil)
+	set("amount_cents", input.AmountCents != nil)
+	set("min_subtotal_cents", input.MinSubtotalCents != nil)
+	set("materials", input.Materials != nil)
+	set("max_redemptions", input.MaxRedemptions != nil)
+	set("max_per_user", input.MaxPerUser != nil)
+	set("starts_at", input.StartsAt != nil)
+	set("expires_at", input.ExpiresAt != nil)
+	set("active", input.Active != nil)
+	if len(columns) > 0 {
+		columns = append(columns, "updated_at")
+	}
+	return columns
+}
+
+// Delete removes a promotion nobody has redeemed yet.
+func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
+	var redeemed int64
+	if err := s.db.WithContext(ctx).Model(&database.PromotionRedemption{}).Where("promotion_id = ?", id).Count(&redeemed).Error; err != nil {
+		return err
+	}
+	if redeemed > 0 {
+		return ErrRedeemed
+	}
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&database.Promotion{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Evaluate checks code against the user and their cart and works out the
+// discount. shippingCents may be zero when shipping is not known yet.
+func (s *Service) Evaluate(ctx context.Context, userID uuid.UUID, code string, lines []Line, shippingCents int) (*Discount, error) {
+	var promotion database.Promotion
+	err := s.db.WithContext(ctx).Where("code = ? AND active = ?", normalizeCode(code), true).First(&promotion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if promotion.StartsAt != nil && now.Before(*promotion.StartsAt) {
+		return nil, ErrInvalidCode
+	}
+	if promotion.ExpiresAt != nil && !now.Before(*promotion.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	if promotion.MaxRedemptions > 0 && promotion.RedemptionCount >= promotion.MaxRedemptions {
+		return nil, ErrExhausted
+	}
+	if promotion.MaxPerUser > 0 {
+		used, err := redemptionsBy(s.db.WithContext(ctx), promotion.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if used >= int64(promotion.MaxPerUser) {
+			return nil, ErrUserLimit
+		}
+	}
+	subtotal := 0
+	for _, line := range lines {
+		subtotal += line.AmountCents
+	}
+	if subtotal < promotion.MinSubtotalCents {
+		return nil, fmt.Errorf("%w of %d cents", ErrMinimumSubtotal, promotion.MinSubtotalCents)
+	}
+	eligible, err := s.eligible(ctx, &promotion, lines)
+	if err != nil {
+		return nil, err
+	}
+	return compute(&promotion, lines, eligible, shippingCents)
+}
+
+// eligible reports which lines the promotion's material restriction allows.
+// Catalog items have no material, so they only qualify for unrestricted
+// promotions.
+func (s *Service) eligible(ctx context.Context, promotion *database.Promotion, lines []Line) ([]bool, error) {
+	out := make([]bool, len(lines))
+	if len(promotion.Materials) == 0 {
+		for i := range out {
+			out[i] = true
+		}
+		return out, nil
+	}
+	var jobIDs []uuid.UUID
+	for _, line := range lines {
+		if line.PrintJobID != nil {
+			jobIDs = append(jobIDs, *line.PrintJobID)
+		}
+	}
+	if len(jobIDs) == 0 {
+		return out, nil
+	}
+	var jobs []database.PrintJob
+	if err := s.db.WithContext(ctx).Select("id", "material").Where("id IN ?", jobIDs).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	materials := make(map[uuid.UUID]string, len(jobs))
+	for _, job := range jobs {
+		materials[job.ID] = strings.ToUpper(job.Material)
+	}
+	for i, line := range lines {
+		if line.PrintJobID != nil {
+			out[i] = slices.Contains(promotion.Materials, materials[*line.PrintJobID])
+		}
+	}
+	return out, nil
+}
+
+func compute(promotion *database.Promotion, lines []Line, eligible []bool, shippingCents int) (*Discount, error) {
+	discount := &Discount{Promotion: promotion, LineCents: make([]int, len(lines))}
+	eligibleCents, largest := 0, -1
+	for i, line := range lines {
+		if eligible[i] {
+			eligibleCents += line.AmountCents
+			if largest < 0 || line.AmountCents > lines[largest].AmountCents {
+				largest = i
+			}
+		}
+	}
+	if promotion.Kind != KindFreeShipping && eligibleCents == 0 {
+		return nil, ErrNotEligible
+	}
+	switch promotion.Kind {
+	case KindPercent:
+		for i, line := range lines {
+			if eligible[i] {
+				discount.LineCents[i] = (line.AmountCents*promotion.PercentBasisPoints + basisPoints/2) / basisPoints
+			}
+		}
+	case KindFixed:
+		// Spread the amount over eligible lines by value; rounding leftovers
+		// go to the largest line.
+		amount := min(promotion.AmountCents, eligibleCents)
+		allocated := 0
+		for i, line := range lines {
+			if eligible[i] {
+				discount.LineCents[i] = amount * line.AmountCents / eligibleCents
+				allocated += discount.LineCents[i]
+			}
+		}
+		discount.LineCents[largest] += amount - allocated
+	case KindFreeShipping:
+		discount.ShippingCents = shippingCents
+	}
+	discount.TotalCents = discount.ShippingCents
+	for _, cents := range discount.LineCents {
+		discount.TotalCents += cents
+	}
+	return discount, nil
+}
+
+// Redeem records the discount against the order inside the checkout
+// transaction. The limits are checked again under the transaction so two
+// checkouts cannot both take the last use.
+func Redeem(tx *gorm.DB, promotion *database.Promotion, userID, orderID uuid.UUID, discountCents int) error {
+	res := tx.Model(&database.Promotion{}).
+		Where("id = ? AND (max_redemptions = 0 OR redemption_count < max_redemptions)", promotion.ID).
+		UpdateColumn("redemption_count", gorm.Expr("redemption_count + 1"))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		return ErrExhausted
+	}
+	if promotion.MaxPerUser > 0 {
+		used, err := redemptionsBy(tx, promotion.ID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= int64(promotion.MaxPerUser) {
+			return ErrUserLimit
+		}
+	}
+	return tx.Create(&database.PromotionRedemption{
+		PromotionID:   promotion.ID,
+		UserID:        userID,
+		OrderID:       orderID,
+		DiscountCents: discountCents,
+	}).Error
+}
+
+// Release gives back the redemption of a cancelled order.
+func Release(tx *gorm.DB, orderID uuid.UUID) error {
+	var redemption database.PromotionRedemption
+	err := tx.Where("order_id = ?", orderID).First(&redemption).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Delete(&redemption).Error; err != nil {
+		return err
+	}
+	return tx.Model(&database.Promotion{}).
+		Where("id = ? AND redemption_count > 0", redemption.PromotionID).
+		UpdateColumn("redemption_count", gorm.Expr("redemption_count - 1")).Error
+}
+
+func redemptionsBy(db *gorm.DB, promotionID, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := db.Model(&database.PromotionRedemption{}).
+		Where("promotion_id = ? AND user_id = ?", promotionID, userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (s *Service) checkCode(ctx context.Context, code string, self uuid.UUID) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&database.Promotion{}).
+		Where("code = ? AND id <> ?", code, self).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCodeTaken
+	}
+	return nil
+}
+
+// apply copies the set fields of input onto promotion, reporting false if
+// any is negative.
+func apply(promotion *database.Promotion, input Input) bool {
+	if code := normalizeCode(input.Code); code != "" {
+		promotion.Code = code
+	}
+	if description := strings.TrimSpace(input.Description); description != "" {
+		promotion.Description = description
+	}
+	if input.Kind != "" {
+		promotion.Kind = strings.ToLower(strings.TrimSpace(input.Kind))
+	}
+	for _, v := range []*int{input.PercentBasisPoints, input.AmountCents, input.MinSubtotalCents, input.MaxRedemptions, input.MaxPerUser} {
+		if v != nil && *v < 0 {
+			return false
+		}
+	}
+	if input.PercentBasisPoints != nil {
+		promotion.PercentBasisPoints = *input.PercentBasisPoints
+	}
+	if input.AmountCents != nil {
+		promotion.AmountCents = *input.AmountCents
+	}
+	if input.MinSubtotalCents != nil {
+		promotion.MinSubtotalCents = *input.MinSubtotalCents
+	}
+	if input.Materials != nil {
+		promotion.Materials = make([]string, 0, len(input.Materials))
+		for _, m := range input.Materials {
+			if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+				promotion.Materials = append(promotion.Materials, m)
+			}
+		}
+	}
+	if input.MaxRedemptions != nil {
+		promotion.MaxRedemptions = *input.MaxRedemptions
+	}
+	if input.MaxPerUser != nil {
+		promotion.MaxPerUser = *input.MaxPerUser
+	}
+	if input.StartsAt != nil {
+		promotion.StartsAt = input.StartsAt
+	}
+	if input.ExpiresAt != nil {
+		promotion.ExpiresAt = input.ExpiresAt
+	}
+	return true
+}
+
+func valid(promotion *database.Promotion) bool {
+	if promotion.StartsAt != nil && promotion.ExpiresAt != nil && !promotion.ExpiresAt.After(*promotion.StartsAt) {
+		return false
+	}
+	switch promotion.Kind {
+	case KindPercent:
+		return promotion.PercentBasisPoints > 0 && promotion.PercentBasisPoints <= basisPoints
+	case KindFixed:
+		return promotion.AmountCents > 0
+	case KindFreeShipping:
+		return true
+	}
+	return false
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,50 @@
+package promotions
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/schema"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+// Update writes only changedColumns, so each column apply can set must be
+// listed for its field, and redemption_count never.
+func TestChangedColumnsCoverApply(t *testing.T) {
+	n, now, later, active := 1, time.Now(), time.Now().Add(time.Hour), true
+	input := Input{
+		Code: "SPRING", Description: "Spring sale", Kind: KindPercent,
+		PercentBasisPoints: &n, AmountCents: &n, MinSubtotalCents: &n, Materials: []string{"pla"},
+		MaxRedemptions: &n, MaxPerUser: &n, StartsAt: &now, ExpiresAt: &later, Active: &active,
+	}
+	promotion := &database.Promotion{Active: active}
+	if !apply(promotion, input) {
+		t.Fatal("apply rejected the input")
+	}
+	s, err := schema.Parse(promotion, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := changedColumns(input)
+	if slices.Contains(columns, "redemption_count") {
+		t.Error("changedColumns writes redemption_count")
+	}
+	value := reflect.ValueOf(promotion)
+	for _, field := range s.Fields {
+		if _, zero := field.ValueOf(context.Background(), value); !zero && !slices.Contains(columns, field.DBName) {
+			t.Errorf("apply sets %s, which changedColumns does not list", field.DBName)
+		}
+	}
+
+	if got := changedColumns(Input{MaxRedemptions: &n}); !slices.Equal(got, []string{"max_redemptions", "updated_at"}) {
+		t.Errorf("changedColumns(max redemptions only) = %v", got)
+	}
+	if got := changedColumns(Input{}); got != nil {
+		t.Errorf("changedColumns(nothing set) = %v, want none", got)
+	}
+}
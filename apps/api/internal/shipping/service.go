@@ -0,0 +1,262 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+var (
+	ErrNotFound        = errors.New("shipping rate not found")
+	ErrInvalidInput    = errors.New("name and non-negative prices and limits are required")
+	ErrNoRate          = errors.New("no shipping rate covers this parcel and destination")
+	ErrRateUnavailable = errors.New("the chosen shipping rate does not cover this parcel and destination")
+)
+
+type Options struct {
+	// PackagingGrams is added to every parcel for the box and filler.
+	PackagingGrams float64
+	// PaddingMM is the clearance around the contents on every side.
+	PaddingMM float64
+	// DimDivisor converts volume to weight the way carriers do: cm³ per
+	// billable kg.
+	DimDivisor float64
+}
+
+type Service struct {
+	db     *gorm.DB
+	logger *slog.Logger
+	opts   Options
+}
+
+// Item is one line of parcel contents. SizeMM is zero for items with no
+// known dimensions; they count towards weight only.
+type Item struct {
+	WeightGrams float64
+	SizeMM      [3]float64
+	Quantity    int
+}
+
+type Parcel struct {
+	WeightGrams   float64
+	LongestMM     float64
+	VolumeCM3     float64
+	BillableGrams float64
+}
+
+type Quote struct {
+	RateID     uuid.UUID
+	Name       string
+	Carrier    string
+	PriceCents int
+	Parcel     Parcel
+}
+
+type RateInput struct {
+	Name           string
+	Carrier        string
+	Country        string
+	MaxWeightGrams *float64
+	MaxLengthMM    *float64
+	BaseCents      *int
+	PerKgCents     *int
+	Active         *bool
+}
+
+// defaultRates seeds an empty rate table.
+var defaultRates = []database.ShippingRate{
+	{Name: "Standard", Carrier: "Postal", MaxWeightGrams: 20000, MaxLengthMM: 1000, BaseCents: 499, PerKgCents: 150, Active: true},
+	{Name: "Express", Carrier: "Courier", MaxWeightGrams: 10000, MaxLengthMM: 800, BaseCents: 1499, PerKgCents: 300, Active: true},
+}
+
+func New(db *gorm.DB, logger *slog.Logger, opts Options) *Service {
+	if opts.DimDivisor <= 0 {
+		opts.DimDivisor = 5000
+	}
+	return &Service{db: db, logger: logger, opts: opts}
+}
+
+// EnsureDefaults seeds the rate table the first time it is created.
+func (s *Service) EnsureDefaults(ctx context.Context) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&database.ShippingRate{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	rates := make([]database.ShippingRate, len(defaultRates))
+	copy(rates, defaultRates)
+	return s.db.WithContext(ctx).Create(&rates).Error
+}
+
+// Pack estimates the parcel for items: contents plus packaging by weight,
+// and the contents' combined volume as a padded cube by size. The billable
+// weight is the larger of actual and volumetric weight.
+func (s *Service) Pack(items []Item) Parcel {
+	parcel := Parcel{WeightGrams: s.opts.PackagingGrams}
+	var volumeMM3 float64
+	for _, item := range items {
+		qty := float64(max(item.Quantity, 1))
+		parcel.WeightGrams += item.WeightGrams * qty
+		volumeMM3 += item.SizeMM[0] * item.SizeMM[1] * item.SizeMM[2] * qty
+		for _, side := range item.SizeMM {
+			parcel.LongestMM = math.Max(parcel.LongestMM, side)
+		}
+	}
+	if volumeMM3 > 0 {
+		parcel.LongestMM += 2 * s.opts.PaddingMM
+		side := math.Cbrt(volumeMM3) + 2*s.opts.PaddingMM
+		parcel.VolumeCM3 = side * side * side / 1000
+	}
+	parcel.BillableGrams = math.Max(parcel.WeightGrams, parcel.VolumeCM3/s.opts.DimDivisor*1000)
+	return parcel
+}
+
+// Quote lists the rates that can carry items to country, cheapest first.
+func (s *Service) Quote(ctx context.Context, country string, items []Item) ([]Quote, error) {
+	parcel := s.Pack(items)
+	var rates []database.ShippingRate
+	if err := s.db.WithContext(ctx).
+		Where("active = ? AND country IN ?", true, []string{"", strings.ToUpper(strings.TrimSpace(country))}).
+		Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	quotes := make([]Quote, 0, len(rates))
+	for _, rate := range rates {
+		if rate.MaxWeightGrams > 0 && parcel.BillableGrams > rate.MaxWeightGrams {
+			continue
+		}
+		if rate.MaxLengthMM > 0 && parcel.LongestMM > rate.MaxLengthMM {
+			continue
+		}
+		// Charged per started kilogram.
+		kg := int(math.Ceil(parcel.BillableGrams / 1000))
+		quotes = append(quotes, Quote{
+			RateID:     rate.ID,
+			Name:       rate.Name,
+			Carrier:    rate.Carrier,
+			PriceCents: rate.BaseCents + kg*rate.PerKgCents,
+			Parcel:     parcel,
+		})
+	}
+	sort.SliceStable(quotes, func(i, j int) bool { return quotes[i].PriceCents < quotes[j].PriceCents })
+	return quotes, nil
+}
+
+// Select quotes the chosen rate, or the cheapest when rateID is nil.
+func (s *Service) Select(ctx context.Context, country string, items []Item, rateID *uuid.UUID) (Quote, error) {
+	quotes, err := s.Quote(ctx, country, items)
+	if err != nil {
+		return Quote{}, err
+	}
+	if len(quotes) == 0 {
+		return Quote{}, ErrNoRate
+	}
+	if rateID == nil {
+		return quotes[0], nil
+	}
+	for _, q := range quotes {
+		if q.RateID == *rateID {
+			return q, nil
+		}
+	}
+	return Quote{}, ErrRateUnavailable
+}
+
+func (s *Service) List(ctx context.Context) ([]database.ShippingRate, error) {
+	var rates []database.ShippingRate
+	if err := s.db.WithContext(ctx).Order("country ASC, base_cents ASC").Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (s *Service) Create(ctx context.Context, input RateInput) (*database.ShippingRate, error) {
+	rate := &database.ShippingRate{Active: input.Active == nil || *input.Active}
+	if strings.TrimSpace(input.Name) == "" || input.BaseCents == nil || !applyRate(rate, input) {
+		return nil, ErrInvalidInput
+	}
+	if err := s.db.WithContext(ctx).Create(rate).Error; err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+// Update applies the set fields of input.
+func (s *Service) Update(ctx context.Context, id uuid.UUID, input RateInput) (*database.ShippingRate, error) {
+	var rate database.ShippingRate
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&rate).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if !applyRate(&rate, input) {
+		return nil, ErrInvalidInput
+	}
+	if input.Active != nil {
+		rate.Active = *input.Active
+	}
+	if err := s.db.WithContext(ctx).Save(&rate).Error; err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&database.ShippingRate{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// applyRate copies the set fields of input onto rate, reporting false if any
+// is negative.
+func applyRate(rate *database.ShippingRate, input RateInput) bool {
+	if name := strings.TrimSpace(input.Name); name != "" {
+		rate.Name = name
+	}
+	if carrier := strings.TrimSpace(input.Carrier); carrier != "" {
+		rate.Carrier = carrier
+	}
+	if input.Country != "" {
+		rate.Country = strings.ToUpper(strings.TrimSpace(input.Country))
+	}
+	for _, v := range []*float64{input.MaxWeightGrams, input.MaxLengthMM} {
+		if v != nil && *v < 0 {
+			return false
+		}
+	}
+	for _, v := range []*int{input.BaseCents, input.PerKgCents} {
+		if v != nil && *v < 0 {
+			return false
+		}
+	}
+	if input.MaxWeightGrams != nil {
+		rate.MaxWeightGrams = *input.MaxWeightGrams
+	}
+	if input.MaxLengthMM != nil {
+		rate.MaxLengthMM = *input.MaxLengthMM
+	}
+	if input.BaseCents != nil {
+		rate.BaseCents = *input.BaseCents
+	}
+	if input.PerKgCents != nil {
+		rate.PerKgCents = *input.PerKgCents
+	}
+	return true
+}
@@ -0,0 +1,244 @@
+package tax
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"log/slog"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+var (
+	ErrNotFound     = errors.New("tax rule not found")
+	ErrInvalidInput = errors.New("a two-letter country and a rate between 0 and 10000 basis points are required")
+	ErrDuplicate    = errors.New("a tax rule already exists for this country and region")
+)
+
+const basisPoints = 10000
+
+type Service struct {
+	db       *gorm.DB
+	logger   *slog.Logger
+	fallback database.TaxRule
+}
+
+// Location is where an order is delivered. Country is an ISO 3166-1
+// alpha-2 code; Region is a state or province code within it.
+type Location struct {
+	Country string
+	Region  string
+}
+
+type Input struct {
+	Country         string
+	Region          string
+	Name            string
+	RateBasisPoints *int
+	Inclusive       *bool
+	Active          *bool
+}
+
+// Result is the tax on one subtotal and the rule it came from. RuleID is
+// nil when the fallback rate applied.
+type Result struct {
+	RuleID          *uuid.UUID
+	RuleName        string
+	RateBasisPoints int
+	Inclusive       bool
+	Country         string
+	Region          string
+	TaxCents        int
+	TotalCents      int
+}
+
+// New builds the tax service. fallback applies wherever no rule matches.
+func New(db *gorm.DB, logger *slog.Logger, fallback database.TaxRule) *Service {
+	return &Service{db: db, logger: logger, fallback: fallback}
+}
+
+func (s *Service) List(ctx context.Context) ([]database.TaxRule, error) {
+	var rules []database.TaxRule
+	if err := s.db.WithContext(ctx).Order("country ASC, region ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *Service) Create(ctx context.Context, input Input) (*database.TaxRule, error) {
+	country, region := normalize(input.Country), normalize(input.Region)
+	if len(country) != 2 || input.RateBasisPoints == nil || !validRate(*input.RateBasisPoints) {
+		return nil, ErrInvalidInput
+	}
+	if err := s.checkUnique(ctx, country, region, uuid.Nil); err != nil {
+		return nil, err
+	}
+	rule := &database.TaxRule{
+		Country:         country,
+		Region:          region,
+		Name:            strings.TrimSpace(input.Name),
+		RateBasisPoints: *input.RateBasisPoints,
+		Inclusive:       input.Inclusive != nil && *input.Inclusive,
+		Active:          input.Active == nil || *input.Active,
+	}
+	if err := s.db.WithContext(ctx).Create(rule).Error; err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Update applies the set fields of input. Region can only be changed to
+// another non-empty region.
+func (s *Service) Update(ctx context.Context, id uuid.UUID, input Input) (*database.TaxRule, error) {
+	var rule database.TaxRule
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	country, region := rule.Country, rule.Region
+	if c := normalize(input.Country); c != "" {
+		if len(c) != 2 {
+			return nil, ErrInvalidInput
+		}
+		country = c
+	}
+	if r := normalize(input.Region); r != "" {
+		region = r
+	}
+	if country != rule.Country || region != rule.Region {
+		if err := s.checkUnique(ctx, country, region, rule.ID); err != nil {
+			return nil, err
+		}
+		rule.Country, rule.Region = country, region
+	}
+	if name := strings.TrimSpace(input.Name); name != "" {
+		rule.Name = name
+	}
+	if input.RateBasisPoints != nil {
+		if !validRate(*input.RateBasisPoints) {
+			return nil, ErrInvalidInput
+		}
+		rule.RateBasisPoints = *input.RateBasisPoints
+	}
+	if input.Inclusive != nil {
+		rule.Inclusive = *input.Inclusive
+	}
+	if input.Active != nil {
+		rule.Active = *input.Active
+	}
+	if err := s.db.WithContext(ctx).Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&database.TaxRule{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Resolve picks the most specific active rule for loc: the region's rule,
+// then the country's, then the fallback.
+func (s *Service) Resolve(ctx context.Context, loc Location) (database.TaxRule, error) {
+	country, region := normalize(loc.Country), normalize(loc.Region)
+	if country == "" {
+		return s.fallback, nil
+	}
+	var rules []database.TaxRule
+	if err := s.db.WithContext(ctx).
+		Where("active = ? AND country = ? AND region IN ?", true, country, []string{"", region}).
+		Find(&rules).Error; err != nil {
+		return database.TaxRule{}, err
+	}
+	if rule, ok := match(rules, country, region); ok {
+		return rule, nil
+	}
+	return s.fallback, nil
+}
+
+// match returns the active rule for country and region among rules,
+// preferring one for the region over one for the whole country.
+func match(rules []database.TaxRule, country, region string) (database.TaxRule, bool) {
+	best := -1
+	for i, rule := range rules {
+		if !rule.Active || rule.Country != country || (rule.Region != "" && rule.Region != region) {
+			continue
+		}
+		if best < 0 || rule.Region != "" {
+			best = i
+		}
+	}
+	if best < 0 {
+		return database.TaxRule{}, false
+	}
+	return rules[best], true
+}
+
+// Calculate taxes subtotalCents for delivery to loc.
+func (s *Service) Calculate(ctx context.Context, loc Location, subtotalCents int) (Result, error) {
+	rule, err := s.Resolve(ctx, loc)
+	if err != nil {
+		return Result{}, err
+	}
+	taxCents, totalCents := Apply(subtotalCents, rule.RateBasisPoints, rule.Inclusive)
+	result := Result{
+		RuleName:        rule.Name,
+		RateBasisPoints: rule.RateBasisPoints,
+		Inclusive:       rule.Inclusive,
+		Country:         normalize(loc.Country),
+		Region:          normalize(loc.Region),
+		TaxCents:        taxCents,
+		TotalCents:      totalCents,
+	}
+	if rule.ID != uuid.Nil {
+		id := rule.ID
+		result.RuleID = &id
+	}
+	return result, nil
+}
+
+// Apply computes tax on amountCents in integer cents, rounding half up.
+// Exclusive tax is added on top; inclusive tax is the part of amountCents
+// that is tax, so the total stays amountCents.
+func Apply(amountCents, rateBasisPoints int, inclusive bool) (taxCents, totalCents int) {
+	if inclusive {
+		divisor := basisPoints + rateBasisPoints
+		net := (amountCents*basisPoints + divisor/2) / divisor
+		return amountCents - net, amountCents
+	}
+	taxCents = (amountCents*rateBasisPoints + basisPoints/2) / basisPoints
+	return taxCents, amountCents + taxCents
+}
+
+func (s *Service) checkUnique(ctx context.Context, country, region string, self uuid.UUID) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&database.TaxRule{}).
+		Where("country = ? AND region = ? AND id <> ?", country, region, self).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func validRate(bps int) bool {
+	return bps >= 0 && bps <= basisPoints
+}
+
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,104 @@
+package tax
+
+import (
+	"testing"
+
+	"github.com/3dprint-hub/api/internal/database"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    int
+		rate      int
+		inclusive bool
+		wantTax   int
+		wantTotal int
+	}{
+		{"exclusive", 10000, 800, false, 800, 10800},
+		{"exclusive rounds half up", 15, 1000, false, 2, 17},
+		{"exclusive rounds down", 14, 1000, false, 1, 15},
+		{"exclusive zero rate", 999, 0, false, 0, 999},
+		{"inclusive", 10800, 800, true, 800, 10800},
+		{"inclusive keeps the total", 1999, 2000, true, 333, 1999},
+		{"inclusive rounds the net half up", 11, 1000, true, 1, 11},
+		{"inclusive zero rate", 999, 0, true, 0, 999},
+		{"zero amount", 0, 800, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tax, total := Apply(tt.amount, tt.rate, tt.inclusive)
+			if tax != tt.wantTax || total != tt.wantTotal {
+				t.Errorf("Apply(%d, %d, %v) = %d, %d; want %d, %d",
+					tt.amount, tt.rate, tt.inclusive, tax, total, tt.wantTax, tt.wantTotal)
+			}
+		})
+	}
+}
+
+// Orders are taxed once on their total rather than line by line, so
+// rounding is applied once and can differ from the sum of per-line taxes.
+func TestApplyPerTotalRounding(t *testing.T) {
+	lines := []int{5, 5, 5}
+	tests := []struct {
+		name      string
+		rate      int
+		inclusive bool
+		perLine   int
+		perTotal  int
+	}{
+		{"exclusive", 1000, false, 3, 2},
+		{"inclusive", 1000, true, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var perLine, total int
+			for _, amount := range lines {
+				tax, _ := Apply(amount, tt.rate, tt.inclusive)
+				perLine += tax
+				total += amount
+			}
+			perTotal, _ := Apply(total, tt.rate, tt.inclusive)
+			if perLine != tt.perLine || perTotal != tt.perTotal {
+				t.Errorf("per line %d, per total %d; want %d, %d", perLine, perTotal, tt.perLine, tt.perTotal)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules := []database.TaxRule{
+		{Name: "US", Country: "US", Active: true},
+		{Name: "US-CA", Country: "US", Region: "CA", Active: true},
+		{Name: "US-NY", Country: "US", Region: "NY", Active: false},
+		{Name: "DE", Country: "DE", Active: true},
+		{Name: "FR-inactive", Country: "FR", Active: false},
+	}
+	tests := []struct {
+		country, region string
+		want            string // empty means no match
+	}{
+		{"US", "CA", "US-CA"},
+		{"US", "TX", "US"},
+		{"US", "", "US"},
+		{"US", "NY", "US"}, // inactive region rule falls back to the country
+		{"DE", "BY", "DE"},
+		{"FR", "", ""},
+		{"GB", "", ""},
+	}
+	for _, tt := range tests {
+		rule, ok := match(rules, tt.country, tt.region)
+		got := ""
+		if ok {
+			got = rule.Name
+		}
+		if got != tt.want {
+			t.Errorf("match(%s, %s) = %q, want %q", tt.country, tt.region, got, tt.want)
+		}
+	}
+	// order of the rows must not matter
+	reversed := []database.TaxRule{rules[1], rules[0]}
+	if rule, _ := match(reversed, "US", "CA"); rule.Name != "US-CA" {
+		t.Errorf("region rule listed first: got %q", rule.Name)
+	}
+}
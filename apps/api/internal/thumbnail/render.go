@@ -0,0 +1,210 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/3dprint-hub/api/internal/pricing"
+)
+
+var ErrEmptyModel = errors.New("model has no visible triangles")
+
+const (
+	defaultSize = 256
+	// supersample renders at this multiple of the output size and box-filters
+	// down to smooth the edges.
+	supersample = 2
+	margin      = 0.08
+)
+
+type Options struct {
+	Size  int
+	Color color.RGBA
+}
+
+var defaultColor = color.RGBA{R: 74, G: 134, B: 201, A: 255}
+
+// The camera looks at the model from the front-right-top corner. right, up and
+// towards form an orthonormal basis; towards points at the viewer.
+var (
+	right   = normalize([3]float64{1, 1, 0})
+	towards = normalize([3]float64{1, -1, 1})
+	up      = cross(towards, right)
+	light   = normalize([3]float64{0.4, -0.6, 1})
+)
+
+// RenderPNG draws a shaded isometric view of the model in src and writes it
+// to w as a PNG with a transparent background. The file is read twice: once
+// to frame the model and once to rasterise it. Rendering stops with the
+// context's error once ctx is done.
+func RenderPNG(ctx context.Context, w io.Writer, name string, src io.ReaderAt, size int64, opts Options) error {
+	img, err := Render(ctx, name, src, size, opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+func Render(ctx context.Context, name string, src io.ReaderAt, size int64, opts Options) (*image.NRGBA, error) {
+	if opts.Size <= 0 {
+		opts.Size = defaultSize
+	}
+	if opts.Color.A == 0 {
+		opts.Color = defaultColor
+	}
+
+	minX, minY := math.MaxFloat64, math.MaxFloat64
+	maxX, maxY := -math.MaxFloat64, -math.MaxFloat64
+	err := pricing.ForEachTriangle(ctx, name, src, size, func(a, b, c [3]float64) {
+		for _, p := range [3][3]float64{a, b, c} {
+			x, y := dot(p, right), dot(p, up)
+			minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+			minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	extent := math.Max(maxX-minX, maxY-minY)
+	if extent <= 0 || math.IsInf(extent, 0) || math.IsNaN(extent) {
+		return nil, ErrEmptyModel
+	}
+
+	n := opts.Size * supersample
+	r := &raster{
+		size:  n,
+		depth: make([]float32, n*n),
+		shade: make([]float32, n*n),
+	}
+	for i := range r.depth {
+		r.depth[i] = float32(math.Inf(-1))
+	}
+	scale := float64(n) * (1 - 2*margin) / extent
+	offX := (float64(n) - (maxX-minX)*scale) / 2
+	offY := (float64(n) - (maxY-minY)*scale) / 2
+	project := func(p [3]float64) [3]float64 {
+		return [3]float64{
+			offX + (dot(p, right)-minX)*scale,
+			float64(n) - (offY + (dot(p, up)-minY)*scale),
+			dot(p, towards),
+		}
+	}
+	err = pricing.ForEachTriangle(ctx, name, src, size, func(a, b, c [3]float64) {
+		normal := normalize(cross(sub(b, a), sub(c, a)))
+		// lit from both sides so flipped normals still render
+		intensity := 0.35 + 0.65*math.Abs(dot(normal, light))
+		r.triangle(project(a), project(b), project(c), float32(intensity))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.resolve(opts.Size, opts.Color), nil
+}
+
+// raster is a z-buffer holding, per pixel, the depth and shade of the
+// nearest triangle. Uncovered pixels have depth -Inf.
+type raster struct {
+	size  int
+	depth []float32
+	shade []float32
+}
+
+func (r *raster) triangle(a, b, c [3]float64, intensity float32) {
+	area := edge(a, b, c)
+	if area == 0 {
+		return
+	}
+	x0 := clamp(int(math.Floor(math.Min(a[0], math.Min(b[0], c[0])))), r.size)
+	x1 := clamp(int(math.Ceil(math.Max(a[0], math.Max(b[0], c[0])))), r.size)
+	y0 := clamp(int(math.Floor(math.Min(a[1], math.Min(b[1], c[1])))), r.size)
+	y1 := clamp(int(math.Ceil(math.Max(a[1], math.Max(b[1], c[1])))), r.size)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			p := [3]float64{float64(x) + 0.5, float64(y) + 0.5, 0}
+			w0 := edge(b, c, p) / area
+			w1 := edge(c, a, p) / area
+			w2 := edge(a, b, p) / area
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue
+			}
+			z := float32(w0*a[2] + w1*b[2] + w2*c[2])
+			i := y*r.size + x
+			if z > r.depth[i] {
+				r.depth[i] = z
+				r.shade[i] = intensity
+			}
+		}
+	}
+}
+
+// resolve box-filters the supersampled buffer down to size x size pixels.
+func (r *raster) resolve(size int, base color.RGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	const samples = supersample * supersample
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var covered int
+			var shade float32
+			for sy := 0; sy < supersample; sy++ {
+				for sx := 0; sx < supersample; sx++ {
+					i := (y*supersample+sy)*r.size + x*supersample + sx
+					if !math.IsInf(float64(r.depth[i]), -1) {
+						covered++
+						shade += r.shade[i]
+					}
+				}
+			}
+			if covered == 0 {
+				continue
+			}
+			shade /= float32(covered)
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(float32(base.R) * shade),
+				G: uint8(float32(base.G) * shade),
+				B: uint8(float32(base.B) * shade),
+				A: uint8(255 * covered / samples),
+			})
+		}
+	}
+	return img
+}
+
+// edge is twice the signed area of (a, b, p) in screen space.
+func edge(a, b, p [3]float64) float64 {
+	return (b[0]-a[0])*(p[1]-a[1]) - (b[1]-a[1])*(p[0]-a[0])
+}
+
+func clamp(v, n int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > n {
+		return n
+	}
+	return v
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func normalize(v [3]float64) [3]float64 {
+	l := math.Sqrt(dot(v, v))
+	if l == 0 {
+		return v
+	}
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
@@ -0,0 +1,63 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const tetrahedron = `solid t
+facet normal 0 0 0
+ outer loop
+  vertex 0 0 0
+  vertex 0 10 0
+  vertex 10 0 0
+ endloop
+endfacet
+facet normal 0 0 0
+ outer loop
+  vertex 0 0 0
+  vertex 10 0 0
+  vertex 0 0 10
+ endloop
+endfacet
+facet normal 0 0 0
+ outer loop
+  vertex 0 0 0
+  vertex 0 0 10
+  vertex 0 10 0
+ endloop
+endfacet
+facet normal 0 0 0
+ outer loop
+  vertex 10 0 0
+  vertex 0 10 0
+  vertex 0 0 10
+ endloop
+endfacet
+endsolid t
+`
+
+func TestRender(t *testing.T) {
+	src := strings.NewReader(tetrahedron)
+	img, err := Render(context.Background(), "t.stl", src, src.Size(), Options{Size: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 64 {
+		t.Fatalf("image is %dx%d, want 64x64", b.Dx(), b.Dy())
+	}
+	if c := img.NRGBAAt(32, 32); c.A == 0 {
+		t.Error("centre pixel is transparent")
+	}
+}
+
+func TestRenderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src := strings.NewReader(tetrahedron)
+	if _, err := Render(ctx, "t.stl", src, src.Size(), Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
@@ -1,9 +1,14 @@
 package token
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,21 +20,34 @@ import (
 
 type Service struct {
 	secret           []byte
+	emailSecret      []byte
+	mfaSecret        []byte
+	sealKey          []byte
 	accessTTL        time.Duration
 	refreshTTL       time.Duration
 	refreshTokenSize int
 	logger           *slog.Logger
 }
 
+var ErrMalformedRefreshToken = errors.New("malformed refresh token")
+
+// Claims identify the user and the session (refresh token family) the access
+// token was issued to. The token's own ID is in RegisteredClaims.ID.
 type Claims struct {
-	UserID uuid.UUID `json:"uid"`
-	Role   string    `json:"role"`
+	UserID    uuid.UUID `json:"uid"`
+	Role      string    `json:"role"`
+	SessionID uuid.UUID `json:"sid"`
+	// MFA is set when the session signed in with a second factor.
+	MFA bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
 func New(secret string, accessTTL, refreshTTL time.Duration, refreshTokenSize int, logger *slog.Logger) *Service {
 	return &Service{
 		secret:           []byte(secret),
+		emailSecret:      deriveKey(secret, "email-verification"),
+		mfaSecret:        deriveKey(secret, "mfa-challenge"),
+		sealKey:          deriveKey(secret, "seal"),
 		accessTTL:        accessTTL,
 		refreshTTL:       refreshTTL,
 		refreshTokenSize: refreshTokenSize,
@@ -37,13 +55,22 @@ func New(secret string, accessTTL, refreshTTL time.Duration, refreshTokenSize in
 	}
 }
 
-func (s *Service) GenerateAccessToken(userID uuid.UUID, role string) (token string, expiresAt time.Time, err error) {
+// AccessTTL is how long an access token stays valid, and so how long a
+// revoked session must stay denylisted.
+func (s *Service) AccessTTL() time.Duration {
+	return s.accessTTL
+}
+
+func (s *Service) GenerateAccessToken(userID uuid.UUID, role string, sessionID uuid.UUID, mfa bool) (token string, expiresAt time.Time, err error) {
 	now := time.Now().UTC()
 	expiresAt = now.Add(s.accessTTL)
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
@@ -87,3 +114,144 @@ func (s *Service) GenerateRefreshToken() (plain string, hash string, expiresAt t
 func (s *Service) VerifyRefreshToken(plain, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain))
 }
+
+// FormatRefreshToken joins the token's row ID and its secret into the value
+// handed to clients, so the row can be looked up without scanning hashes.
+func FormatRefreshToken(id uuid.UUID, secret string) string {
+	return id.String() + "." + secret
+}
+
+// ParseRefreshToken splits a token made by FormatRefreshToken.
+func ParseRefreshToken(token string) (uuid.UUID, string, error) {
+	idPart, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return uuid.Nil, "", ErrMalformedRefreshToken
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return uuid.Nil, "", ErrMalformedRefreshToken
+	}
+	return id, secret, nil
+}
+
+// EmailClaims bind a verification token to the address it was sent to, so a
+// token stops working if the address changes.
+type EmailClaims struct {
+	UserID uuid.UUID `json:"uid"`
+	Email  string    `json:"email"`
+	jwt.RegisteredClaims
+}
+
+const emailAudience = "email-verification"
+
+// GenerateEmailToken signs an email verification token. It uses a key
+// derived from the JWT secret, so it can never pass as an access token.
+func (s *Service) GenerateEmailToken(userID uuid.UUID, email string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := EmailClaims{
+		UserID: userID,
+		Email:  email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{emailAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.emailSecret)
+}
+
+func (s *Service) ParseEmailToken(token string) (*EmailClaims, error) {
+	parsed, err := jwt.ParseWithClaims(token, &EmailClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return s.emailSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(emailAudience))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := parsed.Claims.(*EmailClaims); ok && parsed.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token claims")
+}
+
+// MFAClaims identify a user who passed the password step of a login and
+// still has to present a second factor.
+type MFAClaims struct {
+	UserID uuid.UUID `json:"uid"`
+	jwt.RegisteredClaims
+}
+
+const mfaAudience = "mfa-challenge"
+
+// GenerateMFAToken signs a short-lived challenge token for the second login
+// step, with its own derived key like email tokens.
+func (s *Service) GenerateMFAToken(userID uuid.UUID, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl)
+	claims := MFAClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.mfaSecret)
+	return token, expiresAt, err
+}
+
+func (s *Service) ParseMFAToken(token string) (*MFAClaims, error) {
+	parsed, err := jwt.ParseWithClaims(token, &MFAClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return s.mfaSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(mfaAudience))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := parsed.Claims.(*MFAClaims); ok && parsed.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token claims")
+}
+
+// Seal encrypts a secret the server must read back later, such as a TOTP
+// key, with AES-GCM under a key derived from the JWT secret.
+func (s *Service) Seal(plain string) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+func (s *Service) Open(sealed string) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", errors.New("malformed sealed value")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (s *Service) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.sealKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
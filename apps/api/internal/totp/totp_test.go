@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 SHA1 test key "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := Step(now)
+	tests := []struct {
+		name   string
+		offset int64
+		skew   int64
+		ok     bool
+	}{
+		{"current step", 0, 1, true},
+		{"one step behind", -1, 1, true},
+		{"one step ahead", 1, 1, true},
+		{"two steps behind", -2, 1, false},
+		{"two steps ahead", 2, 1, false},
+		{"behind without skew", -1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, step+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := Validate(rfcSecret, code, now, tt.skew)
+			if ok != tt.ok {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != step+tt.offset {
+				t.Errorf("Validate step = %d, want %d", got, step+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		code string
+		ok   bool
+	}{
+		{"287082", true},
+		{" 287 082 ", true},
+		{"28708", false},
+		{"2870820", false},
+		{"287083", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, ok := Validate(rfcSecret, tt.code, now, 0); ok != tt.ok {
+			t.Errorf("Validate(%q) = %v, want %v", tt.code, ok, tt.ok)
+		}
+	}
+}